@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/pkg/util"
+)
+
+const configUsage = `usage: endnetctl config <command> [flags]
+
+Commands:
+  show     print the effective configuration; --origin annotates every value
+           with its source (default, file:line or env variable)
+  schema   print the JSON Schema of the configuration file
+  migrate  upgrade the configuration file and its overlays to the current
+           apiVersion, keeping a .bak copy of every changed file`
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+
+	switch args[0] {
+	case "show":
+		return runConfigShow(args[1:])
+	case "schema":
+		return runConfigSchema(args[1:])
+	case "migrate":
+		return runConfigMigrate(args[1:])
+	default:
+		return fmt.Errorf("unknown config command %q\n%s", args[0], configUsage)
+	}
+}
+
+func runConfigShow(args []string) error {
+	fs := flag.NewFlagSet("config show", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to the EndNET configuration file")
+	environment := fs.String("env", os.Getenv(config.EnvEnvironment), "Environment profile whose overlay is merged over the configuration file")
+	origin := fs.Bool("origin", false, "Annotate every value with where it was set")
+	strict := fs.Bool("strict", false, "Reject keys that are not part of the configuration format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	loader := config.NewFileLoader()
+	loader.Strict = *strict
+	loader.Logger = util.NewLogger()
+	cfg, err := loader.LoadEnvironment(*configPath, *environment)
+	if err != nil {
+		return err
+	}
+
+	// Decrypted values are registered as secrets, so redacting the output
+	// also covers encrypted values.
+	return config.Encode(util.NewRedactingWriter(os.Stdout), cfg, config.EncodeOptions{Origins: *origin})
+}
+
+func runConfigSchema(args []string) error {
+	fs := flag.NewFlagSet("config schema", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	schema, err := config.Schema()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Println(string(schema))
+	return err
+}
+
+func runConfigMigrate(args []string) error {
+	fs := flag.NewFlagSet("config migrate", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to the EndNET configuration file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Overlays are migrated along with the base file so that all files of
+	// a project share one format.
+	overlays, err := filepath.Glob(config.OverlayPath(*configPath, "*"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range append([]string{*configPath}, overlays...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		migrated, from, err := config.Migrate(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if bytes.Equal(migrated, data) {
+			fmt.Printf("%s is up to date (%s).\n", path, config.CurrentAPIVersion)
+			continue
+		}
+
+		backup := path + ".bak"
+		if err := os.WriteFile(backup, data, 0o600); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, migrated); err != nil {
+			return err
+		}
+		fmt.Printf("Migrated %s from %s to %s; the original is saved as %s.\n", path, from, config.CurrentAPIVersion, backup)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/util"
+)
+
+// driftExitStatus maps the highest severity found by endnetctl drift to its
+// exit status. No drift exits with 0 and errors with 1.
+var driftExitStatus = map[tasks.Severity]exitStatus{
+	tasks.SeverityCosmetic:   2,
+	tasks.SeverityFunctional: 3,
+	tasks.SeveritySecurity:   4,
+}
+
+// driftFormatVersion is the version of driftDocument.
+const driftFormatVersion = 1
+
+// driftDocument is the output of endnetctl drift --output json.
+type driftDocument struct {
+	FormatVersion int           `json:"formatVersion"`
+	Project       string        `json:"project"`
+	Environment   string        `json:"environment,omitempty"`
+	CheckedAt     time.Time     `json:"checkedAt"`
+	Severity      string        `json:"severity"`
+	Drift         []tasks.Drift `json:"drift"`
+	Accepted      []tasks.Drift `json:"accepted"`
+}
+
+func runDrift(args []string) error {
+	fs := flag.NewFlagSet("drift", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to the EndNET configuration file")
+	environment := fs.String("env", os.Getenv(config.EnvEnvironment), "Environment profile whose overlay is merged over the configuration file")
+	strict := fs.Bool("strict", false, "Reject keys that are not part of the configuration format")
+	output := fs.String("output", "text", "Output format: text or json")
+	baselinePath := fs.String("baseline", "", "File of accepted drift that is not reported")
+	updateBaseline := fs.Bool("update-baseline", false, "Accept the current drift by writing it to the --baseline file")
+	timeout := fs.Duration("timeout", 0, "Abort the check after this duration; 0 means no limit")
+	logLevel := fs.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	logFormat := fs.String("log-format", "text", "Log output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("unknown output format %q; use text or json", *output)
+	}
+	if *updateBaseline && *baselinePath == "" {
+		return errors.New("--update-baseline requires --baseline")
+	}
+
+	var baseline *tasks.Baseline
+	if *baselinePath != "" {
+		var err error
+		baseline, err = tasks.LoadBaseline(*baselinePath)
+		if err != nil && !(*updateBaseline && errors.Is(err, os.ErrNotExist)) {
+			return err
+		}
+	}
+
+	logger, err := util.NewLoggerWithOptions(util.LogOptions{Level: *logLevel, Format: *logFormat, Output: os.Stderr})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := runContext(logger, *timeout)
+	defer cancel()
+
+	cfg, plan, err := loadPlan(ctx, logger, *configPath, *environment, *strict, nil)
+	if err != nil {
+		return err
+	}
+	drift, accepted := tasks.DetectDrift(plan, baseline)
+
+	stdout := util.NewRedactingWriter(os.Stdout)
+	if *updateBaseline {
+		updated := baseline.Update(append(accepted, drift...))
+		data, err := json.MarshalIndent(updated, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(*baselinePath, append(data, '\n')); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Accepted %d drifted resources in %s.\n", len(updated.Accepted), *baselinePath)
+		return nil
+	}
+
+	if *output == "json" {
+		doc := driftDocument{
+			FormatVersion: driftFormatVersion,
+			Project:       cfg.Project,
+			Environment:   cfg.Environment,
+			CheckedAt:     time.Now().UTC(),
+			Severity:      tasks.MaxSeverity(drift).String(),
+			Drift:         append([]tasks.Drift{}, drift...),
+			Accepted:      append([]tasks.Drift{}, accepted...),
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	} else {
+		writeDriftText(stdout, drift, len(accepted))
+	}
+
+	if status, ok := driftExitStatus[tasks.MaxSeverity(drift)]; ok {
+		return status
+	}
+	return nil
+}
+
+// writeDriftText lists the drift grouped by resource kind with the severity
+// and changes of every resource.
+func writeDriftText(w io.Writer, drift []tasks.Drift, accepted int) {
+	if len(drift) == 0 {
+		fmt.Fprintf(w, "No drift (%d accepted by the baseline).\n", accepted)
+		return
+	}
+
+	counts := make(map[tasks.Severity]int)
+	kind := ""
+	for _, d := range drift {
+		op := d.Operation
+		counts[d.Severity]++
+		if op.Kind() != kind {
+			kind = op.Kind()
+			fmt.Fprintf(w, "%s:\n", kind)
+		}
+		_, name, _ := strings.Cut(op.Target, ":")
+		fmt.Fprintf(w, "  [%s] %s (%s): %s\n", d.Severity, name, op.Type, op.Details)
+		for _, c := range op.Changes {
+			fmt.Fprintf(w, "      %s: %s -> %s\n", c.Field, changeValue(c.Before), changeValue(c.After))
+		}
+	}
+
+	var parts []string
+	for _, s := range []tasks.Severity{tasks.SeveritySecurity, tasks.SeverityFunctional, tasks.SeverityCosmetic} {
+		if counts[s] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+		}
+	}
+	fmt.Fprintf(w, "\nDrift in %d resources (%s); %d accepted by the baseline.\n", len(drift), strings.Join(parts, ", "), accepted)
+}
+
+func changeValue(v string) string {
+	if v == "" {
+		return "(none)"
+	}
+	return v
+}
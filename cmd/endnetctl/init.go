@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"endnet-cli/internal/config"
+)
+
+// initQuestion asks for the value at path. derive updates values that depend
+// on the answer, such as role addresses after the subnet changed, so their
+// defaults stay consistent. Problems with the derived keys listed in checks
+// reject the answer as well.
+type initQuestion struct {
+	path   string
+	prompt string
+	derive func(cfg *config.Config)
+	checks []string
+}
+
+var derivedAddresses = []string{"roles.edge.privateIp", "roles.wg.privateIp", "roles.forge.privateIp", "network.gatewayIp"}
+
+var initQuestions = []initQuestion{
+	{path: "project", prompt: "Project name", derive: deriveNames},
+	{path: "location", prompt: "Hetzner location"},
+	{path: "dns.rootDomain", prompt: "Root domain", derive: func(cfg *config.Config) {
+		cfg.DNS.ForgejoHost = "git." + cfg.DNS.RootDomain
+	}},
+	{path: "dns.forgejoHost", prompt: "Forgejo host name"},
+	{path: "roles.edge.type", prompt: "Edge server type"},
+	{path: "roles.wg.type", prompt: "WireGuard server type"},
+	{path: "roles.forge.type", prompt: "Forgejo server type"},
+	{path: "network.cidr", prompt: "Network range", derive: deriveSubnet, checks: append([]string{"network.subnetCidr"}, derivedAddresses...)},
+	{path: "network.subnetCidr", prompt: "Server subnet", derive: deriveAddresses, checks: derivedAddresses},
+}
+
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path of the configuration file to write")
+	defaults := fs.Bool("defaults", false, "Write the defaults without asking any questions")
+	force := fs.Bool("force", false, "Overwrite an existing configuration file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !*force {
+		if _, err := os.Stat(*configPath); err == nil {
+			return fmt.Errorf("%s already exists; use --force to overwrite it", *configPath)
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	if !*defaults {
+		if err := askInitQuestions(cfg, bufio.NewReader(os.Stdin), os.Stdout); err != nil {
+			return err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# EndNET configuration written by endnetctl init on %s.\n", time.Now().Format("2006-01-02"))
+	fmt.Fprintln(&buf, "# Values not set here fall back to the built-in defaults; ENDNET_* variables override them.")
+	// Empty credentials and retry overrides are left out rather than written
+	// as zero values, so the header above holds for them.
+	if err := config.Encode(&buf, cfg, config.EncodeOptions{Comments: true, OmitZero: true}); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(*configPath, buf.Bytes()); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %s.\n", *configPath)
+	return nil
+}
+
+// askInitQuestions prompts for every answer, offering the current value as
+// default, until each answer passes validation.
+func askInitQuestions(cfg *config.Config, in *bufio.Reader, out io.Writer) error {
+	for _, q := range initQuestions {
+		for {
+			current, err := cfg.Value(q.path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%s [%s]: ", q.prompt, current)
+
+			line, err := in.ReadString('\n')
+			if errors.Is(err, io.EOF) && line == "" {
+				return errors.New("input ended before all questions were answered")
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			answer := strings.TrimSpace(line)
+			if answer == "" {
+				answer = current
+			}
+
+			if problems := checkAnswer(cfg, q, answer); len(problems) > 0 {
+				for _, p := range problems {
+					fmt.Fprintf(out, "  %s\n", p.Message)
+				}
+				continue
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// checkAnswer applies answer to cfg and returns the validation problems of
+// the question's key. The previous values are restored when there are any.
+func checkAnswer(cfg *config.Config, q initQuestion, answer string) []config.FieldError {
+	previous := *cfg
+	if err := cfg.Set(q.path, answer); err != nil {
+		return []config.FieldError{{Path: q.path, Message: err.Error()}}
+	}
+	if q.derive != nil {
+		q.derive(cfg)
+	}
+
+	var problems []config.FieldError
+	var verr *config.ValidationError
+	if err := cfg.Validate(); errors.As(err, &verr) {
+		for _, p := range verr.Problems {
+			if p.Path == q.path || slices.Contains(q.checks, p.Path) {
+				problems = append(problems, p)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		*cfg = previous
+	}
+	return problems
+}
+
+// deriveNames names the network and servers after the project.
+func deriveNames(cfg *config.Config) {
+	cfg.Network.Name = cfg.Project + "-internal"
+	cfg.Roles.Edge.Name = cfg.Project + "-edge-1"
+	cfg.Roles.WG.Name = cfg.Project + "-wg-1"
+	cfg.Roles.Forge.Name = cfg.Project + "-git-1"
+}
+
+// deriveSubnet uses the first /24 of the network as server subnet.
+func deriveSubnet(cfg *config.Config) {
+	network, err := netip.ParsePrefix(cfg.Network.CIDR)
+	if err != nil {
+		return
+	}
+	bits := max(network.Bits(), 24)
+	cfg.Network.SubnetCIDR = netip.PrefixFrom(network.Masked().Addr(), bits).String()
+	deriveAddresses(cfg)
+}
+
+// deriveAddresses keeps the default host offsets of the role addresses within
+// the new subnet and routes through the edge server.
+func deriveAddresses(cfg *config.Config) {
+	subnet, err := netip.ParsePrefix(cfg.Network.SubnetCIDR)
+	if err != nil {
+		return
+	}
+	defaults := config.DefaultConfig()
+	base := netip.MustParsePrefix(defaults.Network.SubnetCIDR).Addr().As4()
+	start := subnet.Masked().Addr()
+	if !start.Is4() {
+		return
+	}
+	from := start.As4()
+
+	move := func(ip string) string {
+		addr := netip.MustParseAddr(ip).As4()
+		for i := range addr {
+			addr[i] = from[i] | (addr[i] - base[i])
+		}
+		return netip.AddrFrom4(addr).String()
+	}
+	cfg.Roles.Edge.PrivateIP = move(defaults.Roles.Edge.PrivateIP)
+	cfg.Roles.WG.PrivateIP = move(defaults.Roles.WG.PrivateIP)
+	cfg.Roles.Forge.PrivateIP = move(defaults.Roles.Forge.PrivateIP)
+	cfg.Network.GatewayIP = cfg.Roles.Edge.PrivateIP
+}
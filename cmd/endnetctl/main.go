@@ -1,84 +1,343 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"endnet-cli/internal/config"
-	"endnet-cli/internal/state"
+	"endnet-cli/internal/sshkey"
 	"endnet-cli/internal/tasks"
 	"endnet-cli/internal/tui"
 	"endnet-cli/pkg/models"
 	"endnet-cli/pkg/util"
 )
 
+// subcommands maps the first command-line argument to its implementation.
+// Without a subcommand, or with "apply", endnetctl plans and applies the
+// configuration.
+var subcommands = map[string]func(args []string) error{
+	"config": runConfig,
+	"drift":  runDrift,
+	"init":   runInit,
+	"plan":   runPlan,
+	"secret": runSecret,
+	"serve":  runServe,
+}
+
+// exitStatus is returned by subcommands to exit with a status other than 0 or
+// 1 without printing an error, e.g. 2 for usage errors.
+type exitStatus int
+
+func (s exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(s))
+}
+
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if command, ok := subcommands[args[0]]; ok {
+			runSubcommand(args[0], command, args[1:])
+			return
+		}
+		if args[0] == "apply" {
+			args = args[1:]
+		}
+	}
+	runSubcommand("apply", runApply, args)
+}
+
+// runApply plans and applies the configuration. Failures are logged where
+// they happen and returned as exit status 1, so deferred cleanup such as
+// closing the journal runs before the process exits.
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("endnetctl", flag.ContinueOnError)
 	var configPath string
+	var environment string
 	var useTUI bool
 	var planOnly bool
+	var dryRun bool
+	var strict bool
+	var parallelism int
+	var rollbackOnFailure bool
+	var journalPath string
+	var resume bool
+	var timeout time.Duration
+	var reportPath string
+	var reportFormatName string
+	var logLevel string
+	var logFormat string
 
-	flag.StringVar(&configPath, "config", "config.yaml", "Path to the EndNET configuration file")
-	flag.BoolVar(&useTUI, "tui", false, "Launch the interactive terminal UI")
-	flag.BoolVar(&planOnly, "plan", false, "Generate an execution plan without applying it")
-	flag.Parse()
+	fs.StringVar(&configPath, "config", "config.yaml", "Path to the EndNET configuration file")
+	fs.StringVar(&environment, "env", os.Getenv(config.EnvEnvironment), "Environment profile whose overlay (e.g. config.staging.yaml) is merged over the configuration file")
+	fs.BoolVar(&useTUI, "tui", false, "Launch the interactive terminal UI")
+	fs.BoolVar(&planOnly, "plan", false, "Generate an execution plan without applying it")
+	fs.BoolVar(&dryRun, "dry-run", false, "Log the operations instead of calling the provider APIs")
+	fs.BoolVar(&strict, "strict", false, "Reject configuration keys that are not part of the configuration format")
+	fs.IntVar(&parallelism, "parallelism", tasks.DefaultParallelism, "Maximum number of operations applied at the same time")
+	fs.BoolVar(&rollbackOnFailure, "rollback-on-failure", false, "Undo the applied operations in reverse order when an operation fails")
+	fs.StringVar(&journalPath, "journal", "", "Execution journal file (default .endnet/journal.jsonl next to the configuration file)")
+	fs.BoolVar(&resume, "resume", false, "Resume the interrupted run recorded in the journal")
+	fs.DurationVar(&timeout, "timeout", 0, "Abort the run after this duration, e.g. 10m; 0 means no limit")
+	fs.StringVar(&reportPath, "report", "", "Write an execution report to this file")
+	fs.StringVar(&reportFormatName, "report-format", "", "Report format: json or junit (default junit for .xml files, json otherwise)")
+	fs.StringVar(&logLevel, "log-level", "info", "Minimum log level: debug, info, warn or error")
+	fs.StringVar(&logFormat, "log-format", "text", "Log output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return exitStatus(2)
+	}
+	if resume && (planOnly || useTUI) {
+		return usageError("--resume cannot be combined with --plan or --tui")
+	}
+	if reportPath != "" && (planOnly || useTUI) {
+		return usageError("--report cannot be combined with --plan or --tui")
+	}
+	if reportPath != "" {
+		format, err := reportFormat(reportPath, reportFormatName)
+		if err != nil {
+			return usageError(err.Error())
+		}
+		reportFormatName = format
+	}
+	if journalPath == "" {
+		journalPath = filepath.Join(filepath.Dir(configPath), ".endnet", "journal.jsonl")
+	}
 
-	loader := config.NewLoader()
-	cfg, err := loader.Load(configPath)
+	// Logs go to stderr so stdout only carries command output. While the TUI
+	// runs, they are shown in its log pane instead.
+	logOutput := tui.NewLogBuffer(os.Stderr)
+	logger, err := util.NewLoggerWithOptions(util.LogOptions{Level: logLevel, Format: logFormat, Output: logOutput})
 	if err != nil {
-		log.Fatalf("failed to load configuration: %v", err)
+		return usageError(fmt.Sprintf("invalid logging flags: %v", err))
 	}
 
-	spec := cfg.ToSpec()
+	ctx, cancel := runContext(logger, timeout)
+	defer cancel()
 
-	retriever := state.NewRetriever()
-	currentState, err := retriever.Current(spec)
+	loader := config.NewFileLoader()
+	loader.Strict = strict
+	loader.Logger = logger
+	cfg, err := loader.LoadEnvironment(configPath, environment)
 	if err != nil {
-		log.Fatalf("failed to obtain current state: %v", err)
+		return failed(logger, "failed to load configuration", err)
+	}
+	if err := cfg.ResolveSecrets(); err != nil {
+		return failed(logger, "failed to resolve secrets", err)
+	}
+	logger.Debug("configuration loaded", "source", cfg.Source, "environment", cfg.Environment, "project", cfg.Project)
+	clients, err := newProviders(cfg, nil)
+	if err != nil {
+		return failed(logger, "failed to configure provider clients", err)
 	}
 
+	spec := cfg.ToSpec()
+	if err := sshkey.Populate(&spec.SSHKey); err != nil {
+		return failed(logger, "failed to read ssh key", err)
+	}
+
+	retriever := clients.retriever(logger)
 	planner := tasks.NewPlanner()
-	plan, err := planner.Plan(spec, currentState)
-	if err != nil {
-		log.Fatalf("failed to generate plan: %v", err)
+	var currentState *models.RemoteState
+	var plan *models.Plan
+	var resumeState *tasks.ResumeState
+
+	if resume {
+		// The interrupted run's plan is continued as is; planning again
+		// could schedule operations whose actions are still running.
+		resumeState, err = tasks.ReadJournal(journalPath)
+		if err != nil {
+			return failed(logger, "cannot resume", err)
+		}
+		plan = resumeState.Plan
+		logger.Info("resuming interrupted run", "journal", journalPath, "finished", len(resumeState.Finished), "in_flight", len(resumeState.InFlight))
+	} else {
+		currentState, err = retriever.Current(ctx, spec)
+		if err != nil {
+			return failed(logger, "failed to obtain current state", err)
+		}
+
+		plan, err = planner.Plan(ctx, spec, currentState)
+		if err != nil {
+			return failed(logger, "failed to generate plan", err)
+		}
+		logger.Debug("plan generated", "operations", len(plan.Operations()))
+	}
+
+	var journal *tasks.Journal
+	if !planOnly {
+		journal, err = tasks.OpenJournal(journalPath)
+		if err != nil {
+			return failed(logger, "failed to open execution journal", err)
+		}
+		defer journal.Close()
+	}
+
+	opts := tasks.ExecutorOptions{
+		Poller:            clients.poller(),
+		Parallelism:       parallelism,
+		Retry:             cfg.RetryPolicies(),
+		Hooks:             cfg.OperationHooks(),
+		RollbackOnFailure: rollbackOnFailure,
+		Journal:           journal,
+		Resume:            resumeState,
 	}
+	if !dryRun {
+		opts.Applier = clients.applier(logger, spec)
+	}
+	executor := tasks.NewExecutorWithOptions(logger, opts)
 
 	if useTUI {
-		runner := tui.NewRunner()
-		if err := runner.Run(cfg, spec, currentState, plan); err != nil {
-			log.Fatalf("tui exited with error: %v", err)
+		runner := tui.NewRunner(retriever, planner, executor, logOutput)
+		if err := runner.Run(ctx, cfg, spec, currentState, plan); err != nil {
+			return failed(logger, "tui exited with error", err)
 		}
-		return
+		return nil
 	}
 
+	// Everything printed to stdout passes through redaction as well, in case
+	// a resolved secret ends up in operation details or errors.
+	stdout := util.NewRedactingWriter(os.Stdout)
+
 	if planOnly {
-		fmt.Println("Planned actions:")
-		for _, op := range flattenPlan(plan) {
-			fmt.Printf("- [%s] %s -> %s\n", op.Type, op.Target, op.Details)
+		fmt.Fprintln(stdout, "Planned actions:")
+		for _, op := range plan.Operations() {
+			fmt.Fprintf(stdout, "- [%s] %s -> %s\n", op.Type, op.Target, op.Details)
 		}
-		return
+		return nil
 	}
 
-	executor := tasks.NewExecutor(util.NewLogger())
-	result, err := executor.Execute(plan)
+	executor.Observe(tasks.NewProgressWriter(stdout))
+	result, err := executor.Execute(ctx, plan)
+	if result != nil {
+		printRetries(stdout, result.Retries)
+		printRollback(stdout, result.Rollback)
+	}
+	if result != nil && reportPath != "" {
+		report := models.NewExecutionReport(result, err)
+		report.Project, report.Environment = cfg.Project, cfg.Environment
+		if rerr := writeReport(reportPath, reportFormatName, report); rerr != nil {
+			logger.Error("failed to write execution report", "path", reportPath, "error", rerr)
+		} else {
+			logger.Info("execution report written", "path", reportPath, "format", reportFormatName)
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		fmt.Fprintln(stdout, "Execution interrupted; run endnetctl --resume to continue it.")
+		return failed(logger, "plan execution interrupted", err)
+	}
 	if err != nil {
-		log.Fatalf("plan execution failed: %v", err)
+		return failed(logger, "plan execution failed", err)
 	}
 
 	if result.ChangesApplied {
-		fmt.Println("Plan executed successfully.")
+		fmt.Fprintln(stdout, "Plan executed successfully.")
 	} else {
-		fmt.Println("Plan execution completed without changes.")
+		fmt.Fprintln(stdout, "Plan execution completed without changes.")
 	}
+	return nil
 }
 
-func flattenPlan(plan *models.Plan) []models.Operation {
-	if plan == nil {
-		return nil
+// runContext returns the context of a run. It is cancelled by SIGINT or
+// SIGTERM, which lets running operations abort cleanly, and after timeout
+// unless it is 0. A second signal terminates the process at once.
+func runContext(logger util.Logger, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// stop cancels ctx as well, with context.Canceled as the cause.
+		if cause := context.Cause(ctx); cause != context.Canceled {
+			logger.Warn("aborting running operations; signal again to exit immediately", "cause", cause)
+		}
+		// Restore the default behaviour for the next signal.
+		stop()
+	}()
+
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	timed, cancel := context.WithTimeout(ctx, timeout)
+	return timed, func() {
+		cancel()
+		stop()
+	}
+}
+
+// printRetries summarises the retried provider calls per target.
+func printRetries(w io.Writer, retries []models.Retry) {
+	if len(retries) == 0 {
+		return
 	}
-	var ops []models.Operation
-	for _, group := range [][]models.Operation{plan.NetworkOps, plan.ServerOps, plan.FirewallOps, plan.DNSOps} {
-		ops = append(ops, group...)
+	var targets []string
+	counts := make(map[string]int)
+	for _, r := range retries {
+		if counts[r.Target] == 0 {
+			targets = append(targets, r.Target)
+		}
+		counts[r.Target]++
+	}
+	fmt.Fprintf(w, "Retried %d failed provider calls:\n", len(retries))
+	for _, target := range targets {
+		fmt.Fprintf(w, "- %s: %d\n", target, counts[target])
+	}
+}
+
+// printRollback lists what a rollback undid and what it left in place.
+func printRollback(w io.Writer, report *models.RollbackReport) {
+	if report == nil {
+		return
+	}
+	fmt.Fprintf(w, "Rolled back %d operations:\n", len(report.RolledBack))
+	for _, op := range report.RolledBack {
+		fmt.Fprintf(w, "- [%s] %s\n", op.Type, op.Target)
+	}
+	if len(report.Failed) > 0 {
+		fmt.Fprintf(w, "Could not roll back %d operations:\n", len(report.Failed))
+		for _, f := range report.Failed {
+			fmt.Fprintf(w, "- [%s] %s: %s\n", f.Operation.Type, f.Operation.Target, f.Error)
+		}
 	}
-	return ops
+	if len(report.Irreversible) > 0 {
+		fmt.Fprintf(w, "Left in place, no compensating operation known for %d operations:\n", len(report.Irreversible))
+		for _, op := range report.Irreversible {
+			fmt.Fprintf(w, "- [%s] %s\n", op.Type, op.Target)
+		}
+	}
+}
+
+func runSubcommand(name string, command func(args []string) error, args []string) {
+	err := command(args)
+	var status exitStatus
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+	case errors.As(err, &status):
+		os.Exit(int(status))
+	default:
+		fmt.Fprintf(os.Stderr, "endnetctl %s: %s\n", name, util.Redact(err.Error()))
+		os.Exit(1)
+	}
+}
+
+// failed logs a failure of the apply command and returns exit status 1.
+func failed(logger util.Logger, msg string, err error) error {
+	logger.Error(msg, "error", err)
+	return exitStatus(1)
+}
+
+// usageError prints a usage problem of the apply command and returns exit
+// status 2.
+func usageError(msg string) error {
+	fmt.Fprintln(os.Stderr, msg)
+	return exitStatus(2)
 }
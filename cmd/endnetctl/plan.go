@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/internal/sshkey"
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+	"endnet-cli/pkg/util"
+)
+
+// planWriters render a plan for endnetctl plan --output.
+var planWriters = map[string]func(w io.Writer, doc models.PlanDocument) error{
+	"json":     writePlanJSON,
+	"table":    writePlanTable,
+	"markdown": writePlanMarkdown,
+}
+
+// exitChangesPending is the status of endnetctl plan --detailed-exitcode when
+// the plan contains changes. Without changes it exits with 0, on errors with 1.
+const exitChangesPending = 2
+
+func runPlan(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to the EndNET configuration file")
+	environment := fs.String("env", os.Getenv(config.EnvEnvironment), "Environment profile whose overlay is merged over the configuration file")
+	strict := fs.Bool("strict", false, "Reject keys that are not part of the configuration format")
+	output := fs.String("output", "table", "Output format: json, table or markdown")
+	detailed := fs.Bool("detailed-exitcode", false, "Exit with 0 when there are no changes, 2 when changes are pending and 1 on errors")
+	timeout := fs.Duration("timeout", 0, "Abort planning after this duration; 0 means no limit")
+	logLevel := fs.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	logFormat := fs.String("log-format", "text", "Log output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	write, ok := planWriters[*output]
+	if !ok {
+		return fmt.Errorf("unknown output format %q; use json, table or markdown", *output)
+	}
+
+	logger, err := util.NewLoggerWithOptions(util.LogOptions{Level: *logLevel, Format: *logFormat, Output: os.Stderr})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := runContext(logger, *timeout)
+	defer cancel()
+
+	cfg, plan, err := loadPlan(ctx, logger, *configPath, *environment, *strict, nil)
+	if err != nil {
+		return err
+	}
+
+	doc := newPlanDocument(cfg, plan)
+	if err := write(util.NewRedactingWriter(os.Stdout), doc); err != nil {
+		return err
+	}
+	if *detailed && doc.Summary.Changes > 0 {
+		return exitStatus(exitChangesPending)
+	}
+	return nil
+}
+
+// loadPlan loads the configuration for an environment, retrieves the current
+// state and plans the changes, without prompting. observe may be nil.
+func loadPlan(ctx context.Context, logger util.Logger, path, environment string, strict bool, observe callObserver) (*config.Config, *models.Plan, error) {
+	loader := config.NewFileLoader()
+	loader.Strict = strict
+	loader.Logger = logger
+	cfg, err := loader.LoadEnvironment(path, environment)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.ResolveSecrets(); err != nil {
+		return nil, nil, err
+	}
+	clients, err := newProviders(cfg, observe)
+	if err != nil {
+		return nil, nil, fmt.Errorf("configure provider clients: %w", err)
+	}
+	spec := cfg.ToSpec()
+	if err := sshkey.Populate(&spec.SSHKey); err != nil {
+		return nil, nil, fmt.Errorf("read ssh key: %w", err)
+	}
+
+	current, err := clients.retriever(logger).Current(ctx, spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("obtain current state: %w", err)
+	}
+	plan, err := tasks.NewPlanner().Plan(ctx, spec, current)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate plan: %w", err)
+	}
+	return cfg, plan, nil
+}
+
+func newPlanDocument(cfg *config.Config, plan *models.Plan) models.PlanDocument {
+	ops := plan.Operations()
+	if ops == nil {
+		ops = []models.Operation{}
+	}
+	return models.PlanDocument{
+		FormatVersion: models.PlanFormatVersion,
+		Project:       cfg.Project,
+		Environment:   cfg.Environment,
+		GeneratedAt:   time.Now().UTC(),
+		Summary:       plan.Summary(),
+		Operations:    ops,
+	}
+}
+
+func writePlanJSON(w io.Writer, doc models.PlanDocument) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func writePlanTable(w io.Writer, doc models.PlanDocument) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tTARGET\tDETAILS")
+	for _, op := range doc.Operations {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", op.Type, op.Target, op.Details)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%s\n", planSummaryLine(doc.Summary))
+	return err
+}
+
+func writePlanMarkdown(w io.Writer, doc models.PlanDocument) error {
+	title := "Plan for " + doc.Project
+	if doc.Environment != "" {
+		title += " (" + doc.Environment + ")"
+	}
+	fmt.Fprintf(w, "### %s\n\n%s\n\n", title, planSummaryLine(doc.Summary))
+	fmt.Fprintln(w, "| Type | Target | Details |")
+	fmt.Fprintln(w, "| --- | --- | --- |")
+	for _, op := range doc.Operations {
+		fmt.Fprintf(w, "| %s | `%s` | %s |\n", op.Type, op.Target, markdownCell(op.Details))
+	}
+	return nil
+}
+
+// planSummaryLine renders the summary as "3 changes: 2 create, 1 update; 2
+// unchanged", listing the types in alphabetical order.
+func planSummaryLine(s models.PlanSummary) string {
+	if s.Changes == 0 {
+		return fmt.Sprintf("No changes; %d unchanged.", s.Total)
+	}
+
+	var counts []string
+	for _, typ := range slices.Sorted(maps.Keys(s.ByType)) {
+		if typ == "noop" {
+			continue
+		}
+		counts = append(counts, fmt.Sprintf("%d %s", s.ByType[typ], typ))
+	}
+	noun := "changes"
+	if s.Changes == 1 {
+		noun = "change"
+	}
+	return fmt.Sprintf("%d %s: %s; %d unchanged.", s.Changes, noun, strings.Join(counts, ", "), s.Total-s.Changes)
+}
+
+// markdownCell escapes text for a Markdown table cell.
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(text, "|", `\|`)
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
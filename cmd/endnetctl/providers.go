@@ -0,0 +1,86 @@
+package main
+
+import (
+	"time"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/internal/hetzner"
+	"endnet-cli/internal/ipv64"
+	"endnet-cli/internal/state"
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+	"endnet-cli/pkg/util"
+)
+
+// providers holds the API clients of a configuration. A client is nil when
+// its credentials are not configured.
+type providers struct {
+	hetzner hetzner.Client
+	ipv64   ipv64.Client
+}
+
+// callObserver is told about every provider API call.
+type callObserver func(provider, endpoint string, elapsed time.Duration, err error)
+
+// newProviders returns clients authenticated with the configured
+// credentials, which must have been resolved by cfg.ResolveSecrets. observe
+// may be nil.
+func newProviders(cfg *config.Config, observe callObserver) (providers, error) {
+	var p providers
+	if cfg.Hetzner.APIToken.IsSet() {
+		token, err := cfg.Hetzner.APIToken.Reveal()
+		if err != nil {
+			return providers{}, err
+		}
+		client := hetzner.NewClient()
+		if err := client.Authenticate(token); err != nil {
+			return providers{}, err
+		}
+		if observe != nil {
+			client.Observe = func(endpoint string, elapsed time.Duration, err error) {
+				observe("hetzner", endpoint, elapsed, err)
+			}
+		}
+		p.hetzner = client
+	}
+	if cfg.IPv64.APIKey.IsSet() {
+		key, err := cfg.IPv64.APIKey.Reveal()
+		if err != nil {
+			return providers{}, err
+		}
+		client := ipv64.NewClient()
+		if err := client.Authenticate(key); err != nil {
+			return providers{}, err
+		}
+		if observe != nil {
+			client.Observe = func(endpoint string, elapsed time.Duration, err error) {
+				observe("ipv64", endpoint, elapsed, err)
+			}
+		}
+		if cfg.IPv64.DynDNSToken.IsSet() {
+			if client.DynDNSToken, err = cfg.IPv64.DynDNSToken.Reveal(); err != nil {
+				return providers{}, err
+			}
+		}
+		p.ipv64 = client
+	}
+	return p, nil
+}
+
+// retriever returns a retriever reading the state from the providers.
+func (p providers) retriever(logger util.Logger) state.Retriever {
+	return state.NewProviderRetriever(logger, p.hetzner, p.ipv64)
+}
+
+// applier returns an applier making the provider calls of operations.
+func (p providers) applier(logger util.Logger, spec models.EndnetSpec) tasks.Applier {
+	return tasks.NewProviderApplier(logger, p.hetzner, p.ipv64, spec)
+}
+
+// poller returns the poller of Hetzner actions, nil without Hetzner client.
+func (p providers) poller() tasks.ActionPoller {
+	if p.hetzner == nil {
+		return nil
+	}
+	return p.hetzner
+}
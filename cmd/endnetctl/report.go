@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"endnet-cli/pkg/models"
+	"endnet-cli/pkg/util"
+)
+
+// reportWriters render an execution report for --report-format.
+var reportWriters = map[string]func(w io.Writer, report models.ExecutionReport) error{
+	"json":  writeReportJSON,
+	"junit": writeReportJUnit,
+}
+
+// reportFormat returns the format of the report written to path: format when
+// set, otherwise junit for .xml files and json for everything else.
+func reportFormat(path, format string) (string, error) {
+	if format == "" {
+		if strings.EqualFold(filepath.Ext(path), ".xml") {
+			return "junit", nil
+		}
+		return "json", nil
+	}
+	if _, ok := reportWriters[format]; !ok {
+		return "", fmt.Errorf("unknown report format %q; use json or junit", format)
+	}
+	return format, nil
+}
+
+// writeReport writes the report to path, creating its directory. Secrets are
+// redacted like on stdout.
+func writeReport(path, format string, report models.ExecutionReport) error {
+	var buf bytes.Buffer
+	if err := reportWriters[format](&buf, report); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(util.Redact(buf.String())))
+}
+
+func writeReportJSON(w io.Writer, report models.ExecutionReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// JUnit XML as understood by CI systems such as Forgejo Actions: one test
+// suite for the apply with a test case per operation, and one for the
+// rollback if there was any.
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     float64      `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// add appends a test case and updates the suite's counts.
+func (s *junitSuite) add(c junitCase) {
+	s.Tests++
+	switch {
+	case c.Failure != nil:
+		s.Failures++
+	case c.Error != nil:
+		s.Errors++
+	case c.Skipped != nil:
+		s.Skipped++
+	}
+	s.Cases = append(s.Cases, c)
+}
+
+func writeReportJUnit(w io.Writer, report models.ExecutionReport) error {
+	apply := junitSuite{
+		Name:      "apply " + report.Project,
+		Time:      report.Duration,
+		Timestamp: report.StartedAt.UTC().Format("2006-01-02T15:04:05"),
+	}
+	for _, op := range report.Operations {
+		c := junitCase{
+			Name:      op.Type + " " + op.Target,
+			Classname: "endnet." + op.Kind(),
+			Time:      op.Duration,
+			SystemOut: op.Details,
+		}
+		switch op.Status {
+		case models.OperationFailed:
+			c.Failure = &junitProblem{Message: firstLine(op.Error), Text: op.Error}
+		case models.OperationInterrupted:
+			c.Error = &junitProblem{Message: "interrupted", Text: op.Error}
+		case models.OperationSkipped:
+			c.Skipped = &junitSkipped{Message: "applied by the resumed run"}
+		case models.OperationNotRun:
+			c.Skipped = &junitSkipped{Message: "not run because the execution stopped first"}
+		}
+		apply.add(c)
+	}
+	suites := []junitSuite{apply}
+
+	if rb := report.Rollback; rb != nil {
+		rollback := junitSuite{Name: "rollback " + report.Project}
+		for _, op := range rb.RolledBack {
+			rollback.add(junitCase{Name: op.Type + " " + op.Target, Classname: "endnet." + op.Kind(), SystemOut: op.Details})
+		}
+		for _, f := range rb.Failed {
+			rollback.add(junitCase{
+				Name:      f.Operation.Type + " " + f.Operation.Target,
+				Classname: "endnet." + f.Operation.Kind(),
+				Failure:   &junitProblem{Message: firstLine(f.Error), Text: f.Error},
+			})
+		}
+		for _, op := range rb.Irreversible {
+			rollback.add(junitCase{
+				Name:      op.Type + " " + op.Target,
+				Classname: "endnet." + op.Kind(),
+				Failure:   &junitProblem{Message: "no compensating operation known; left in place"},
+			})
+		}
+		suites = append(suites, rollback)
+	}
+
+	doc := junitSuites{Name: "endnetctl", Time: report.Duration, Suites: suites}
+	for _, s := range suites {
+		doc.Tests += s.Tests
+		doc.Failures += s.Failures
+		doc.Errors += s.Errors
+		doc.Skipped += s.Skipped
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
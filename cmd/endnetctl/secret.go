@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"filippo.io/age"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/internal/crypt"
+)
+
+const secretUsage = `usage: endnetctl secret <command> [flags]
+
+Commands:
+  encrypt [value]   encrypt a value (read from stdin when omitted) and print it as enc:...
+  decrypt [value]   decrypt an enc:... value (read from stdin when omitted)
+  rotate-key        re-encrypt every enc:... value in the configuration file and its overlays
+
+Keys are read from ` + crypt.EnvIdentity + ` (age identity file or OpenSSH private key),
+` + crypt.EnvPassphrase + ` and ` + crypt.EnvRecipients + `.`
+
+// encryptedValue matches a YAML line whose value is an encrypted secret.
+var encryptedValue = regexp.MustCompile(`^(\s*[^#\s][^:]*:\s*["']?)(` + regexp.QuoteMeta(crypt.Prefix) + `[A-Za-z0-9+/=]+)(["']?\s*)$`)
+
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runSecret(args []string) error {
+	if len(args) == 0 {
+		return errors.New(secretUsage)
+	}
+
+	switch args[0] {
+	case "encrypt":
+		return runSecretEncrypt(args[1:])
+	case "decrypt":
+		return runSecretDecrypt(args[1:])
+	case "rotate-key":
+		return runSecretRotateKey(args[1:])
+	default:
+		return fmt.Errorf("unknown secret command %q\n%s", args[0], secretUsage)
+	}
+}
+
+func runSecretEncrypt(args []string) error {
+	fs := flag.NewFlagSet("secret encrypt", flag.ContinueOnError)
+	var recipients stringList
+	fs.Var(&recipients, "recipient", "Recipient to encrypt to: age1..., an SSH public key or a file of recipients (repeatable)")
+	passphraseEnv := fs.String("passphrase-env", "", "Encrypt with the passphrase stored in this environment variable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	to, err := encryptionRecipients(recipients, *passphraseEnv)
+	if err != nil {
+		return err
+	}
+	value, err := inputValue(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := crypt.Encrypt(value, to...)
+	if err != nil {
+		return err
+	}
+	fmt.Println(encrypted)
+	return nil
+}
+
+func runSecretDecrypt(args []string) error {
+	fs := flag.NewFlagSet("secret decrypt", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keys, err := crypt.KeysFromEnv()
+	if err != nil {
+		return err
+	}
+	value, err := inputValue(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := crypt.Decrypt(value, keys.Identities...)
+	if err != nil {
+		return err
+	}
+	fmt.Println(plaintext)
+	return nil
+}
+
+func runSecretRotateKey(args []string) error {
+	fs := flag.NewFlagSet("secret rotate-key", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to the EndNET configuration file")
+	var recipients stringList
+	fs.Var(&recipients, "recipient", "New recipient: age1..., an SSH public key or a file of recipients (repeatable)")
+	passphraseEnv := fs.String("passphrase-env", "", "Re-encrypt with the passphrase stored in this environment variable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(recipients) == 0 && *passphraseEnv == "" {
+		return errors.New("rotate-key needs the new key via --recipient or --passphrase-env")
+	}
+
+	keys, err := crypt.KeysFromEnv()
+	if err != nil {
+		return err
+	}
+	to, err := encryptionRecipients(recipients, *passphraseEnv)
+	if err != nil {
+		return err
+	}
+
+	// Overlays are rotated along with the base file, as they are decrypted
+	// with the same keys. Every file is re-encrypted before any is written,
+	// so a value that cannot be decrypted leaves all files untouched.
+	overlays, err := filepath.Glob(config.OverlayPath(*configPath, "*"))
+	if err != nil {
+		return err
+	}
+	paths := append([]string{*configPath}, overlays...)
+	contents := make([][]byte, len(paths))
+	counts := make([]int, len(paths))
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contents[i], counts[i], err = rotateValues(path, data, keys.Identities, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, path := range paths {
+		if counts[i] > 0 {
+			if err := writeFileAtomic(path, contents[i]); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Re-encrypted %d values in %s.\n", counts[i], path)
+	}
+	return nil
+}
+
+// rotateValues decrypts every encrypted value in the configuration file data
+// and encrypts it again to recipients. It returns the new file content and the
+// number of values re-encrypted.
+func rotateValues(path string, data []byte, identities []age.Identity, recipients []age.Recipient) ([]byte, int, error) {
+	lines := strings.SplitAfter(string(data), "\n")
+	rotated := 0
+	for i, line := range lines {
+		body := strings.TrimRight(line, "\r\n")
+		m := encryptedValue.FindStringSubmatch(body)
+		if m == nil {
+			continue
+		}
+		plaintext, err := crypt.Decrypt(m[2], identities...)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		encrypted, err := crypt.Encrypt(plaintext, recipients...)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		lines[i] = m[1] + encrypted + m[3] + line[len(body):]
+		rotated++
+	}
+	return []byte(strings.Join(lines, "")), rotated, nil
+}
+
+// encryptionRecipients resolves the recipients from the command line, falling
+// back to the ENDNET_SECRET_* environment variables.
+func encryptionRecipients(values []string, passphraseEnv string) ([]age.Recipient, error) {
+	if passphraseEnv != "" {
+		if len(values) > 0 {
+			return nil, errors.New("--passphrase-env cannot be combined with --recipient")
+		}
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", passphraseEnv)
+		}
+		keys, err := crypt.PassphraseKeys(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return keys.Recipients, nil
+	}
+
+	if len(values) > 0 {
+		var recipients []age.Recipient
+		for _, value := range values {
+			parsed, err := crypt.ParseRecipient(value)
+			if err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, parsed...)
+		}
+		return recipients, nil
+	}
+
+	keys, err := crypt.KeysFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys.Recipients) == 0 {
+		return nil, fmt.Errorf("no recipients; pass --recipient or set %s, %s or %s", crypt.EnvRecipients, crypt.EnvIdentity, crypt.EnvPassphrase)
+	}
+	return keys.Recipients, nil
+}
+
+// inputValue returns the single positional argument or, without one, stdin
+// with the trailing newline removed.
+func inputValue(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		data, err := io.ReadAll(bufio.NewReader(os.Stdin))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case 1:
+		return args[0], nil
+	default:
+		return "", errors.New("expected at most one value")
+	}
+}
+
+// writeFileAtomic replaces path with data, keeping the file mode.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/internal/daemon"
+	"endnet-cli/internal/sshkey"
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+	"endnet-cli/pkg/util"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to the EndNET configuration file, re-read before every run")
+	environment := fs.String("env", os.Getenv(config.EnvEnvironment), "Environment profile whose overlay is merged over the configuration file")
+	strict := fs.Bool("strict", false, "Reject keys that are not part of the configuration format")
+	interval := fs.Duration("reconcile-interval", 10*time.Minute, "Time between reconcile runs")
+	jitter := fs.Float64("jitter", 0.1, "Random variation of the interval as a fraction, e.g. 0.1 for ±10%")
+	var autoApply stringList
+	fs.Var(&autoApply, "auto-apply", "Operations applied without approval as kind:type, e.g. dns:update or firewall:* (repeatable)")
+	listen := fs.String("listen", "127.0.0.1:8470", "Address of the HTTP API for status and approvals; empty disables it")
+	queuePath := fs.String("approvals", "", "Approval queue file (default .endnet/approvals.json next to the configuration file)")
+	journalPath := fs.String("journal", "", "Execution journal file (default .endnet/serve-journal.jsonl next to the configuration file)")
+	parallelism := fs.Int("parallelism", tasks.DefaultParallelism, "Maximum number of operations applied at the same time")
+	runTimeout := fs.Duration("run-timeout", 30*time.Minute, "Abort a reconcile run after this duration; 0 means no limit")
+	shutdownTimeout := fs.Duration("shutdown-timeout", time.Minute, "How long a running reconcile may continue after SIGINT or SIGTERM")
+	logLevel := fs.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	logFormat := fs.String("log-format", "text", "Log output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return errors.New("--reconcile-interval must be positive")
+	}
+	if *jitter < 0 || *jitter >= 1 {
+		return errors.New("--jitter must be at least 0 and less than 1")
+	}
+	var rules []daemon.Rule
+	for _, s := range autoApply {
+		rule, err := daemon.ParseRule(s)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	stateDir := filepath.Join(filepath.Dir(*configPath), ".endnet")
+	if *queuePath == "" {
+		*queuePath = filepath.Join(stateDir, "approvals.json")
+	}
+	if *journalPath == "" {
+		// Not the journal of endnetctl apply, so --resume never continues a
+		// daemon run and both can write at the same time.
+		*journalPath = filepath.Join(stateDir, "serve-journal.jsonl")
+	}
+
+	logger, err := util.NewLoggerWithOptions(util.LogOptions{Level: *logLevel, Format: *logFormat, Output: os.Stderr})
+	if err != nil {
+		return err
+	}
+	queue, err := daemon.OpenApprovalQueue(*queuePath)
+	if err != nil {
+		return err
+	}
+	journal, err := tasks.OpenJournal(*journalPath)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	// The provider calls of every run are recorded in the reconciler's
+	// metrics.
+	var reconciler *daemon.Reconciler
+	load := func(ctx context.Context) (*config.Config, *models.Plan, error) {
+		return loadPlan(ctx, logger, *configPath, *environment, *strict, reconciler.ObserveProviderCall)
+	}
+	newExecutor := func(cfg *config.Config) (tasks.Executor, error) {
+		clients, err := newProviders(cfg, reconciler.ObserveProviderCall)
+		if err != nil {
+			return nil, fmt.Errorf("configure provider clients: %w", err)
+		}
+		spec := cfg.ToSpec()
+		if err := sshkey.Populate(&spec.SSHKey); err != nil {
+			return nil, fmt.Errorf("read ssh key: %w", err)
+		}
+		return tasks.NewExecutorWithOptions(logger, tasks.ExecutorOptions{
+			Applier:     clients.applier(logger, spec),
+			Poller:      clients.poller(),
+			Parallelism: *parallelism,
+			Retry:       cfg.RetryPolicies(),
+			Hooks:       cfg.OperationHooks(),
+			Journal:     journal,
+		}), nil
+	}
+	reconciler = daemon.NewReconciler(logger, load, newExecutor, queue)
+	reconciler.AutoApply = rules
+	reconciler.Interval = *interval
+	reconciler.Jitter = *jitter
+	reconciler.RunTimeout = *runTimeout
+	reconciler.ShutdownTimeout = *shutdownTimeout
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// A second signal terminates the process at once.
+		stop()
+	}()
+
+	var server *http.Server
+	serverErr := make(chan error, 1)
+	if *listen != "" {
+		listener, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return err
+		}
+		token := os.Getenv(config.EnvServeToken)
+		if token == "" {
+			logger.Warn("the HTTP API accepts approvals without authentication; set " + config.EnvServeToken + " to require a bearer token")
+		}
+		server = &http.Server{Handler: daemon.NewHandler(reconciler, token), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+		logger.Info("serving HTTP API", "address", listener.Addr().String())
+	}
+
+	logger.Info("reconciling", "interval", *interval, "jitter", *jitter, "auto_apply", autoApply.String())
+	runCtx, cancelRuns := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reconciler.Run(runCtx)
+	}()
+
+	select {
+	case <-ctx.Done():
+		logger.Info("shutting down", "cause", context.Cause(ctx))
+	case err = <-serverErr:
+		logger.Error("HTTP API failed; shutting down", "error", err)
+	}
+	cancelRuns()
+	<-done
+
+	if server != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if serr := server.Shutdown(shutdownCtx); serr != nil {
+			err = errors.Join(err, fmt.Errorf("shut down HTTP API: %w", serr))
+		}
+	}
+	return err
+}
@@ -6,75 +6,144 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"filippo.io/age"
+
+	"endnet-cli/internal/crypt"
 	"endnet-cli/pkg/models"
+	"endnet-cli/pkg/util"
 )
 
-// Config captures all configuration knobs for EndNET-CLI.
+// Config captures all configuration knobs for EndNET-CLI. The desc and format
+// tags document each key in generated files and the JSON Schema.
 type Config struct {
-	Project  string        `yaml:"project"`
-	Location string        `yaml:"location"`
-	Network  NetworkConfig `yaml:"network"`
-	Roles    RolesConfig   `yaml:"roles"`
-	DNS      DNSConfig     `yaml:"dns"`
-	Hetzner  HetznerConfig `yaml:"hetzner"`
-	IPv64    IPv64Config   `yaml:"ipv64"`
-	LoadedAt time.Time     `yaml:"-"`
-	Source   string        `yaml:"-"`
+	APIVersion string                 `yaml:"apiVersion" desc:"Version of the configuration format; older files are migrated when loaded."`
+	Project    string                 `yaml:"project" desc:"Project name, used to label all resources."`
+	Location   string                 `yaml:"location" desc:"Hetzner location of the servers, e.g. nbg1, fsn1 or hel1."`
+	Network    NetworkConfig          `yaml:"network" desc:"Private network connecting the servers."`
+	Roles      RolesConfig            `yaml:"roles" desc:"Servers by role."`
+	DNS        DNSConfig              `yaml:"dns" desc:"DNS names managed through IPv64."`
+	Hetzner    HetznerConfig          `yaml:"hetzner" desc:"Hetzner Cloud credentials and SSH key."`
+	IPv64      IPv64Config            `yaml:"ipv64" desc:"IPv64 credentials."`
+	Retry      RetryConfig            `yaml:"retry" desc:"Retries of provider calls failing with transient errors such as 409 locked, 429 or 5xx."`
+	Hooks      map[string]*HookConfig `yaml:"hooks" desc:"Commands run before or after matching operations, keyed by hook name."`
+	LoadedAt   time.Time              `yaml:"-"`
+	Source     string                 `yaml:"-"`
+	// Environment and Overlay are set when the configuration was loaded for
+	// an environment profile.
+	Environment string `yaml:"-"`
+	Overlay     string `yaml:"-"`
+	// Origins records where each value set by a file or an environment
+	// variable came from, keyed by dotted YAML path. See Origin.
+	Origins map[string]Origin `yaml:"-"`
 }
 
 // NetworkConfig contains network defaults.
 type NetworkConfig struct {
-	Name       string `yaml:"name"`
-	CIDR       string `yaml:"cidr"`
-	SubnetCIDR string `yaml:"subnetCidr"`
-	GatewayIP  string `yaml:"gatewayIp"`
+	Name       string `yaml:"name" desc:"Name of the Hetzner network."`
+	CIDR       string `yaml:"cidr" desc:"IP range of the network." format:"cidr"`
+	SubnetCIDR string `yaml:"subnetCidr" desc:"IP range of the server subnet; must lie inside cidr." format:"cidr"`
+	GatewayIP  string `yaml:"gatewayIp" desc:"Private IP that routes traffic out of the network; must be a role with publicIp enabled." format:"ip"`
 }
 
 // RolesConfig groups all server roles.
 type RolesConfig struct {
-	Edge  NodeConfig `yaml:"edge"`
-	WG    NodeConfig `yaml:"wg"`
-	Forge NodeConfig `yaml:"forge"`
+	Edge  NodeConfig `yaml:"edge" desc:"Public edge server and network gateway."`
+	WG    NodeConfig `yaml:"wg" desc:"WireGuard server; omitted when name is empty."`
+	Forge NodeConfig `yaml:"forge" desc:"Forgejo server; omitted when name is empty."`
 }
 
 // NodeConfig defines per-node options.
 type NodeConfig struct {
-	Name        string `yaml:"name"`
-	Type        string `yaml:"type"`
-	Image       string `yaml:"image"`
-	PrivateIP   string `yaml:"privateIp"`
-	HasPublicIP bool   `yaml:"publicIp"`
+	Name        string `yaml:"name" desc:"Server name, an RFC 1123 hostname." format:"hostname"`
+	Type        string `yaml:"type" desc:"Hetzner server type, e.g. cx23."`
+	Image       string `yaml:"image" desc:"Operating system image."`
+	PrivateIP   string `yaml:"privateIp" desc:"Address inside network.subnetCidr." format:"ip"`
+	HasPublicIP bool   `yaml:"publicIp" desc:"Whether the server gets a public IPv4 address."`
 }
 
 // DNSConfig contains DNS integration options.
 type DNSConfig struct {
-	RootDomain  string `yaml:"rootDomain"`
-	ForgejoHost string `yaml:"forgejoHost"`
+	RootDomain  string `yaml:"rootDomain" desc:"Domain under which all records are created." format:"hostname"`
+	ForgejoHost string `yaml:"forgejoHost" desc:"Host name of the Forgejo instance; must be under rootDomain." format:"hostname"`
 }
 
 // HetznerConfig provides credentials and options for Hetzner Cloud.
 type HetznerConfig struct {
-	APIToken   string `yaml:"apiToken"`
-	SSHKeyName string `yaml:"sshKeyName"`
+	APIToken         Secret `yaml:"apiToken" desc:"Hetzner Cloud API token or a file:, env:, exec: or keyring: reference."`
+	SSHKeyName       string `yaml:"sshKeyName" desc:"Name of the SSH key attached to every server."`
+	SSHPublicKeyPath string `yaml:"sshPublicKeyPath" desc:"Public key uploaded as sshKeyName; generated when missing."`
 }
 
 // IPv64Config describes the IPv64 API credentials.
 type IPv64Config struct {
-	APIKey      string `yaml:"apiKey"`
-	DynDNSToken string `yaml:"dynDnsToken"`
+	APIKey      Secret `yaml:"apiKey" desc:"IPv64 API key or a secret reference."`
+	DynDNSToken Secret `yaml:"dynDnsToken" desc:"IPv64 DynDNS token or a secret reference."`
+}
+
+// RetryConfig sets retry policies per resource kind. Values left at zero
+// inherit from default.
+type RetryConfig struct {
+	Default  RetryPolicyConfig `yaml:"default" desc:"Policy for every resource kind."`
+	Network  RetryPolicyConfig `yaml:"network" desc:"Overrides for network operations."`
+	SSHKey   RetryPolicyConfig `yaml:"sshKey" desc:"Overrides for SSH key operations."`
+	Server   RetryPolicyConfig `yaml:"server" desc:"Overrides for server operations."`
+	Firewall RetryPolicyConfig `yaml:"firewall" desc:"Overrides for firewall operations."`
+	DNS      RetryPolicyConfig `yaml:"dns" desc:"Overrides for DNS operations."`
+}
+
+// RetryPolicyConfig configures retries with exponential backoff and jitter.
+type RetryPolicyConfig struct {
+	MaxAttempts  int           `yaml:"maxAttempts" desc:"Attempts per provider call including the first; 1 disables retries."`
+	InitialDelay time.Duration `yaml:"initialDelay" desc:"Delay before the first retry, doubled for every further retry."`
+	MaxDelay     time.Duration `yaml:"maxDelay" desc:"Upper bound of the delay between retries."`
+}
+
+// HookConfig runs a command before or after the operations it matches.
+// Empty match fields match every operation.
+type HookConfig struct {
+	When    string        `yaml:"when" desc:"Whether the command runs before or after the operation."`
+	Kind    string        `yaml:"kind" desc:"Resource kind to match: network, sshkey, server, firewall or dns."`
+	Target  string        `yaml:"target" desc:"Glob matched against the resource name, e.g. endnet-*-1."`
+	Action  string        `yaml:"action" desc:"Operation type to match, e.g. create, update or delete."`
+	Command string        `yaml:"command" desc:"Shell command receiving the operation as JSON on stdin; a before hook exiting non-zero vetoes the operation."`
+	Timeout time.Duration `yaml:"timeout" desc:"Time limit of the command; 0 means none."`
 }
 
 // Loader defines the interface for materialising configuration data.
 type Loader interface {
 	Load(path string) (*Config, error)
+	LoadEnvironment(path, env string) (*Config, error)
 }
 
 // FileLoader implements Loader via YAML files and environment overrides.
-type FileLoader struct{}
+// Secret values may reference any of the SecretSources by scheme prefix and
+// are resolved when first revealed. Values encrypted with "endnetctl secret
+// encrypt" are decrypted during Load with the identities returned by Keys.
+//
+// Keys the loader does not know are ignored unless Strict is set, in which
+// case every unknown key is reported with its line. The keys accepted are the
+// same ones Schema describes.
+//
+// Files written for an older apiVersion are upgraded in memory, newer ones
+// are rejected; see Migrate.
+//
+// Every key can be overridden by an environment variable; see EnvName.
+// Logger receives warnings about ENDNET_* variables that match no key and
+// notes about files in an older format.
+type FileLoader struct {
+	SecretSources map[string]SecretSource
+	Keys          func() (crypt.Keys, error)
+	Strict        bool
+	Logger        util.Logger
+}
+
+var validEnvironment = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
 
 type yamlEntry struct {
 	level int
@@ -83,14 +152,21 @@ type yamlEntry struct {
 
 // NewLoader instantiates a FileLoader.
 func NewLoader() Loader {
-	return &FileLoader{}
+	return NewFileLoader()
+}
+
+// NewFileLoader returns a FileLoader with the default secret sources and keys
+// from the ENDNET_SECRET_* environment variables.
+func NewFileLoader() *FileLoader {
+	return &FileLoader{SecretSources: DefaultSecretSources(), Keys: crypt.KeysFromEnv}
 }
 
 // DefaultConfig returns a fully-populated configuration with sensible defaults.
 func DefaultConfig() *Config {
 	return &Config{
-		Project:  "endnet",
-		Location: "nbg1",
+		APIVersion: CurrentAPIVersion,
+		Project:    "endnet",
+		Location:   "nbg1",
 		Network: NetworkConfig{
 			Name:       "endnet-internal",
 			CIDR:       "10.10.0.0/16",
@@ -125,14 +201,31 @@ func DefaultConfig() *Config {
 			ForgejoHost: "git.endnet.ipv64.net",
 		},
 		Hetzner: HetznerConfig{
-			SSHKeyName: "endnet",
+			SSHKeyName:       "endnet",
+			SSHPublicKeyPath: "~/.ssh/endnet_ed25519.pub",
 		},
 		IPv64: IPv64Config{},
+		Retry: RetryConfig{
+			Default: RetryPolicyConfig{
+				MaxAttempts:  5,
+				InitialDelay: time.Second,
+				MaxDelay:     30 * time.Second,
+			},
+		},
 	}
 }
 
 // Load reads configuration from disk, merging it with defaults and environment overrides.
 func (l *FileLoader) Load(path string) (*Config, error) {
+	return l.LoadEnvironment(path, "")
+}
+
+// LoadEnvironment loads the configuration for an environment profile. The
+// overlay file for env (config.staging.yaml for config.yaml and "staging") is
+// deep-merged over the base file: keys it sets replace the base values and
+// everything else is inherited. Precedence is defaults, base file, overlay
+// file, environment variables. An empty env loads the base file only.
+func (l *FileLoader) LoadEnvironment(path, env string) (*Config, error) {
 	if path == "" {
 		return nil, errors.New("configuration path must not be empty")
 	}
@@ -140,11 +233,37 @@ func (l *FileLoader) Load(path string) (*Config, error) {
 	cfg := DefaultConfig()
 	cfg.Source = path
 
-	if err := l.applyFile(path, cfg); err != nil {
+	decode := l.decrypter()
+	version, err := l.applyFile(path, cfg, decode, 0)
+	if err != nil {
 		return nil, err
 	}
+	l.noteOlderFormat(path, version)
 
-	l.applyEnv(cfg)
+	if env != "" {
+		if !validEnvironment.MatchString(env) {
+			return nil, fmt.Errorf("invalid environment name %q", env)
+		}
+		overlay := OverlayPath(path, env)
+		if _, err := os.Stat(overlay); err != nil {
+			return nil, fmt.Errorf("environment %s: %w", env, err)
+		}
+		// Overlays usually only hold a few keys; one without apiVersion
+		// is in the format of the base file.
+		overlayVersion, err := l.applyFile(overlay, cfg, decode, version)
+		if err != nil {
+			return nil, fmt.Errorf("environment %s: %w", env, err)
+		}
+		if overlayVersion != version {
+			l.noteOlderFormat(overlay, overlayVersion)
+		}
+		cfg.Environment = env
+		cfg.Overlay = overlay
+	}
+
+	if err := l.applyEnv(cfg); err != nil {
+		return nil, err
+	}
 	cfg.LoadedAt = time.Now()
 
 	if err := cfg.Validate(); err != nil {
@@ -154,37 +273,124 @@ func (l *FileLoader) Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
-func (l *FileLoader) applyFile(path string, cfg *Config) error {
+// OverlayPath returns the overlay file for env next to the base file, e.g.
+// config.staging.yaml for config.yaml.
+func OverlayPath(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// applyFile sets the values of the file at path and returns the version of
+// the format it was written in. Files without apiVersion are taken to be in
+// version unversioned; a missing file counts as current.
+func (l *FileLoader) applyFile(path string, cfg *Config, decode func(string) (string, error), unversioned int) (int, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil
+			return len(migrations), nil
 		}
-		return fmt.Errorf("read config: %w", err)
+		return 0, fmt.Errorf("read config: %w", err)
 	}
 
-	if err := parseMinimalYAML(data, cfg); err != nil {
-		return fmt.Errorf("parse config: %w", err)
+	doc := newDocument(data)
+	from, err := doc.migrate(unversioned)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
 	}
 
-	return nil
-}
+	values, err := doc.values()
+	if err != nil {
+		return 0, fmt.Errorf("parse config: %w", err)
+	}
 
-func (l *FileLoader) applyEnv(cfg *Config) {
-	if v := os.Getenv("ENDNET_PROJECT"); v != "" {
-		cfg.Project = v
+	if l.Strict {
+		if err := checkKeys(path, values); err != nil {
+			return 0, err
+		}
 	}
-	if v := os.Getenv("ENDNET_LOCATION"); v != "" {
-		cfg.Location = v
+
+	for _, v := range values {
+		if v.section {
+			continue
+		}
+		f, ok := cfg.resolveField(v.path, true)
+		if !ok {
+			continue
+		}
+		value, err := decode(v.value)
+		if err == nil {
+			err = f.set(value, l.SecretSources)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("parse config: line %d: %s: %w", v.line, v.path, err)
+		}
+		if _, set := cfg.Origins[v.path]; set && v.line == 0 {
+			// A line added by a migration does not hide where the value
+			// was actually written.
+			continue
+		}
+		cfg.setOrigin(v.path, Origin{Kind: OriginFile, File: path, Line: v.line})
 	}
-	if v := os.Getenv("ENDNET_HCLOUD_TOKEN"); v != "" {
-		cfg.Hetzner.APIToken = v
+
+	return from, nil
+}
+
+// noteOlderFormat tells the user to migrate a file written in an older
+// version of the format.
+func (l *FileLoader) noteOlderFormat(path string, version int) {
+	if version < len(migrations) && l.Logger != nil {
+		l.Logger.Info("configuration uses an older format; run endnetctl config migrate to upgrade the file",
+			"file", path, "apiVersion", apiVersionName(version), "current", CurrentAPIVersion)
+	}
+}
+
+// checkKeys reports every key in values that is not part of the
+// configuration format.
+func checkKeys(file string, values []yamlValue) error {
+	v := &validator{}
+	for _, value := range values {
+		leaf, ok := keyType(value.path)
+		switch {
+		case !ok:
+			v.addf(value.path, "unknown key (%s:%d)", file, value.line)
+		case leaf && value.section:
+			v.addf(value.path, "expects a value (%s:%d)", file, value.line)
+		case !leaf && !value.section:
+			v.addf(value.path, "is a section and cannot have a value (%s:%d)", file, value.line)
+		}
 	}
-	if v := os.Getenv("ENDNET_IPV64_API_KEY"); v != "" {
-		cfg.IPv64.APIKey = v
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
 	}
-	if v := os.Getenv("ENDNET_IPV64_DYNDNS_TOKEN"); v != "" {
-		cfg.IPv64.DynDNSToken = v
+	return nil
+}
+
+// decrypter returns a value decoder that decrypts "enc:" values and leaves
+// all others untouched. Keys are loaded on the first encrypted value.
+func (l *FileLoader) decrypter() func(string) (string, error) {
+	var identities []age.Identity
+	loaded := false
+	return func(value string) (string, error) {
+		if !crypt.IsEncrypted(value) {
+			return value, nil
+		}
+		if !loaded {
+			if l.Keys == nil {
+				return "", errors.New("encrypted value found but no decryption keys are configured")
+			}
+			keys, err := l.Keys()
+			if err != nil {
+				return "", fmt.Errorf("load decryption keys: %w", err)
+			}
+			identities = keys.Identities
+			loaded = true
+		}
+		plaintext, err := crypt.Decrypt(value, identities...)
+		if err != nil {
+			return "", fmt.Errorf("decrypt: %w", err)
+		}
+		util.RegisterSecret(plaintext)
+		return plaintext, nil
 	}
 }
 
@@ -211,7 +417,83 @@ func (c *Config) ToSpec() models.EndnetSpec {
 			RootDomain:  c.DNS.RootDomain,
 			ForgejoHost: c.DNS.ForgejoHost,
 		},
+		SSHKey: models.SSHKeySpec{
+			Name:          c.Hetzner.SSHKeyName,
+			PublicKeyPath: c.Hetzner.SSHPublicKeyPath,
+		},
+		Firewall: models.FirewallSpec{
+			Name:  c.Project + "-edge",
+			Rules: edgeFirewallRules(),
+		},
+	}
+}
+
+// edgeFirewallRules returns the inbound rules of the edge firewall: SSH, HTTP
+// and HTTPS, and WireGuard, from anywhere.
+func edgeFirewallRules() []models.FirewallRule {
+	const anywhere = "0.0.0.0/0,::/0"
+	return []models.FirewallRule{
+		{Direction: "in", Protocol: "tcp", Port: "22", Source: anywhere},
+		{Direction: "in", Protocol: "tcp", Port: "80", Source: anywhere},
+		{Direction: "in", Protocol: "tcp", Port: "443", Source: anywhere},
+		{Direction: "in", Protocol: "udp", Port: "51820", Source: anywhere},
+	}
+}
+
+// RetryPolicies returns the retry policy of every resource kind, keyed like
+// models.Operation.Kind, with unset values taken from the default policy.
+func (c *Config) RetryPolicies() map[string]models.RetryPolicy {
+	kinds := map[string]RetryPolicyConfig{
+		"network":  c.Retry.Network,
+		"sshkey":   c.Retry.SSHKey,
+		"server":   c.Retry.Server,
+		"firewall": c.Retry.Firewall,
+		"dns":      c.Retry.DNS,
+	}
+
+	policies := make(map[string]models.RetryPolicy, len(kinds))
+	for kind, p := range kinds {
+		policy := models.RetryPolicy{
+			MaxAttempts:  c.Retry.Default.MaxAttempts,
+			InitialDelay: c.Retry.Default.InitialDelay,
+			MaxDelay:     c.Retry.Default.MaxDelay,
+		}
+		if p.MaxAttempts != 0 {
+			policy.MaxAttempts = p.MaxAttempts
+		}
+		if p.InitialDelay != 0 {
+			policy.InitialDelay = p.InitialDelay
+		}
+		if p.MaxDelay != 0 {
+			policy.MaxDelay = p.MaxDelay
+		}
+		policies[kind] = policy
+	}
+	return policies
+}
+
+// OperationHooks returns the configured hooks sorted by name.
+func (c *Config) OperationHooks() []models.Hook {
+	names := make([]string, 0, len(c.Hooks))
+	for name := range c.Hooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hooks := make([]models.Hook, 0, len(names))
+	for _, name := range names {
+		h := c.Hooks[name]
+		hooks = append(hooks, models.Hook{
+			Name:    name,
+			When:    h.When,
+			Kind:    h.Kind,
+			Target:  h.Target,
+			Action:  h.Action,
+			Command: h.Command,
+			Timeout: h.Timeout,
+		})
 	}
+	return hooks
 }
 
 func toNodeSpec(cfg NodeConfig) models.NodeSpec {
@@ -224,91 +506,25 @@ func toNodeSpec(cfg NodeConfig) models.NodeSpec {
 	}
 }
 
-// Validate performs basic sanity checks on the configuration.
-func (c *Config) Validate() error {
-	if c.Project == "" {
-		return errors.New("project must not be empty")
-	}
-	if c.Network.Name == "" {
-		return errors.New("network.name must not be empty")
-	}
-	if c.Roles.Edge.Name == "" {
-		return errors.New("roles.edge.name must not be empty")
-	}
-	if c.DNS.RootDomain == "" {
-		return errors.New("dns.rootDomain must not be empty")
-	}
-	return nil
+// yamlValue is a key read from a configuration file. Sections are keys
+// without a value on their line.
+type yamlValue struct {
+	path    string
+	value   string
+	line    int
+	section bool
 }
 
-func parseMinimalYAML(data []byte, cfg *Config) error {
+// parseMinimalYAML returns the keys in data with their dotted path, in file
+// order.
+func parseMinimalYAML(data []byte) ([]yamlValue, error) {
 	scanner := bufio.NewScanner(bytes.NewReader(data))
 	var stack []yamlEntry
+	var values []yamlValue
 
-	setValue := func(path []string, value string) error {
-		key := strings.Join(path, ".")
-		switch key {
-		case "project":
-			cfg.Project = value
-		case "location":
-			cfg.Location = value
-		case "network.name":
-			cfg.Network.Name = value
-		case "network.cidr":
-			cfg.Network.CIDR = value
-		case "network.subnetCidr":
-			cfg.Network.SubnetCIDR = value
-		case "network.gatewayIp":
-			cfg.Network.GatewayIP = value
-		case "roles.edge.name":
-			cfg.Roles.Edge.Name = value
-		case "roles.edge.type":
-			cfg.Roles.Edge.Type = value
-		case "roles.edge.image":
-			cfg.Roles.Edge.Image = value
-		case "roles.edge.privateIp":
-			cfg.Roles.Edge.PrivateIP = value
-		case "roles.edge.publicIp":
-			cfg.Roles.Edge.HasPublicIP = parseBool(value)
-		case "roles.wg.name":
-			cfg.Roles.WG.Name = value
-		case "roles.wg.type":
-			cfg.Roles.WG.Type = value
-		case "roles.wg.image":
-			cfg.Roles.WG.Image = value
-		case "roles.wg.privateIp":
-			cfg.Roles.WG.PrivateIP = value
-		case "roles.wg.publicIp":
-			cfg.Roles.WG.HasPublicIP = parseBool(value)
-		case "roles.forge.name":
-			cfg.Roles.Forge.Name = value
-		case "roles.forge.type":
-			cfg.Roles.Forge.Type = value
-		case "roles.forge.image":
-			cfg.Roles.Forge.Image = value
-		case "roles.forge.privateIp":
-			cfg.Roles.Forge.PrivateIP = value
-		case "roles.forge.publicIp":
-			cfg.Roles.Forge.HasPublicIP = parseBool(value)
-		case "dns.rootDomain":
-			cfg.DNS.RootDomain = value
-		case "dns.forgejoHost":
-			cfg.DNS.ForgejoHost = value
-		case "hetzner.apiToken":
-			cfg.Hetzner.APIToken = value
-		case "hetzner.sshKeyName":
-			cfg.Hetzner.SSHKeyName = value
-		case "ipv64.apiKey":
-			cfg.IPv64.APIKey = value
-		case "ipv64.dynDnsToken":
-			cfg.IPv64.DynDNSToken = value
-		default:
-			// ignore unknown keys for now
-		}
-		return nil
-	}
-
+	lineNo := 0
 	for scanner.Scan() {
+		lineNo++
 		raw := scanner.Text()
 		trimmed := strings.TrimSpace(raw)
 		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
@@ -326,7 +542,7 @@ func parseMinimalYAML(data []byte, cfg *Config) error {
 		key := strings.TrimSpace(parts[0])
 		value := ""
 		if len(parts) == 2 {
-			value = strings.TrimSpace(parts[1])
+			value = stripComment(strings.TrimSpace(parts[1]))
 		}
 
 		path := append([]string{}, keysFromStack(stack)...)
@@ -334,20 +550,36 @@ func parseMinimalYAML(data []byte, cfg *Config) error {
 
 		if value == "" {
 			stack = append(stack, yamlEntry{level: level, key: key})
+			values = append(values, yamlValue{path: strings.Join(path, "."), line: lineNo, section: true})
 			continue
 		}
 
-		value = strings.Trim(value, "\"'")
-		if err := setValue(path, value); err != nil {
-			return err
-		}
+		values = append(values, yamlValue{
+			path:  strings.Join(path, "."),
+			value: strings.Trim(value, "\"'"),
+			line:  lineNo,
+		})
 	}
 
 	if err := scanner.Err(); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return values, nil
+}
+
+// stripComment removes a trailing " # comment" from an unquoted value.
+func stripComment(value string) string {
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[:end+2]
+		}
+		return value
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		return strings.TrimSpace(value[:i])
+	}
+	return value
 }
 
 func keysFromStack(stack []yamlEntry) []string {
@@ -357,11 +589,3 @@ func keysFromStack(stack []yamlEntry) []string {
 	}
 	return keys
 }
-
-func parseBool(value string) bool {
-	b, err := strconv.ParseBool(value)
-	if err != nil {
-		return false
-	}
-	return b
-}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes content to name in a temporary directory and returns its
+// path.
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadEnvironmentMergesOverlay(t *testing.T) {
+	base := `apiVersion: v1
+project: demo
+location: nbg1
+roles:
+  edge:
+    name: demo-edge-1
+    type: cx23
+hooks:
+  notify:
+    when: after
+    command: notify-send done
+    timeout: 5s
+`
+	tests := []struct {
+		name    string
+		env     string
+		overlay string
+		check   func(t *testing.T, cfg *Config)
+		wantErr string
+	}{
+		{
+			name: "no environment",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Location != "nbg1" || cfg.Environment != "" || cfg.Overlay != "" {
+					t.Errorf("location %q, environment %q, overlay %q", cfg.Location, cfg.Environment, cfg.Overlay)
+				}
+			},
+		},
+		{
+			name:    "overlay replaces scalars and keeps siblings",
+			env:     "staging",
+			overlay: "location: fsn1\nroles:\n  edge:\n    type: cx33\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Location != "fsn1" || cfg.Project != "demo" {
+					t.Errorf("location %q, project %q", cfg.Location, cfg.Project)
+				}
+				if cfg.Roles.Edge.Type != "cx33" || cfg.Roles.Edge.Name != "demo-edge-1" {
+					t.Errorf("edge = %+v", cfg.Roles.Edge)
+				}
+				if cfg.Roles.WG.Image != "debian-12" {
+					t.Errorf("default not inherited: wg image %q", cfg.Roles.WG.Image)
+				}
+				if cfg.Environment != "staging" || cfg.Overlay != "config.staging.yaml" {
+					t.Errorf("environment %q, overlay %q", cfg.Environment, cfg.Overlay)
+				}
+			},
+		},
+		{
+			name:    "overlay merges map entries",
+			env:     "prod",
+			overlay: "hooks:\n  notify:\n    timeout: 30s\n  audit:\n    when: before\n    command: audit\n",
+			check: func(t *testing.T, cfg *Config) {
+				notify := cfg.Hooks["notify"]
+				if notify == nil || notify.Command != "notify-send done" || notify.Timeout != 30*time.Second {
+					t.Errorf("notify = %+v", notify)
+				}
+				if audit := cfg.Hooks["audit"]; audit == nil || audit.When != "before" {
+					t.Errorf("audit = %+v", audit)
+				}
+			},
+		},
+		{
+			name:    "missing overlay",
+			env:     "dev",
+			wantErr: "environment dev: stat config.dev.yaml",
+		},
+		{
+			name:    "invalid environment name",
+			env:     "../prod",
+			wantErr: `invalid environment name "../prod"`,
+		},
+		{
+			name:    "overlay values are validated",
+			env:     "staging",
+			overlay: "location: Nuremberg\n",
+			wantErr: `location: "Nuremberg" is not a Hetzner location`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfig(t, dir, "config.yaml", base)
+			if tt.overlay != "" {
+				writeConfig(t, dir, "config."+tt.env+".yaml", tt.overlay)
+			}
+			t.Chdir(dir)
+
+			cfg, err := NewLoader().LoadEnvironment("config.yaml", tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadEnvironment error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadEnvironmentVariablesOverrideOverlay(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "config.yaml", "apiVersion: v1\nlocation: nbg1\n")
+	writeConfig(t, dir, "config.staging.yaml", "location: fsn1\n")
+	t.Chdir(dir)
+	t.Setenv("ENDNET_LOCATION", "hel1")
+
+	cfg, err := NewLoader().LoadEnvironment("config.yaml", "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Location != "hel1" {
+		t.Fatalf("location = %q, want the environment variable's hel1", cfg.Location)
+	}
+}
+
+func TestOverlayPath(t *testing.T) {
+	tests := []struct{ path, env, want string }{
+		{"config.yaml", "staging", "config.staging.yaml"},
+		{"deploy/endnet.yml", "prod", "deploy/endnet.prod.yml"},
+		{"config", "dev", "config.dev"},
+	}
+	for _, tt := range tests {
+		if got := OverlayPath(tt.path, tt.env); got != tt.want {
+			t.Errorf("OverlayPath(%q, %q) = %q, want %q", tt.path, tt.env, got, tt.want)
+		}
+	}
+}
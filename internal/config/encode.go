@@ -0,0 +1,60 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EncodeOptions controls how Encode renders a configuration.
+type EncodeOptions struct {
+	// Origins appends the source of every value as a trailing comment.
+	Origins bool
+	// Comments writes the description of every key above it.
+	Comments bool
+	// OmitZero leaves out keys holding the zero value of their type, and
+	// sections containing only such keys. Loading the output yields the same
+	// configuration as long as the defaults of these keys are zero as well.
+	OmitZero bool
+}
+
+// Encode writes cfg in the format read by FileLoader. Secrets are written as
+// their reference, literal secrets as util.Redacted.
+func Encode(w io.Writer, cfg *Config, opts EncodeOptions) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range cfg.fields() {
+		if opts.OmitZero && f.value.IsZero() {
+			continue
+		}
+		depth := strings.Count(f.path, ".")
+		key := f.path[strings.LastIndex(f.path, ".")+1:]
+		indent := strings.Repeat("  ", depth)
+		if opts.Comments && f.desc != "" {
+			if depth == 0 {
+				fmt.Fprintln(bw)
+			}
+			fmt.Fprintf(bw, "%s# %s\n", indent, f.desc)
+		}
+		if !f.leaf {
+			fmt.Fprintf(bw, "%s%s:\n", indent, key)
+			continue
+		}
+		line := fmt.Sprintf("%s%s: %s", indent, key, quoteValue(f.display()))
+		if opts.Origins {
+			line += "  # " + cfg.Origin(f.path).String()
+		}
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
+
+// quoteValue quotes values that would otherwise be read back differently.
+func quoteValue(value string) string {
+	if value == "" || value != strings.TrimSpace(value) ||
+		strings.Contains(value, " #") || strings.HasPrefix(value, "#") ||
+		strings.ContainsAny(value[:1], `"'`) {
+		return `"` + value + `"`
+	}
+	return value
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"endnet-cli/internal/crypt"
+)
+
+// EnvPrefix starts every environment variable read by EndNET-CLI.
+const EnvPrefix = "ENDNET_"
+
+// EnvEnvironment selects the environment profile when --env is not given.
+const EnvEnvironment = "ENDNET_ENV"
+
+// EnvServeToken holds the bearer token required by the write endpoints of
+// endnetctl serve.
+const EnvServeToken = "ENDNET_SERVE_TOKEN"
+
+// envAliases are the shorter names for keys that predate the derived names.
+// The derived name of a key takes precedence over its alias.
+var envAliases = []struct {
+	variable string
+	path     string
+}{
+	{"ENDNET_HCLOUD_TOKEN", "hetzner.apiToken"},
+	{"ENDNET_IPV64_API_KEY", "ipv64.apiKey"},
+	{"ENDNET_IPV64_DYNDNS_TOKEN", "ipv64.dynDnsToken"},
+}
+
+// envReserved lists ENDNET_* variables that are not configuration keys.
+var envReserved = []string{EnvEnvironment, EnvServeToken, crypt.EnvIdentity, crypt.EnvPassphrase, crypt.EnvRecipients}
+
+// warnedEnv holds the unknown ENDNET_* variables already warned about, so a
+// process loading its configuration repeatedly, like endnetctl serve, warns
+// once.
+var warnedEnv sync.Map
+
+// EnvName returns the environment variable overriding the key at the dotted
+// YAML path: the segments upper-cased and joined by a double underscore,
+// e.g. ENDNET_ROLES__FORGE__TYPE for roles.forge.type. Characters a shell
+// variable name cannot hold, such as the - of a hook name, become _.
+func EnvName(path string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, path)
+	return EnvPrefix + strings.ReplaceAll(name, ".", "__")
+}
+
+// applyEnv overrides keys with the aliases first and the derived names
+// second. Booleans accept the values of strconv.ParseBool and lists are
+// comma separated.
+func (l *FileLoader) applyEnv(cfg *Config) error {
+	apply := func(variable, path string) error {
+		value := os.Getenv(variable)
+		if value == "" {
+			return nil
+		}
+		f, _ := cfg.lookupField(path)
+		if err := f.set(value, l.SecretSources); err != nil {
+			return fmt.Errorf("%s: %w", variable, err)
+		}
+		cfg.setOrigin(path, Origin{Kind: OriginEnv, Variable: variable})
+		return nil
+	}
+
+	known := slices.Clone(envReserved)
+	for _, alias := range envAliases {
+		if err := apply(alias.variable, alias.path); err != nil {
+			return err
+		}
+		known = append(known, alias.variable)
+	}
+	for _, f := range cfg.fields() {
+		if !f.leaf {
+			continue
+		}
+		if err := apply(EnvName(f.path), f.path); err != nil {
+			return err
+		}
+		known = append(known, EnvName(f.path))
+	}
+
+	if l.Logger == nil {
+		return nil
+	}
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvPrefix) || slices.Contains(known, name) {
+			continue
+		}
+		if _, warned := warnedEnv.LoadOrStore(name, true); !warned {
+			l.Logger.Warn("environment variable does not match any configuration key", "variable", name)
+		}
+	}
+	return nil
+}
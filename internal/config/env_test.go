@@ -0,0 +1,161 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"endnet-cli/pkg/util"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"project", "ENDNET_PROJECT"},
+		{"roles.forge.type", "ENDNET_ROLES__FORGE__TYPE"},
+		{"network.subnetCidr", "ENDNET_NETWORK__SUBNETCIDR"},
+		{"retry.sshKey.maxAttempts", "ENDNET_RETRY__SSHKEY__MAXATTEMPTS"},
+		{"hooks.notify.command", "ENDNET_HOOKS__NOTIFY__COMMAND"},
+		{"hooks.notify-ops.command", "ENDNET_HOOKS__NOTIFY_OPS__COMMAND"},
+	}
+	for _, tt := range tests {
+		if got := EnvName(tt.path); got != tt.want {
+			t.Errorf("EnvName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// warningLogger keeps the variables of "does not match" warnings.
+type warningLogger struct {
+	util.Logger
+	variables []string
+}
+
+func (l *warningLogger) Warn(msg string, args ...any) {
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "variable" {
+			l.variables = append(l.variables, args[i+1].(string))
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		check        func(t *testing.T, cfg *Config)
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name: "derived names of every type",
+			env: map[string]string{
+				"ENDNET_ROLES__FORGE__TYPE":           "cx33",
+				"ENDNET_ROLES__WG__PUBLICIP":          "1",
+				"ENDNET_RETRY__DNS__MAXATTEMPTS":      "3",
+				"ENDNET_RETRY__DEFAULT__INITIALDELAY": "250ms",
+				"ENDNET_IPV64__DYNDNSTOKEN":           "env:DYNDNS",
+				"ENDNET_NETWORK__SUBNETCIDR":          "10.10.1.0/24",
+				"ENDNET_ROLES__EDGE__PRIVATEIP":       "10.10.1.2",
+				"ENDNET_NETWORK__GATEWAYIP":           "10.10.1.2",
+				"ENDNET_ROLES__WG__PRIVATEIP":         "10.10.1.10",
+				"ENDNET_ROLES__FORGE__PRIVATEIP":      "10.10.1.20",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Roles.Forge.Type != "cx33" || !cfg.Roles.WG.HasPublicIP {
+					t.Errorf("roles = %+v", cfg.Roles)
+				}
+				if cfg.Retry.DNS.MaxAttempts != 3 || cfg.Retry.Default.InitialDelay != 250*time.Millisecond {
+					t.Errorf("retry = %+v", cfg.Retry)
+				}
+				if ref := cfg.IPv64.DynDNSToken.Reference(); ref != "env:DYNDNS" {
+					t.Errorf("dynDnsToken reference = %q", ref)
+				}
+			},
+		},
+		{
+			name: "derived name wins over alias",
+			env: map[string]string{
+				"ENDNET_HCLOUD_TOKEN":      "env:ALIAS",
+				"ENDNET_HETZNER__APITOKEN": "env:DERIVED",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if ref := cfg.Hetzner.APIToken.Reference(); ref != "env:DERIVED" {
+					t.Errorf("apiToken reference = %q, want env:DERIVED", ref)
+				}
+				if o := cfg.Origin("hetzner.apiToken"); o.Variable != "ENDNET_HETZNER__APITOKEN" {
+					t.Errorf("origin = %s", o)
+				}
+			},
+		},
+		{
+			name: "unknown variables are reported, reserved ones are not",
+			env: map[string]string{
+				"ENDNET_PROJCT":          "typo",
+				"ENDNET_ROLES__EDGE":     "section",
+				EnvEnvironment:           "staging",
+				EnvServeToken:            "token",
+				"ENDNET_SECRET_IDENTITY": "",
+			},
+			wantWarnings: []string{"ENDNET_PROJCT", "ENDNET_ROLES__EDGE"},
+		},
+		{
+			name:    "invalid values name the variable",
+			env:     map[string]string{"ENDNET_ROLES__EDGE__PUBLICIP": "maybe"},
+			wantErr: `ENDNET_ROLES__EDGE__PUBLICIP: "maybe" is not a boolean`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			logger := &warningLogger{}
+			loader := NewFileLoader()
+			loader.Logger = logger
+			cfg := DefaultConfig()
+
+			err := loader.applyEnv(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyEnv error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+			for _, want := range tt.wantWarnings {
+				if !strings.Contains(strings.Join(logger.variables, ","), want) {
+					t.Errorf("no warning about %s: %q", want, logger.variables)
+				}
+			}
+			if len(logger.variables) != len(tt.wantWarnings) {
+				t.Errorf("warnings about %q, want %q", logger.variables, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestApplyEnvWarnsOnce(t *testing.T) {
+	t.Setenv("ENDNET_RETRY__DNSS__MAXATTEMPTS", "3")
+	logger := &warningLogger{}
+	loader := NewFileLoader()
+	loader.Logger = logger
+
+	// endnetctl serve loads the configuration before every run.
+	for range 3 {
+		if err := loader.applyEnv(DefaultConfig()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(logger.variables) != 1 || logger.variables[0] != "ENDNET_RETRY__DNSS__MAXATTEMPTS" {
+		t.Fatalf("warnings about %q, want one about ENDNET_RETRY__DNSS__MAXATTEMPTS", logger.variables)
+	}
+}
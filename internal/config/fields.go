@@ -0,0 +1,244 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	secretType   = reflect.TypeOf(Secret{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// field is a configuration value addressed by its dotted YAML path.
+type field struct {
+	path  string
+	desc  string
+	value reflect.Value
+	leaf  bool
+}
+
+// fields returns every YAML key of cfg in declaration order, with map
+// entries sorted by name. Sections are listed before the keys they contain.
+func (c *Config) fields() []field {
+	var out []field
+	walkFields(reflect.ValueOf(c).Elem(), "", &out)
+	return out
+}
+
+func walkFields(v reflect.Value, prefix string, out *[]field) {
+	if v.Kind() == reflect.Map {
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			entry := v.MapIndex(key)
+			if entry.IsNil() {
+				continue
+			}
+			path := prefix + "." + key.String()
+			*out = append(*out, field{path: path, value: entry.Elem()})
+			walkFields(entry.Elem(), path, out)
+		}
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := yamlName(sf)
+		if name == "" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		f := field{path: path, desc: sf.Tag.Get("desc"), value: v.Field(i), leaf: isLeaf(sf.Type)}
+		*out = append(*out, f)
+		if f.leaf {
+			continue
+		}
+		walkFields(f.value, path, out)
+	}
+}
+
+// lookupField returns the leaf at path.
+func (c *Config) lookupField(path string) (field, bool) {
+	return c.resolveField(path, false)
+}
+
+// resolveField returns the leaf at path. With create, missing map entries on
+// the way, such as the hook in hooks.<name>.command, are added.
+func (c *Config) resolveField(path string, create bool) (field, bool) {
+	v := reflect.ValueOf(c).Elem()
+	for _, segment := range strings.Split(path, ".") {
+		switch {
+		case v.Kind() == reflect.Struct && v.Type() != secretType:
+			i, ok := fieldIndex(v.Type(), segment)
+			if !ok {
+				return field{}, false
+			}
+			v = v.Field(i)
+		case v.Kind() == reflect.Map:
+			key := reflect.ValueOf(segment)
+			entry := v.MapIndex(key)
+			if !entry.IsValid() || entry.IsNil() {
+				if !create {
+					return field{}, false
+				}
+				if v.IsNil() {
+					v.Set(reflect.MakeMap(v.Type()))
+				}
+				entry = reflect.New(v.Type().Elem().Elem())
+				v.SetMapIndex(key, entry)
+			}
+			v = entry.Elem()
+		default:
+			return field{}, false
+		}
+	}
+	if !isLeaf(v.Type()) {
+		return field{}, false
+	}
+	return field{path: path, value: v, leaf: true}, true
+}
+
+// keyType reports whether path is a key of the configuration format and
+// whether it holds a value rather than a section. Map entries may have any
+// name.
+func keyType(path string) (leaf, ok bool) {
+	t := reflect.TypeOf(Config{})
+	for _, segment := range strings.Split(path, ".") {
+		switch {
+		case t.Kind() == reflect.Struct && t != secretType:
+			i, ok := fieldIndex(t, segment)
+			if !ok {
+				return false, false
+			}
+			t = t.Field(i).Type
+		case t.Kind() == reflect.Map:
+			t = t.Elem().Elem()
+		default:
+			return false, false
+		}
+	}
+	return isLeaf(t), true
+}
+
+func fieldIndex(t reflect.Type, name string) (int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlName(t.Field(i)) == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Value returns the displayed value at the dotted YAML path, with secrets
+// formatted by Secret.String.
+func (c *Config) Value(path string) (string, error) {
+	f, ok := c.lookupField(path)
+	if !ok {
+		return "", fmt.Errorf("unknown configuration key %q", path)
+	}
+	return f.display(), nil
+}
+
+// Set parses value according to the type of the key at the dotted YAML path
+// and stores it. Secrets are stored as literals or references to the default
+// secret sources.
+func (c *Config) Set(path, value string) error {
+	f, ok := c.lookupField(path)
+	if !ok {
+		return fmt.Errorf("unknown configuration key %q", path)
+	}
+	if err := f.set(value, DefaultSecretSources()); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// yamlName returns the key of a struct field, or an empty string for fields
+// that are not part of the file format.
+func yamlName(sf reflect.StructField) string {
+	if !sf.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return strings.ToLower(sf.Name)
+	}
+	return name
+}
+
+func isLeaf(t reflect.Type) bool {
+	return (t.Kind() != reflect.Struct && t.Kind() != reflect.Map) || t == secretType
+}
+
+// set parses raw according to the field type and stores it. Lists are
+// written inline as "[a, b]" or comma separated as "a,b".
+func (f field) set(raw string, sources map[string]SecretSource) error {
+	switch {
+	case f.value.Type() == secretType:
+		f.value.Set(reflect.ValueOf(NewSecret(raw, sources)))
+	case f.value.Kind() == reflect.String:
+		f.value.SetString(raw)
+	case f.value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 500ms or 2s", raw)
+		}
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		f.value.SetInt(int64(n))
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		f.value.SetBool(b)
+	case f.value.Type() == reflect.TypeOf([]string(nil)):
+		f.value.Set(reflect.ValueOf(parseList(raw)))
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Type())
+	}
+	return nil
+}
+
+// display formats the value for output. Secrets are shown via Secret.String
+// so literal values are never revealed.
+func (f field) display() string {
+	switch v := f.value.Interface().(type) {
+	case Secret:
+		return v.String()
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func parseList(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "[") && strings.HasSuffix(raw, "]") {
+		raw = raw[1 : len(raw)-1]
+	}
+	items := []string{}
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.Trim(strings.TrimSpace(item), "\"'"); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CurrentAPIVersion is the newest configuration format this binary reads.
+const CurrentAPIVersion = "v1"
+
+// migrations[i] upgrades a document from version i to version i+1. Version 0
+// is the unversioned format used before apiVersion existed. Each step only
+// changes the keys it is about; the runner records the new version.
+var migrations = []func(d *document) error{
+	// v0 -> v1: the format is unchanged, the version is recorded.
+	func(d *document) error { return nil },
+}
+
+// document is a configuration file being migrated. Lines keep their number
+// in the original file so values can still be traced to it.
+type document struct {
+	lines []string
+	// origin holds the original line number of every line, 0 for lines
+	// added by a migration.
+	origin []int
+}
+
+func newDocument(data []byte) *document {
+	text := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	d := &document{}
+	if text == "" {
+		return d
+	}
+	d.lines = strings.Split(text, "\n")
+	d.origin = make([]int, len(d.lines))
+	for i := range d.origin {
+		d.origin[i] = i + 1
+	}
+	return d
+}
+
+// values parses the document. Line numbers refer to the original file.
+func (d *document) values() ([]yamlValue, error) {
+	values, err := parseMinimalYAML(d.bytes())
+	if err != nil {
+		return nil, err
+	}
+	for i := range values {
+		values[i].line = d.origin[values[i].line-1]
+	}
+	return values, nil
+}
+
+func (d *document) bytes() []byte {
+	if len(d.lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(d.lines, "\n") + "\n")
+}
+
+// setTopLevel replaces the value of a top-level key or, when the key is
+// missing, inserts it after the comment block heading the file.
+func (d *document) setTopLevel(key, value string) {
+	line := key + ": " + value
+	for i, l := range d.lines {
+		if strings.HasPrefix(l, key+":") {
+			d.lines[i] = line
+			return
+		}
+	}
+
+	at := 0
+	for at < len(d.lines) && strings.HasPrefix(d.lines[at], "#") {
+		at++
+	}
+	if at < len(d.lines) && strings.TrimSpace(d.lines[at]) != "" {
+		// The comments describe the first key rather than the file.
+		at = 0
+	}
+	d.lines = append(d.lines[:at], append([]string{line}, d.lines[at:]...)...)
+	d.origin = append(d.origin[:at], append([]int{0}, d.origin[at:]...)...)
+}
+
+// migrate upgrades the document to CurrentAPIVersion and returns the version
+// it started from. Documents without apiVersion are taken to be in version
+// unversioned. Documents newer than the binary are rejected.
+func (d *document) migrate(unversioned int) (int, error) {
+	values, err := d.values()
+	if err != nil {
+		return 0, err
+	}
+	raw := ""
+	for _, v := range values {
+		if v.path == "apiVersion" {
+			raw = v.value
+		}
+	}
+
+	from, err := parseAPIVersion(raw)
+	if err != nil {
+		return 0, err
+	}
+	if raw == "" {
+		from = unversioned
+	}
+	if from > len(migrations) {
+		return 0, fmt.Errorf("apiVersion %s is newer than the supported %s; upgrade endnetctl", raw, CurrentAPIVersion)
+	}
+
+	for version := from; version < len(migrations); version++ {
+		if err := migrations[version](d); err != nil {
+			return 0, fmt.Errorf("migrate from %s: %w", apiVersionName(version), err)
+		}
+		d.setTopLevel("apiVersion", apiVersionName(version+1))
+	}
+	return from, nil
+}
+
+// Migrate upgrades a configuration file to CurrentAPIVersion. It returns the
+// migrated file, keeping comments and layout, and the version it started
+// from, "unversioned" for files without apiVersion.
+func Migrate(data []byte) ([]byte, string, error) {
+	d := newDocument(data)
+	from, err := d.migrate(0)
+	if err != nil {
+		return nil, "", err
+	}
+	return d.bytes(), apiVersionName(from), nil
+}
+
+func parseAPIVersion(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(raw, "v"))
+	if err != nil || !strings.HasPrefix(raw, "v") || n < 1 {
+		return 0, fmt.Errorf("apiVersion %q is not a version such as %s", raw, CurrentAPIVersion)
+	}
+	return n, nil
+}
+
+func apiVersionName(version int) string {
+	if version == 0 {
+		return "unversioned"
+	}
+	return "v" + strconv.Itoa(version)
+}
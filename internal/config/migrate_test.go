@@ -0,0 +1,148 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"endnet-cli/pkg/util"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		want     string
+		wantFrom string
+		wantErr  string
+	}{
+		{
+			name:     "unversioned with a file comment",
+			in:       "# EndNET\n\nproject: demo\n",
+			want:     "# EndNET\napiVersion: v1\n\nproject: demo\n",
+			wantFrom: "unversioned",
+		},
+		{
+			name:     "unversioned with a comment on the first key",
+			in:       "# The project name.\nproject: demo\n",
+			want:     "apiVersion: v1\n# The project name.\nproject: demo\n",
+			wantFrom: "unversioned",
+		},
+		{
+			name:     "crlf line endings",
+			in:       "project: demo\r\n",
+			want:     "apiVersion: v1\nproject: demo\n",
+			wantFrom: "unversioned",
+		},
+		{
+			name:     "current",
+			in:       "apiVersion: v1\nproject: demo\n",
+			want:     "apiVersion: v1\nproject: demo\n",
+			wantFrom: "v1",
+		},
+		{
+			name:    "newer",
+			in:      "apiVersion: v2\n",
+			wantErr: "apiVersion v2 is newer than the supported v1; upgrade endnetctl",
+		},
+		{
+			name:    "malformed",
+			in:      "apiVersion: 1\n",
+			wantErr: `apiVersion "1" is not a version such as v1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, from, err := Migrate([]byte(tt.in))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Migrate error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want || from != tt.wantFrom {
+				t.Fatalf("Migrate = %q from %s, want %q from %s", got, from, tt.want, tt.wantFrom)
+			}
+		})
+	}
+}
+
+// recordingLogger keeps the messages logged at info level.
+type recordingLogger struct {
+	util.Logger
+	infos []string
+}
+
+func (l *recordingLogger) Info(msg string, args ...any) {
+	l.infos = append(l.infos, msg)
+}
+
+func TestLoadOlderFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		overlay   string
+		wantNotes int
+		wantLine  int
+		wantFile  string
+	}{
+		{
+			name:      "current base, overlay without apiVersion",
+			base:      "apiVersion: v1\nproject: demo\n",
+			overlay:   "location: fsn1\n",
+			wantNotes: 0,
+			wantFile:  "config.yaml",
+			wantLine:  1,
+		},
+		{
+			name:      "unversioned base and overlay",
+			base:      "project: demo\n",
+			overlay:   "location: fsn1\n",
+			wantNotes: 1,
+			wantFile:  "config.yaml",
+			wantLine:  0,
+		},
+		{
+			name:      "overlay with apiVersion",
+			base:      "project: demo\n",
+			overlay:   "apiVersion: v1\nlocation: fsn1\n",
+			wantNotes: 1,
+			wantFile:  "config.staging.yaml",
+			wantLine:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfig(t, dir, "config.yaml", tt.base)
+			writeConfig(t, dir, "config.staging.yaml", tt.overlay)
+			t.Chdir(dir)
+
+			logger := &recordingLogger{}
+			loader := NewFileLoader()
+			loader.Logger = logger
+			cfg, err := loader.LoadEnvironment("config.yaml", "staging")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			notes := 0
+			for _, msg := range logger.infos {
+				if strings.Contains(msg, "older format") {
+					notes++
+				}
+			}
+			if notes != tt.wantNotes {
+				t.Errorf("logged %d older-format notes, want %d: %q", notes, tt.wantNotes, logger.infos)
+			}
+			want := Origin{Kind: OriginFile, File: tt.wantFile, Line: tt.wantLine}
+			if got := cfg.Origin("apiVersion"); got != want {
+				t.Errorf("apiVersion origin = %s, want %s", got, want)
+			}
+		})
+	}
+}
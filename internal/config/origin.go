@@ -0,0 +1,56 @@
+package config
+
+import "fmt"
+
+// OriginKind tells which layer a configuration value came from.
+type OriginKind string
+
+// Origin kinds in order of precedence.
+const (
+	OriginDefault OriginKind = "default"
+	OriginFile    OriginKind = "file"
+	OriginEnv     OriginKind = "env"
+)
+
+// Origin records where a configuration value was set.
+type Origin struct {
+	Kind OriginKind
+	// File and Line locate values read from the base or an overlay file.
+	// Line is 0 for values added by a migration.
+	File string
+	Line int
+	// Variable names the environment variable for OriginEnv.
+	Variable string
+}
+
+// String renders the origin as "default", "config.yaml:12" or
+// "env ENDNET_PROJECT".
+func (o Origin) String() string {
+	switch o.Kind {
+	case OriginFile:
+		if o.Line == 0 {
+			return o.File + " (migrated)"
+		}
+		return fmt.Sprintf("%s:%d", o.File, o.Line)
+	case OriginEnv:
+		return "env " + o.Variable
+	default:
+		return string(OriginDefault)
+	}
+}
+
+// Origin returns where the value at the dotted YAML path, e.g.
+// "network.cidr", was set. Values not recorded come from DefaultConfig.
+func (c *Config) Origin(path string) Origin {
+	if o, ok := c.Origins[path]; ok {
+		return o
+	}
+	return Origin{Kind: OriginDefault}
+}
+
+func (c *Config) setOrigin(path string, o Origin) {
+	if c.Origins == nil {
+		c.Origins = make(map[string]Origin)
+	}
+	c.Origins[path] = o
+}
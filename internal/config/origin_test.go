@@ -0,0 +1,68 @@
+package config
+
+import "testing"
+
+func TestOriginString(t *testing.T) {
+	tests := []struct {
+		origin Origin
+		want   string
+	}{
+		{Origin{}, "default"},
+		{Origin{Kind: OriginDefault}, "default"},
+		{Origin{Kind: OriginFile, File: "config.yaml", Line: 12}, "config.yaml:12"},
+		{Origin{Kind: OriginFile, File: "config.yaml"}, "config.yaml (migrated)"},
+		{Origin{Kind: OriginEnv, Variable: "ENDNET_PROJECT"}, "env ENDNET_PROJECT"},
+	}
+	for _, tt := range tests {
+		if got := tt.origin.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestLoadRecordsOrigins(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "config.yaml", `apiVersion: v1
+# The project.
+project: demo
+network:
+  cidr: 10.20.0.0/16
+  subnetCidr: 10.20.0.0/24
+  gatewayIp: 10.20.0.2
+roles:
+  edge:
+    privateIp: 10.20.0.2
+  wg:
+    privateIp: 10.20.0.10
+  forge:
+    privateIp: 10.20.0.20
+`)
+	writeConfig(t, dir, "config.staging.yaml", "network:\n  cidr: 10.20.0.0/15\n")
+	t.Chdir(dir)
+	t.Setenv("ENDNET_LOCATION", "fsn1")
+	t.Setenv("ENDNET_HCLOUD_TOKEN", "token")
+
+	cfg, err := NewLoader().LoadEnvironment("config.yaml", "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want Origin
+	}{
+		{"apiVersion", Origin{Kind: OriginFile, File: "config.yaml", Line: 1}},
+		{"project", Origin{Kind: OriginFile, File: "config.yaml", Line: 3}},
+		{"network.subnetCidr", Origin{Kind: OriginFile, File: "config.yaml", Line: 6}},
+		{"network.cidr", Origin{Kind: OriginFile, File: "config.staging.yaml", Line: 2}},
+		{"location", Origin{Kind: OriginEnv, Variable: "ENDNET_LOCATION"}},
+		{"hetzner.apiToken", Origin{Kind: OriginEnv, Variable: "ENDNET_HCLOUD_TOKEN"}},
+		{"network.name", Origin{Kind: OriginDefault}},
+		{"roles.edge.type", Origin{Kind: OriginDefault}},
+	}
+	for _, tt := range tests {
+		if got := cfg.Origin(tt.path); got != tt.want {
+			t.Errorf("Origin(%q) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// cidrPattern backs the non-standard "cidr" format for validators that do not
+// know it. Like Validate, it accepts IPv4 and IPv6 prefixes.
+const cidrPattern = `^[0-9A-Fa-f:.]+/[0-9]{1,3}$`
+
+// durationPattern matches the durations accepted by time.ParseDuration.
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// Schema returns a JSON Schema (draft 2020-12) describing the configuration
+// file, generated from the Config struct tree. Descriptions come from the
+// desc tags, formats from the format tags and defaults from DefaultConfig.
+// Every object rejects keys the loader does not know, matching
+// FileLoader.Strict, and integer bounds are the ones Validate enforces.
+func Schema() ([]byte, error) {
+	root := objectSchema(reflect.ValueOf(DefaultConfig()).Elem(), "")
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["title"] = "EndNET configuration"
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// objectSchema describes the struct v found at the dotted path prefix.
+func objectSchema(v reflect.Value, prefix string) map[string]any {
+	properties := make(map[string]any)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := yamlName(sf)
+		if name == "" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		var prop map[string]any
+		switch {
+		case isLeaf(sf.Type):
+			prop = leafSchema(sf, v.Field(i), path)
+		case sf.Type.Kind() == reflect.Map:
+			// Entries are named by the user and share the element's schema.
+			prop = map[string]any{
+				"type":                 "object",
+				"additionalProperties": objectSchema(reflect.New(sf.Type.Elem().Elem()).Elem(), path+".*"),
+			}
+		default:
+			prop = objectSchema(v.Field(i), path)
+		}
+		if desc := sf.Tag.Get("desc"); desc != "" {
+			prop["description"] = desc
+		}
+		properties[name] = prop
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func leafSchema(sf reflect.StructField, def reflect.Value, path string) map[string]any {
+	prop := make(map[string]any)
+
+	switch {
+	case sf.Type == secretType:
+		prop["type"] = "string"
+	case sf.Type.Kind() == reflect.Bool:
+		prop["type"] = "boolean"
+		prop["default"] = def.Bool()
+	case sf.Type == durationType:
+		prop["type"] = "string"
+		prop["pattern"] = durationPattern
+		if d := time.Duration(def.Int()); d != 0 {
+			prop["default"] = d.String()
+		}
+	case sf.Type.Kind() == reflect.Int:
+		prop["type"] = "integer"
+		if bound, ok := intMinimum(path); ok {
+			prop["minimum"] = bound
+		}
+		if n := def.Int(); n != 0 {
+			prop["default"] = n
+		}
+	case sf.Type.Kind() == reflect.Slice:
+		prop["type"] = "array"
+		prop["items"] = map[string]any{"type": "string"}
+		if def.Len() > 0 {
+			prop["default"] = def.Interface()
+		}
+	default:
+		prop["type"] = "string"
+		if s := def.String(); s != "" {
+			prop["default"] = s
+		}
+	}
+
+	switch sf.Tag.Get("format") {
+	case "cidr":
+		prop["format"] = "cidr"
+		prop["pattern"] = cidrPattern
+	case "ip":
+		// netip.ParseAddr accepts both address families.
+		prop["anyOf"] = []map[string]any{{"format": "ipv4"}, {"format": "ipv6"}}
+	case "hostname":
+		prop["format"] = "hostname"
+	}
+
+	return prop
+}
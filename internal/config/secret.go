@@ -0,0 +1,223 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"endnet-cli/pkg/util"
+)
+
+// SecretSource resolves secret references of one scheme. ref is the part of
+// the reference after the "scheme:" prefix.
+type SecretSource interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretSourceFunc adapts a function to the SecretSource interface.
+type SecretSourceFunc func(ref string) (string, error)
+
+// Resolve calls f.
+func (f SecretSourceFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// DefaultSecretSources returns the built-in secret sources:
+//
+//	file:<path>               first line of a file, "~/" is expanded
+//	env:<NAME>                value of an environment variable
+//	exec:<command> [args...]  first line of a command's output, e.g. "exec:pass show hcloud"
+//	keyring:<service>/<user>  entry in the system keyring
+func DefaultSecretSources() map[string]SecretSource {
+	return map[string]SecretSource{
+		"file":    SecretSourceFunc(resolveFileSecret),
+		"env":     SecretSourceFunc(resolveEnvSecret),
+		"exec":    SecretSourceFunc(resolveExecSecret),
+		"keyring": SecretSourceFunc(resolveKeyringSecret),
+	}
+}
+
+// Secret is a configuration value that either holds a literal secret or a
+// reference such as "env:HCLOUD_TOKEN". References are resolved on first use
+// and the resolved value is registered for redaction. Copies of a Secret
+// share the resolved value.
+type Secret struct {
+	raw   string
+	state *secretState
+}
+
+type secretState struct {
+	once    sync.Once
+	source  SecretSource
+	ref     string
+	value   string
+	err     error
+	literal bool
+}
+
+// NewSecret parses raw using the given sources. Values without a known scheme
+// prefix are treated as literal secrets and registered for redaction
+// immediately.
+func NewSecret(raw string, sources map[string]SecretSource) Secret {
+	if raw == "" {
+		return Secret{}
+	}
+
+	state := &secretState{literal: true, value: raw}
+	if scheme, ref, ok := strings.Cut(raw, ":"); ok {
+		if source, known := sources[scheme]; known {
+			state = &secretState{source: source, ref: ref}
+		}
+	}
+	if state.literal {
+		util.RegisterSecret(raw)
+	}
+	return Secret{raw: raw, state: state}
+}
+
+// IsSet reports whether a value or reference was configured.
+func (s Secret) IsSet() bool {
+	return s.raw != ""
+}
+
+// IsReference reports whether the secret is resolved from a secret source.
+func (s Secret) IsReference() bool {
+	return s.state != nil && !s.state.literal
+}
+
+// Reference returns the configured reference, or an empty string for literal
+// secrets, so it can be displayed without revealing the secret.
+func (s Secret) Reference() string {
+	if !s.IsReference() {
+		return ""
+	}
+	return s.raw
+}
+
+// Reveal returns the secret value, resolving the reference on first use.
+func (s Secret) Reveal() (string, error) {
+	if s.state == nil {
+		return "", nil
+	}
+
+	st := s.state
+	st.once.Do(func() {
+		if st.literal {
+			return
+		}
+		value, err := st.source.Resolve(st.ref)
+		if err != nil {
+			st.err = fmt.Errorf("resolve secret %s: %w", s.raw, err)
+			return
+		}
+		util.RegisterSecret(value)
+		st.value = value
+	})
+	return st.value, st.err
+}
+
+// ResolveSecrets reveals every configured secret, so references that cannot
+// be resolved are reported before a provider is called and resolved values
+// are registered for redaction before anything is logged. Problems are
+// reported as a *ValidationError.
+func (c *Config) ResolveSecrets() error {
+	v := &validator{}
+	for _, f := range c.fields() {
+		s, ok := f.value.Interface().(Secret)
+		if !ok || !s.IsSet() {
+			continue
+		}
+		if _, err := s.Reveal(); err != nil {
+			v.addf(f.path, "%v", err)
+		}
+	}
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// String implements fmt.Stringer without revealing the secret.
+func (s Secret) String() string {
+	switch {
+	case !s.IsSet():
+		return ""
+	case s.IsReference():
+		return s.raw
+	default:
+		return util.Redacted
+	}
+}
+
+func resolveFileSecret(path string) (string, error) {
+	data, err := os.ReadFile(util.ExpandPath(path))
+	if err != nil {
+		return "", err
+	}
+	return firstLine(data)
+}
+
+func resolveEnvSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+func resolveExecSecret(command string) (string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", errors.New("command must not be empty")
+	}
+	return runSecretCommand(args[0], args[1:]...)
+}
+
+func resolveKeyringSecret(ref string) (string, error) {
+	service, user, ok := strings.Cut(ref, "/")
+	if !ok || service == "" || user == "" {
+		return "", fmt.Errorf("keyring reference %q must have the form <service>/<user>", ref)
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return runSecretCommand("security", "find-generic-password", "-s", service, "-a", user, "-w")
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return runSecretCommand("secret-tool", "lookup", "service", service, "username", user)
+	default:
+		return "", fmt.Errorf("system keyring is not supported on %s", runtime.GOOS)
+	}
+}
+
+// runSecretCommand runs a command and returns the first line of its output.
+// The command gets no input, so it cannot consume a terminal or pipe meant for
+// endnetctl. Its output is never included in errors as it may contain the
+// secret.
+func runSecretCommand(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("run %s: %w", name, err)
+	}
+	return firstLine(out)
+}
+
+func firstLine(data []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			return line, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("secret is empty")
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"endnet-cli/pkg/models"
+)
+
+var (
+	// hostnameLabel is a single RFC 1123 label.
+	hostnameLabel  = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	locationFormat = regexp.MustCompile(`^[a-z]{3}[0-9]*$`)
+	typeFormat     = regexp.MustCompile(`^[a-z]+[0-9]+[a-z]*$`)
+)
+
+// hookKinds are the resource kinds hooks can match.
+var hookKinds = []string{"network", "sshkey", "server", "firewall", "dns"}
+
+// intMinimums are the lower bounds of integer keys, by path pattern as matched
+// by path.Match, with map entries written as "*". The first matching pattern
+// applies. Validate enforces them and Schema publishes them as minimum.
+var intMinimums = []struct {
+	pattern string
+	min     int
+}{
+	{"retry.default.maxAttempts", 1},
+	// Zero inherits the default policy's value.
+	{"retry.*.maxAttempts", 0},
+}
+
+// intMinimum returns the lower bound of the integer key at p.
+func intMinimum(p string) (int, bool) {
+	for _, m := range intMinimums {
+		if ok, _ := path.Match(m.pattern, p); ok {
+			return m.min, true
+		}
+	}
+	return 0, false
+}
+
+// FieldError describes a problem with a single configuration value.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+// Error implements error.
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every problem found by Validate.
+type ValidationError struct {
+	Problems []FieldError
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		problems[i] = p.Error()
+	}
+	noun := "problems"
+	if len(problems) == 1 {
+		noun = "problem"
+	}
+	return fmt.Sprintf("invalid configuration (%d %s): %s", len(problems), noun, strings.Join(problems, "; "))
+}
+
+type validator struct {
+	problems []FieldError
+}
+
+func (v *validator) addf(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(path, value string) bool {
+	if value == "" {
+		v.addf(path, "must not be empty")
+		return false
+	}
+	return true
+}
+
+func (v *validator) prefix(path, value string) (netip.Prefix, bool) {
+	if !v.required(path, value) {
+		return netip.Prefix{}, false
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		v.addf(path, "%q is not a valid CIDR", value)
+		return netip.Prefix{}, false
+	}
+	if prefix.Masked() != prefix {
+		v.addf(path, "%q has host bits set; use %s", value, prefix.Masked())
+	}
+	return prefix.Masked(), true
+}
+
+func (v *validator) hostname(path, value string) {
+	if !v.required(path, value) {
+		return
+	}
+	if len(value) > 253 {
+		v.addf(path, "%q is longer than 253 characters", value)
+		return
+	}
+	for _, label := range strings.Split(value, ".") {
+		if !hostnameLabel.MatchString(label) {
+			v.addf(path, "%q is not a valid RFC 1123 hostname", value)
+			return
+		}
+	}
+}
+
+// Validate checks the configuration for semantic problems and reports all of
+// them at once as a *ValidationError.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	if c.APIVersion != CurrentAPIVersion {
+		v.addf("apiVersion", "%q is not supported; expected %s", c.APIVersion, CurrentAPIVersion)
+	}
+	v.required("project", c.Project)
+	if v.required("location", c.Location) && !locationFormat.MatchString(c.Location) {
+		v.addf("location", "%q is not a Hetzner location such as nbg1 or fsn1", c.Location)
+	}
+
+	v.required("network.name", c.Network.Name)
+	network, networkOK := v.prefix("network.cidr", c.Network.CIDR)
+	subnet, subnetOK := v.prefix("network.subnetCidr", c.Network.SubnetCIDR)
+	if networkOK && subnetOK && (subnet.Bits() < network.Bits() || !network.Contains(subnet.Addr())) {
+		v.addf("network.subnetCidr", "%s is not inside network.cidr %s", subnet, network)
+	}
+
+	roles := []struct {
+		path string
+		node NodeConfig
+	}{
+		{"roles.edge", c.Roles.Edge},
+		{"roles.wg", c.Roles.WG},
+		{"roles.forge", c.Roles.Forge},
+	}
+
+	// Hetzner reserves the first address of every subnet for its gateway.
+	var reserved netip.Addr
+	if subnetOK {
+		reserved = subnet.Addr().Next()
+	}
+
+	usedIPs := make(map[netip.Addr]string)
+	usedNames := make(map[string]string)
+	gatewayMatched := false
+	for _, role := range roles {
+		node := role.node
+		// Only the edge role is mandatory; other roles are skipped when unnamed.
+		if node.Name == "" && role.path != "roles.edge" {
+			continue
+		}
+
+		v.hostname(role.path+".name", node.Name)
+		if other, ok := usedNames[node.Name]; ok && node.Name != "" {
+			v.addf(role.path+".name", "%q is already used by %s", node.Name, other)
+		}
+		usedNames[node.Name] = role.path
+
+		if v.required(role.path+".type", node.Type) && !typeFormat.MatchString(node.Type) {
+			v.addf(role.path+".type", "%q is not a Hetzner server type such as cx23", node.Type)
+		}
+		v.required(role.path+".image", node.Image)
+
+		path := role.path + ".privateIp"
+		if !v.required(path, node.PrivateIP) {
+			continue
+		}
+		ip, err := netip.ParseAddr(node.PrivateIP)
+		if err != nil {
+			v.addf(path, "%q is not a valid IP address", node.PrivateIP)
+			continue
+		}
+		if subnetOK && !subnet.Contains(ip) {
+			v.addf(path, "%s is not inside network.subnetCidr %s", ip, subnet)
+		}
+		if ip == reserved {
+			v.addf(path, "%s is reserved for the Hetzner network gateway", ip)
+		}
+		if other, ok := usedIPs[ip]; ok {
+			v.addf(path, "%s is already assigned to %s", ip, other)
+		}
+		usedIPs[ip] = role.path
+
+		if node.PrivateIP == c.Network.GatewayIP && node.HasPublicIP {
+			gatewayMatched = true
+		}
+	}
+
+	if v.required("network.gatewayIp", c.Network.GatewayIP) {
+		if _, err := netip.ParseAddr(c.Network.GatewayIP); err != nil {
+			v.addf("network.gatewayIp", "%q is not a valid IP address", c.Network.GatewayIP)
+		} else if !gatewayMatched {
+			v.addf("network.gatewayIp", "%s does not match the privateIp of a role with publicIp enabled", c.Network.GatewayIP)
+		}
+	}
+
+	v.hostname("dns.rootDomain", c.DNS.RootDomain)
+	if c.DNS.ForgejoHost != "" {
+		v.hostname("dns.forgejoHost", c.DNS.ForgejoHost)
+		if c.DNS.RootDomain != "" && !strings.HasSuffix(c.DNS.ForgejoHost, "."+c.DNS.RootDomain) {
+			v.addf("dns.forgejoHost", "%q is not under dns.rootDomain %q", c.DNS.ForgejoHost, c.DNS.RootDomain)
+		}
+	}
+
+	retries := []struct {
+		path   string
+		policy RetryPolicyConfig
+	}{
+		{"retry.default", c.Retry.Default},
+		{"retry.network", c.Retry.Network},
+		{"retry.sshKey", c.Retry.SSHKey},
+		{"retry.server", c.Retry.Server},
+		{"retry.firewall", c.Retry.Firewall},
+		{"retry.dns", c.Retry.DNS},
+	}
+	for _, r := range retries {
+		if r.policy.InitialDelay < 0 {
+			v.addf(r.path+".initialDelay", "must not be negative")
+		}
+		if r.policy.MaxDelay < 0 {
+			v.addf(r.path+".maxDelay", "must not be negative")
+		}
+	}
+	for _, f := range c.fields() {
+		if f.value.Kind() != reflect.Int || f.value.Type() == durationType {
+			continue
+		}
+		bound, ok := intMinimum(f.path)
+		switch {
+		case !ok || f.value.Int() >= int64(bound):
+		case bound == 0:
+			v.addf(f.path, "must not be negative")
+		default:
+			v.addf(f.path, "must be at least %d", bound)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Hooks)) {
+		h, prefix := c.Hooks[name], "hooks."+name
+		if h.When != models.HookBefore && h.When != models.HookAfter {
+			v.addf(prefix+".when", "must be before or after, not %q", h.When)
+		}
+		if h.Kind != "" && !slices.Contains(hookKinds, h.Kind) {
+			v.addf(prefix+".kind", "%q is not one of %s", h.Kind, strings.Join(hookKinds, ", "))
+		}
+		if _, err := path.Match(h.Target, ""); err != nil {
+			v.addf(prefix+".target", "%q is not a valid glob", h.Target)
+		}
+		if strings.TrimSpace(h.Command) == "" {
+			v.addf(prefix+".command", "is required")
+		}
+		if h.Timeout < 0 {
+			v.addf(prefix+".timeout", "must not be negative")
+		}
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestStrictLoadReportsEveryProblem(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []FieldError
+	}{
+		{
+			name:    "known keys",
+			content: "apiVersion: v1\nproject: demo\nnetwork:\n  name: demo\n",
+		},
+		{
+			name:    "unknown keys",
+			content: "apiVersion: v1\nprojekt: demo\nnetwork:\n  nme: demo\n",
+			want: []FieldError{
+				{Path: "projekt", Message: "unknown key (config.yaml:2)"},
+				{Path: "network.nme", Message: "unknown key (config.yaml:4)"},
+			},
+		},
+		{
+			name:    "value where a section is expected",
+			content: "apiVersion: v1\nnetwork: demo\n",
+			want:    []FieldError{{Path: "network", Message: "is a section and cannot have a value (config.yaml:2)"}},
+		},
+		{
+			name:    "section where a value is expected",
+			content: "apiVersion: v1\nproject:\n  name: demo\n",
+			want: []FieldError{
+				{Path: "project", Message: "expects a value (config.yaml:2)"},
+				{Path: "project.name", Message: "unknown key (config.yaml:3)"},
+			},
+		},
+		{
+			name:    "hook entries may have any name",
+			content: "apiVersion: v1\nhooks:\n  notify:\n    when: after\n    command: true\n    retries: 3\n",
+			want:    []FieldError{{Path: "hooks.notify.retries", Message: "unknown key (config.yaml:6)"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfig(t, dir, "config.yaml", tt.content)
+			t.Chdir(dir)
+
+			loader := NewFileLoader()
+			loader.Strict = true
+			_, err := loader.Load("config.yaml")
+
+			var verr *ValidationError
+			switch {
+			case tt.want == nil && err != nil:
+				t.Fatalf("Load: %v", err)
+			case tt.want == nil:
+			case !errors.As(err, &verr):
+				t.Fatalf("Load error = %v, want a *ValidationError", err)
+			case !slices.Equal(verr.Problems, tt.want):
+				t.Fatalf("problems = %q, want %q", verr.Problems, tt.want)
+			}
+
+			// Without Strict the same files load.
+			if _, err := NewFileLoader().Load("config.yaml"); err != nil {
+				t.Fatalf("non-strict Load: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateIntMinimums(t *testing.T) {
+	tests := []struct {
+		path  string
+		value string
+		want  string
+	}{
+		{"retry.default.maxAttempts", "1", ""},
+		{"retry.default.maxAttempts", "0", "must be at least 1"},
+		{"retry.dns.maxAttempts", "0", ""},
+		{"retry.dns.maxAttempts", "-1", "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+"="+tt.value, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if err := cfg.Set(tt.path, tt.value); err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			var verr *ValidationError
+			if err := cfg.Validate(); errors.As(err, &verr) {
+				for _, p := range verr.Problems {
+					if p.Path == tt.path {
+						got = p.Message
+					}
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("problem = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaMatchesValidate(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(path ...string) map[string]any {
+		node := schema
+		for _, key := range path {
+			node = node["properties"].(map[string]any)[key].(map[string]any)
+		}
+		return node
+	}
+
+	for kind, want := range map[string]float64{"default": 1, "dns": 0} {
+		got, ok := lookup("retry", kind, "maxAttempts")["minimum"]
+		if !ok || got != want {
+			t.Errorf("retry.%s.maxAttempts minimum = %v, want %v", kind, got, want)
+		}
+	}
+
+	// Validate accepts IPv6 as well.
+	gateway := lookup("network", "gatewayIp")
+	if gateway["format"] == "ipv4" {
+		t.Errorf("network.gatewayIp is restricted to IPv4: %v", gateway)
+	}
+	if _, ok := gateway["anyOf"]; !ok {
+		t.Errorf("network.gatewayIp does not allow both address families: %v", gateway)
+	}
+}
@@ -0,0 +1,220 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+
+	"endnet-cli/pkg/util"
+)
+
+// Prefix marks encrypted configuration values.
+const Prefix = "enc:"
+
+// Environment variables consulted by KeysFromEnv.
+const (
+	EnvIdentity   = "ENDNET_SECRET_IDENTITY"
+	EnvPassphrase = "ENDNET_SECRET_PASSPHRASE"
+	EnvRecipients = "ENDNET_SECRET_RECIPIENTS"
+)
+
+// Keys holds the identities used to decrypt values and the recipients used to
+// encrypt them.
+type Keys struct {
+	Identities []age.Identity
+	Recipients []age.Recipient
+}
+
+// IsEncrypted reports whether value carries the encrypted value prefix.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encrypt encrypts plaintext to the recipients and returns an "enc:" value
+// that fits on a single configuration line.
+func Encrypt(plaintext string, recipients ...age.Recipient) (string, error) {
+	if len(recipients) == 0 {
+		return "", errors.New("no recipients configured")
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(w, plaintext); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return Prefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// Decrypt decrypts an "enc:" value with any of the identities.
+func Decrypt(value string, identities ...age.Identity) (string, error) {
+	if !IsEncrypted(value) {
+		return "", fmt.Errorf("value does not start with %q", Prefix)
+	}
+	if len(identities) == 0 {
+		return "", fmt.Errorf("no identity configured; set %s or %s", EnvIdentity, EnvPassphrase)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil {
+		return "", fmt.Errorf("decode encrypted value: %w", err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), identities...)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// LoadIdentities reads an age identity file or an OpenSSH private key.
+func LoadIdentities(path string) ([]age.Identity, error) {
+	data, err := os.ReadFile(util.ExpandPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("read identity: %w", err)
+	}
+
+	if bytes.Contains(data, []byte("PRIVATE KEY-----")) {
+		identity, err := agessh.ParseIdentity(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse ssh identity %s: %w", path, err)
+		}
+		return []age.Identity{identity}, nil
+	}
+
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse age identity %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// ParseRecipient parses an age recipient ("age1..."), an SSH public key or
+// the path of a file listing recipients, one per line.
+func ParseRecipient(value string) ([]age.Recipient, error) {
+	switch {
+	case strings.HasPrefix(value, "age1"):
+		recipient, err := age.ParseX25519Recipient(value)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{recipient}, nil
+	case strings.HasPrefix(value, "ssh-"):
+		recipient, err := agessh.ParseRecipient(value)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{recipient}, nil
+	}
+
+	data, err := os.ReadFile(util.ExpandPath(value))
+	if err != nil {
+		return nil, fmt.Errorf("recipient %q is neither a key nor a readable file: %w", value, err)
+	}
+	var recipients []age.Recipient
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "age1") && !strings.HasPrefix(line, "ssh-") {
+			return nil, fmt.Errorf("recipient file %s: unsupported recipient %q", value, line)
+		}
+		parsed, err := ParseRecipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("recipient file %s: %w", value, err)
+		}
+		recipients = append(recipients, parsed...)
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("recipient file %s lists no recipients", value)
+	}
+	return recipients, nil
+}
+
+// PassphraseKeys returns keys that encrypt and decrypt with a passphrase.
+func PassphraseKeys(passphrase string) (Keys, error) {
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return Keys{}, err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return Keys{}, err
+	}
+	return Keys{Identities: []age.Identity{identity}, Recipients: []age.Recipient{recipient}}, nil
+}
+
+// KeysFromEnv builds keys from the ENDNET_SECRET_* environment variables.
+// Identities come from the identity file and the passphrase. Recipients are
+// taken from ENDNET_SECRET_RECIPIENTS (comma separated) when set, otherwise
+// they are derived from the identity file, falling back to the passphrase.
+func KeysFromEnv() (Keys, error) {
+	var keys Keys
+
+	if path := os.Getenv(EnvIdentity); path != "" {
+		identities, err := LoadIdentities(path)
+		if err != nil {
+			return Keys{}, err
+		}
+		keys.Identities = append(keys.Identities, identities...)
+		keys.Recipients = append(keys.Recipients, recipientsOf(identities)...)
+	}
+
+	if passphrase := os.Getenv(EnvPassphrase); passphrase != "" {
+		pass, err := PassphraseKeys(passphrase)
+		if err != nil {
+			return Keys{}, err
+		}
+		keys.Identities = append(keys.Identities, pass.Identities...)
+		// A passphrase cannot be combined with other recipients.
+		if len(keys.Recipients) == 0 {
+			keys.Recipients = pass.Recipients
+		}
+	}
+
+	if list := os.Getenv(EnvRecipients); list != "" {
+		keys.Recipients = nil
+		for _, value := range strings.Split(list, ",") {
+			recipients, err := ParseRecipient(strings.TrimSpace(value))
+			if err != nil {
+				return Keys{}, err
+			}
+			keys.Recipients = append(keys.Recipients, recipients...)
+		}
+	}
+
+	return keys, nil
+}
+
+// recipientsOf returns the recipients matching identities whose public part
+// is known.
+func recipientsOf(identities []age.Identity) []age.Recipient {
+	var recipients []age.Recipient
+	for _, identity := range identities {
+		switch id := identity.(type) {
+		case *age.X25519Identity:
+			recipients = append(recipients, id.Recipient())
+		case *agessh.Ed25519Identity:
+			recipients = append(recipients, id.Recipient())
+		case *agessh.RSAIdentity:
+			recipients = append(recipients, id.Recipient())
+		}
+	}
+	return recipients
+}
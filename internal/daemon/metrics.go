@@ -0,0 +1,130 @@
+package daemon
+
+import (
+	"strings"
+	"time"
+
+	"endnet-cli/internal/metrics"
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+)
+
+// reconcilerMetrics are the Prometheus metrics of a reconciler, served on
+// /metrics by NewHandler.
+type reconcilerMetrics struct {
+	registry *metrics.Registry
+
+	planOperations   *metrics.Gauge
+	drift            *metrics.Gauge
+	applyDuration    *metrics.Histogram
+	applyFailures    *metrics.Counter
+	providerDuration *metrics.Histogram
+	providerErrors   *metrics.Counter
+	runs             *metrics.Counter
+	runDuration      *metrics.Histogram
+	running          *metrics.Gauge
+	lastSuccess      *metrics.Gauge
+	approvals        *metrics.Gauge
+}
+
+func newReconcilerMetrics() *reconcilerMetrics {
+	r := metrics.NewRegistry()
+	m := &reconcilerMetrics{
+		registry: r,
+		planOperations: r.NewGauge("endnet_plan_operations",
+			"Operations of the latest plan by action and resource kind.", "action", "kind"),
+		drift: r.NewGauge("endnet_drift_severity",
+			"Drifted resources of the latest plan: 1 cosmetic, 2 functional, 3 security.", "kind", "resource"),
+		applyDuration: r.NewHistogram("endnet_apply_duration_seconds",
+			"Duration of applied and failed operations.", metrics.DefaultBuckets, "action", "kind"),
+		applyFailures: r.NewCounter("endnet_apply_failures_total",
+			"Operations that failed to apply.", "action", "kind"),
+		providerDuration: r.NewHistogram("endnet_provider_request_duration_seconds",
+			"Latency of provider API calls, one observation per attempt.", metrics.DefaultBuckets, "provider", "endpoint"),
+		providerErrors: r.NewCounter("endnet_provider_request_errors_total",
+			"Provider API calls that returned an error.", "provider", "endpoint"),
+		runs: r.NewCounter("endnet_reconcile_runs_total",
+			"Reconcile runs by result.", "result"),
+		runDuration: r.NewHistogram("endnet_reconcile_duration_seconds",
+			"Duration of reconcile runs by result.", metrics.DefaultBuckets, "result"),
+		running: r.NewGauge("endnet_reconcile_running",
+			"1 while a reconcile run is in progress."),
+		lastSuccess: r.NewGauge("endnet_reconcile_last_success_timestamp_seconds",
+			"Unix time the last successful reconcile run completed."),
+		approvals: r.NewGauge("endnet_approvals",
+			"Queued approvals by status.", "status"),
+	}
+	for _, result := range []string{RunSucceeded, RunFailed, RunNoChanges, RunBlocked, RunInterrupted} {
+		m.runs.Add(0, result)
+	}
+	return m
+}
+
+// observePlan records the operation counts and the drift of plan.
+func (m *reconcilerMetrics) observePlan(plan *models.Plan) {
+	counts := make(map[[2]string]int)
+	for _, op := range plan.Operations() {
+		counts[[2]string{op.Type, op.Kind()}]++
+	}
+	m.planOperations.Reset()
+	for key, n := range counts {
+		m.planOperations.Set(float64(n), key[0], key[1])
+	}
+
+	drift, _ := tasks.DetectDrift(plan, nil)
+	m.drift.Reset()
+	for _, d := range drift {
+		_, name, _ := strings.Cut(d.Operation.Target, ":")
+		m.drift.Set(float64(d.Severity), d.Operation.Kind(), name)
+	}
+}
+
+// observeResult records the durations and failures of the operations of an
+// execution.
+func (m *reconcilerMetrics) observeResult(result *models.ExecutionResult) {
+	for _, r := range result.Operations {
+		if !r.Operation.Actionable() {
+			continue
+		}
+		switch r.Status {
+		case models.OperationFailed:
+			m.applyFailures.Inc(r.Operation.Type, r.Operation.Kind())
+		case models.OperationApplied:
+		default:
+			continue
+		}
+		m.applyDuration.Observe(r.Duration().Seconds(), r.Operation.Type, r.Operation.Kind())
+	}
+}
+
+// observeProviderCall records the latency and error of a provider API call.
+func (m *reconcilerMetrics) observeProviderCall(provider, endpoint string, elapsed time.Duration, err error) {
+	m.providerDuration.Observe(elapsed.Seconds(), provider, endpoint)
+	if err != nil {
+		m.providerErrors.Inc(provider, endpoint)
+	}
+}
+
+// observeRun records the result and duration of a reconcile run that
+// completed at completed. Runs blocked by approvals count as successful: the
+// daemon works and waits for people.
+func (m *reconcilerMetrics) observeRun(result string, completed time.Time, duration time.Duration) {
+	m.runs.Inc(result)
+	m.runDuration.Observe(duration.Seconds(), result)
+	if result == RunSucceeded || result == RunNoChanges || result == RunBlocked {
+		m.lastSuccess.Set(float64(completed.UnixNano()) / 1e9)
+	}
+}
+
+// refresh updates the metrics read from the reconciler's state before they
+// are served.
+func (m *reconcilerMetrics) refresh(r *Reconciler) {
+	running := 0.0
+	if r.Status().Running {
+		running = 1
+	}
+	m.running.Set(running)
+	for status, n := range r.Queue.Counts() {
+		m.approvals.Set(float64(n), status)
+	}
+}
@@ -0,0 +1,191 @@
+package daemon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+// Approval statuses.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// Approval is an operation the reconciler may not apply on its own. It is
+// applied once approved and dropped when a later plan no longer contains it.
+// Rejected operations are not applied and stay rejected while planned.
+type Approval struct {
+	ID        string           `json:"id"`
+	Operation models.Operation `json:"operation"`
+	Status    string           `json:"status"`
+	QueuedAt  time.Time        `json:"queuedAt"`
+	DecidedAt time.Time        `json:"decidedAt,omitzero"`
+}
+
+// ErrUnknownApproval is returned for approval IDs that are not queued.
+var ErrUnknownApproval = errors.New("no such approval")
+
+// OperationID identifies an operation across plans. It changes when the
+// operation's type or changes do, so an approval only covers what was
+// reviewed.
+func OperationID(op models.Operation) string {
+	data, _ := json.Marshal(struct {
+		Type    string
+		Target  string
+		Changes []models.Change
+	}{op.Type, op.Target, op.Changes})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// ApprovalQueue holds the operations awaiting approval. It is saved to its
+// file after every change so approvals survive restarts.
+type ApprovalQueue struct {
+	path  string
+	mu    sync.Mutex
+	items []*Approval
+}
+
+// OpenApprovalQueue loads the queue saved at path; a missing file is an empty
+// queue.
+func OpenApprovalQueue(path string) (*ApprovalQueue, error) {
+	q := &ApprovalQueue{path: path}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return q, nil
+	case err != nil:
+		return nil, fmt.Errorf("read approval queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &q.items); err != nil {
+		return nil, fmt.Errorf("parse approval queue %s: %w", path, err)
+	}
+	return q, nil
+}
+
+// Sync makes the queue match ops, the operations of the current plan that
+// need approval: new operations are queued as pending and entries no longer
+// planned are dropped. It returns the IDs of the approved operations.
+func (q *ApprovalQueue) Sync(ops []models.Operation) (map[string]bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	planned := make(map[string]models.Operation, len(ops))
+	for _, op := range ops {
+		planned[OperationID(op)] = op
+	}
+
+	var items []*Approval
+	approved := make(map[string]bool)
+	for _, item := range q.items {
+		if _, ok := planned[item.ID]; !ok {
+			continue
+		}
+		items = append(items, item)
+		delete(planned, item.ID)
+		if item.Status == ApprovalApproved {
+			approved[item.ID] = true
+		}
+	}
+	now := time.Now().UTC()
+	for _, op := range ops {
+		id := OperationID(op)
+		if _, ok := planned[id]; ok {
+			items = append(items, &Approval{ID: id, Operation: op, Status: ApprovalPending, QueuedAt: now})
+			delete(planned, id)
+		}
+	}
+
+	q.items = items
+	return approved, q.save()
+}
+
+// List returns a copy of the queued approvals in the order they were queued.
+func (q *ApprovalQueue) List() []Approval {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]Approval, 0, len(q.items))
+	for _, item := range q.items {
+		list = append(list, *item)
+	}
+	return list
+}
+
+// Decide approves or rejects the queued operation with the given ID.
+func (q *ApprovalQueue) Decide(id string, approve bool) (Approval, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.IndexFunc(q.items, func(a *Approval) bool { return a.ID == id })
+	if i < 0 {
+		return Approval{}, fmt.Errorf("%w: %s", ErrUnknownApproval, id)
+	}
+	item := q.items[i]
+	item.Status = ApprovalRejected
+	if approve {
+		item.Status = ApprovalApproved
+	}
+	item.DecidedAt = time.Now().UTC()
+	return *item, q.save()
+}
+
+// Remove drops the approvals of applied operations.
+func (q *ApprovalQueue) Remove(ids map[string]bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = slices.DeleteFunc(q.items, func(a *Approval) bool { return ids[a.ID] })
+	return q.save()
+}
+
+// Counts returns the number of queued approvals per status.
+func (q *ApprovalQueue) Counts() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	counts := map[string]int{ApprovalPending: 0, ApprovalApproved: 0, ApprovalRejected: 0}
+	for _, item := range q.items {
+		counts[item.Status]++
+	}
+	return counts
+}
+
+// save writes the queue to its file through a temporary file, so a crash
+// never leaves a partial queue behind. The caller holds q.mu.
+func (q *ApprovalQueue) save() error {
+	if q.path == "" {
+		return nil
+	}
+	items := q.items
+	if items == nil {
+		items = []*Approval{}
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o700); err != nil {
+		return fmt.Errorf("create approval queue directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), "."+filepath.Base(q.path)+".*")
+	if err != nil {
+		return fmt.Errorf("save approval queue: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save approval queue: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save approval queue: %w", err)
+	}
+	return os.Rename(tmp.Name(), q.path)
+}
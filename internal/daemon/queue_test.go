@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"path/filepath"
+	"testing"
+
+	"endnet-cli/pkg/models"
+)
+
+func TestApprovalQueueSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "approvals.json")
+	q, err := OpenApprovalQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := models.Operation{Type: "create", Target: "server:a", Changes: []models.Change{{Field: "type", After: "cx23"}}}
+	firewall := models.Operation{Type: "reconcile", Target: "firewall:f"}
+	record := models.Operation{Type: "update", Target: "dns:A a", Changes: []models.Change{{Field: "value", After: "192.0.2.1"}}}
+
+	approved, err := q.Sync([]models.Operation{server, firewall, record})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(approved) != 0 {
+		t.Fatalf("approved = %v, want none", approved)
+	}
+	if counts := q.Counts(); counts[ApprovalPending] != 3 {
+		t.Fatalf("counts = %v, want 3 pending", counts)
+	}
+	if _, err := q.Decide(OperationID(server), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Decide(OperationID(firewall), false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The queue is read back from its file, as after a restart. The DNS
+	// record now has a different change and the firewall is planned no
+	// more.
+	q, err = OpenApprovalQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := record
+	changed.Changes = []models.Change{{Field: "value", After: "192.0.2.2"}}
+	approved, err = q.Sync([]models.Operation{server, changed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(approved) != 1 || !approved[OperationID(server)] {
+		t.Fatalf("approved = %v, want only %s", approved, OperationID(server))
+	}
+
+	list := q.List()
+	want := []struct{ id, status string }{
+		{OperationID(server), ApprovalApproved},
+		{OperationID(changed), ApprovalPending},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("queue = %+v, want %d entries", list, len(want))
+	}
+	for i, w := range want {
+		if list[i].ID != w.id || list[i].Status != w.status {
+			t.Errorf("entry %d = %s %s, want %s %s", i, list[i].ID, list[i].Status, w.id, w.status)
+		}
+	}
+
+	if err := q.Remove(approved); err != nil {
+		t.Fatal(err)
+	}
+	if counts := q.Counts(); counts[ApprovalApproved] != 0 || counts[ApprovalPending] != 1 {
+		t.Fatalf("counts after removing the applied approval = %v", counts)
+	}
+}
+
+func TestApprovalQueueKeepsRejection(t *testing.T) {
+	q, err := OpenApprovalQueue(filepath.Join(t.TempDir(), "approvals.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := models.Operation{Type: "delete", Target: "server:a"}
+	if _, err := q.Sync([]models.Operation{op}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Decide(OperationID(op), false); err != nil {
+		t.Fatal(err)
+	}
+	approved, err := q.Sync([]models.Operation{op})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(approved) != 0 || q.List()[0].Status != ApprovalRejected {
+		t.Fatalf("approved = %v, queue = %+v; want the operation to stay rejected", approved, q.List())
+	}
+	if _, err := q.Decide("unknown", true); err == nil {
+		t.Fatal("deciding an unknown approval succeeded")
+	}
+}
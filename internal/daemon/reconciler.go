@@ -0,0 +1,346 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+	"endnet-cli/pkg/util"
+)
+
+// Run results reported in Status. RunBlocked means the plan has changes but
+// none could be applied because each awaits an approval, its own or that of
+// a dependency.
+const (
+	RunSucceeded   = "succeeded"
+	RunFailed      = "failed"
+	RunNoChanges   = "no-changes"
+	RunBlocked     = "blocked-by-approval"
+	RunInterrupted = "interrupted"
+)
+
+// Rule allows operations to be applied without approval. Kind and Type match
+// models.Operation.Kind and Type; "*" matches any value.
+type Rule struct {
+	Kind string
+	Type string
+}
+
+// ParseRule parses a rule written as kind:type, e.g. "dns:update" or
+// "firewall:*".
+func ParseRule(s string) (Rule, error) {
+	kind, typ, ok := strings.Cut(s, ":")
+	if !ok || kind == "" || typ == "" {
+		return Rule{}, fmt.Errorf("auto-apply rule %q is not of the form kind:type, e.g. dns:update", s)
+	}
+	return Rule{Kind: kind, Type: typ}, nil
+}
+
+// Matches reports whether the rule allows op.
+func (r Rule) Matches(op models.Operation) bool {
+	return (r.Kind == "*" || r.Kind == op.Kind()) && (r.Type == "*" || r.Type == op.Type)
+}
+
+func (r Rule) String() string {
+	return r.Kind + ":" + r.Type
+}
+
+// LoadFunc reads the configuration and plans the changes for one run. It is
+// called for every run, so configuration changes are picked up.
+type LoadFunc func(ctx context.Context) (*config.Config, *models.Plan, error)
+
+// ExecutorFunc returns the executor applying the plan of a run.
+type ExecutorFunc func(cfg *config.Config) (tasks.Executor, error)
+
+// Status describes the reconciler's runs.
+type Status struct {
+	Runs          int
+	Failures      int
+	Applied       int
+	Running       bool
+	LastStarted   time.Time
+	LastCompleted time.Time
+	LastDuration  time.Duration
+	LastResult    string
+	LastError     string
+	NextRun       time.Time
+}
+
+// Reconciler periodically plans and applies the allowed operations. Other
+// operations are queued for approval and applied by the first run after they
+// were approved. Only one run happens at a time; runs requested while one is
+// in progress are coalesced into a single follow-up run.
+type Reconciler struct {
+	Load        LoadFunc
+	NewExecutor ExecutorFunc
+	Queue       *ApprovalQueue
+	// AutoApply lists the operations applied without approval.
+	AutoApply []Rule
+	// Interval is the time between runs, varied randomly by up to Jitter
+	// (a fraction such as 0.1) in either direction so several daemons do
+	// not hit the provider APIs at the same time.
+	Interval time.Duration
+	Jitter   float64
+	// RunTimeout aborts a run that takes longer; 0 means no limit.
+	RunTimeout time.Duration
+	// ShutdownTimeout bounds how long a run in progress may continue after
+	// the context passed to Run was cancelled before it is aborted.
+	ShutdownTimeout time.Duration
+
+	logger  util.Logger
+	metrics *reconcilerMetrics
+	trigger chan struct{}
+	running sync.Mutex
+	mu      sync.Mutex
+	status  Status
+}
+
+// NewReconciler returns a reconciler using logger.
+func NewReconciler(logger util.Logger, load LoadFunc, newExecutor ExecutorFunc, queue *ApprovalQueue) *Reconciler {
+	if logger == nil {
+		logger = util.NewLogger()
+	}
+	return &Reconciler{
+		Load:            load,
+		NewExecutor:     newExecutor,
+		Queue:           queue,
+		Interval:        10 * time.Minute,
+		ShutdownTimeout: time.Minute,
+		logger:          logger,
+		metrics:         newReconcilerMetrics(),
+		trigger:         make(chan struct{}, 1),
+	}
+}
+
+// ObserveProviderCall records a provider API call in the metrics; it suits
+// the Observe hooks of the provider clients.
+func (r *Reconciler) ObserveProviderCall(provider, endpoint string, elapsed time.Duration, err error) {
+	r.metrics.observeProviderCall(provider, endpoint, elapsed, err)
+}
+
+// Trigger requests a run as soon as possible.
+func (r *Reconciler) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+		// A run is already requested.
+	}
+}
+
+// Status returns a snapshot of the reconciler's status.
+func (r *Reconciler) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Run reconciles at once and then every interval until ctx is cancelled. A
+// run in progress at that time may finish within ShutdownTimeout.
+func (r *Reconciler) Run(ctx context.Context) {
+	runCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+	defer abort()
+	stop := context.AfterFunc(ctx, func() {
+		if r.Status().Running {
+			r.logger.Info("waiting for the running reconcile to finish", "timeout", r.ShutdownTimeout)
+		}
+		time.AfterFunc(r.ShutdownTimeout, abort)
+	})
+	defer stop()
+
+	for ctx.Err() == nil {
+		r.RunOnce(runCtx)
+
+		delay := r.nextDelay()
+		r.mu.Lock()
+		r.status.NextRun = time.Now().Add(delay)
+		r.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		case <-r.trigger:
+		}
+		timer.Stop()
+	}
+}
+
+// nextDelay returns the interval with jitter applied.
+func (r *Reconciler) nextDelay() time.Duration {
+	if r.Jitter <= 0 {
+		return r.Interval
+	}
+	spread := time.Duration(float64(r.Interval) * min(r.Jitter, 1))
+	return r.Interval - spread + rand.N(2*spread+1)
+}
+
+// RunOnce plans and applies the allowed and approved operations once. It
+// returns false without doing anything when another run is in progress.
+func (r *Reconciler) RunOnce(ctx context.Context) bool {
+	if !r.running.TryLock() {
+		r.logger.Info("reconcile already running; skipping")
+		return false
+	}
+	defer r.running.Unlock()
+
+	if r.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.RunTimeout)
+		defer cancel()
+	}
+
+	started := time.Now()
+	r.mu.Lock()
+	r.status.Running = true
+	r.status.LastStarted = started
+	r.mu.Unlock()
+
+	applied, result, err := r.reconcile(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &r.status
+	s.Running = false
+	s.Runs++
+	s.Applied += applied
+	s.LastCompleted = time.Now()
+	s.LastDuration = s.LastCompleted.Sub(started)
+	s.LastResult, s.LastError = result, ""
+	r.metrics.observeRun(result, s.LastCompleted, s.LastDuration)
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+		r.logger.Error("reconcile failed", "error", err, "duration", s.LastDuration)
+	} else {
+		r.logger.Info("reconcile finished", "result", result, "applied", applied, "duration", s.LastDuration)
+	}
+	return true
+}
+
+// reconcile performs a run and returns the number of applied operations and
+// the run's result.
+func (r *Reconciler) reconcile(ctx context.Context) (int, string, error) {
+	cfg, plan, err := r.Load(ctx)
+	if err != nil {
+		return 0, RunFailed, err
+	}
+	r.metrics.observePlan(plan)
+
+	var needApproval []models.Operation
+	for _, op := range plan.Operations() {
+		if op.Actionable() && !r.allowed(op) {
+			needApproval = append(needApproval, op)
+		}
+	}
+	approved, err := r.Queue.Sync(needApproval)
+	if err != nil {
+		return 0, RunFailed, err
+	}
+	if counts := r.Queue.Counts(); counts[ApprovalPending] > 0 {
+		r.logger.Info("operations awaiting approval", "pending", counts[ApprovalPending])
+	}
+
+	// A run whose only selected operations are verifications is blocked
+	// when the changes they precede await approval.
+	selected := r.selectOperations(plan, approved)
+	changes := 0
+	for _, op := range plan.Operations() {
+		if selected[op.Target] && op.Type != "verify" {
+			changes++
+		}
+	}
+	switch {
+	case changes > 0:
+	case len(needApproval) > 0:
+		return 0, RunBlocked, nil
+	case len(selected) == 0:
+		return 0, RunNoChanges, nil
+	}
+
+	executor, err := r.NewExecutor(cfg)
+	if err != nil {
+		return 0, RunFailed, err
+	}
+	result, err := executor.Execute(ctx, plan.Filter(func(op models.Operation) bool {
+		return !op.Actionable() || selected[op.Target]
+	}))
+	applied := 0
+	appliedApprovals := make(map[string]bool)
+	if result != nil {
+		r.metrics.observeResult(result)
+		for _, op := range result.AppliedOperations {
+			if op.Actionable() {
+				applied++
+			}
+			if id := OperationID(op); approved[id] {
+				appliedApprovals[id] = true
+			}
+		}
+	}
+	if qerr := r.Queue.Remove(appliedApprovals); qerr != nil {
+		err = errors.Join(err, qerr)
+	}
+
+	switch {
+	case err == nil:
+		return applied, RunSucceeded, nil
+	case ctx.Err() != nil:
+		return applied, RunInterrupted, err
+	default:
+		return applied, RunFailed, err
+	}
+}
+
+// selectOperations returns the targets of the actionable operations to apply:
+// the allowed and approved ones whose actionable dependencies are applied in
+// the same run.
+func (r *Reconciler) selectOperations(plan *models.Plan, approved map[string]bool) map[string]bool {
+	ops := plan.Operations()
+	selected := make(map[string]bool)
+	actionable := make(map[string]bool)
+	for _, op := range ops {
+		actionable[op.Target] = op.Actionable()
+		if op.Actionable() && (r.allowed(op) || approved[OperationID(op)]) {
+			selected[op.Target] = true
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, op := range ops {
+			if !selected[op.Target] {
+				continue
+			}
+			for _, dep := range op.DependsOn {
+				if actionable[dep] && !selected[dep] {
+					r.logger.Info("operation waits for an unapproved dependency", util.FieldOp, op.Type, util.FieldTarget, op.Target, "dependency", dep)
+					delete(selected, op.Target)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return selected
+}
+
+// allowed reports whether op may be applied without approval. Verify
+// operations only read the state and are always allowed.
+func (r *Reconciler) allowed(op models.Operation) bool {
+	if op.Type == "verify" {
+		return true
+	}
+	for _, rule := range r.AutoApply {
+		if rule.Matches(op) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+)
+
+// fakeExecutor applies every operation of the plans it is given.
+type fakeExecutor struct {
+	executed []string
+}
+
+func (e *fakeExecutor) Execute(_ context.Context, plan *models.Plan) (*models.ExecutionResult, error) {
+	result := &models.ExecutionResult{}
+	for _, op := range plan.Operations() {
+		e.executed = append(e.executed, op.Type+" "+op.Target)
+		result.AppliedOperations = append(result.AppliedOperations, op)
+	}
+	return result, nil
+}
+
+func (e *fakeExecutor) Observe(tasks.Observer) func() { return func() {} }
+
+func TestReconcileResult(t *testing.T) {
+	server := models.Operation{Type: "create", Target: "server:a"}
+	domain := models.Operation{Type: "verify", Target: "dns:rootDomain"}
+	record := models.Operation{Type: "update", Target: "dns:A a", DependsOn: []string{"dns:rootDomain", "server:a"}}
+	alias := models.Operation{Type: "ensure", Target: "dns:CNAME b", DependsOn: []string{"dns:rootDomain"}}
+
+	tests := []struct {
+		name         string
+		plan         *models.Plan
+		approve      []models.Operation
+		wantResult   string
+		wantExecuted []string
+		wantPending  int
+	}{
+		{
+			name:       "nothing to change",
+			plan:       &models.Plan{ServerOps: []models.Operation{{Type: "noop", Target: "server:a"}}},
+			wantResult: RunNoChanges,
+		},
+		{
+			name:        "allowed operation waits for an approval",
+			plan:        &models.Plan{ServerOps: []models.Operation{server}, DNSOps: []models.Operation{domain, record}},
+			wantResult:  RunBlocked,
+			wantPending: 1,
+		},
+		{
+			name:         "approved dependency",
+			plan:         &models.Plan{ServerOps: []models.Operation{server}, DNSOps: []models.Operation{domain, record}},
+			approve:      []models.Operation{server},
+			wantResult:   RunSucceeded,
+			wantExecuted: []string{"create server:a", "verify dns:rootDomain", "update dns:A a"},
+		},
+		{
+			name:         "verify needs no approval",
+			plan:         &models.Plan{DNSOps: []models.Operation{domain, alias}},
+			wantResult:   RunSucceeded,
+			wantExecuted: []string{"verify dns:rootDomain", "ensure dns:CNAME b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue, err := OpenApprovalQueue(filepath.Join(t.TempDir(), "approvals.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.approve) > 0 {
+				if _, err := queue.Sync(tt.approve); err != nil {
+					t.Fatal(err)
+				}
+				for _, op := range tt.approve {
+					if _, err := queue.Decide(OperationID(op), true); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			executor := &fakeExecutor{}
+			load := func(context.Context) (*config.Config, *models.Plan, error) {
+				return config.DefaultConfig(), tt.plan, nil
+			}
+			newExecutor := func(*config.Config) (tasks.Executor, error) { return executor, nil }
+			r := NewReconciler(nil, load, newExecutor, queue)
+			r.AutoApply = []Rule{{Kind: "dns", Type: "*"}}
+
+			r.RunOnce(context.Background())
+
+			if got := r.Status().LastResult; got != tt.wantResult {
+				t.Errorf("result = %q, want %q", got, tt.wantResult)
+			}
+			if !slices.Equal(executor.executed, tt.wantExecuted) {
+				t.Errorf("executed = %v, want %v", executor.executed, tt.wantExecuted)
+			}
+			if counts := queue.Counts(); counts[ApprovalPending] != tt.wantPending || counts[ApprovalApproved] != 0 {
+				t.Errorf("queue counts = %v, want %d pending and the applied approvals removed", counts, tt.wantPending)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// NewHandler returns the HTTP API of a reconciler:
+//
+//	GET  /healthz                 liveness check
+//	GET  /status                  status of the runs
+//	GET  /metrics                 metrics in the Prometheus text format
+//	GET  /approvals               queued approvals
+//	POST /approvals/{id}/approve  approve an operation and start a run
+//	POST /approvals/{id}/reject   reject an operation
+//	POST /reconcile               start a run
+//
+// With a token, the POST endpoints require it as a bearer token.
+func NewHandler(r *Reconciler, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, newStatusDocument(r.Status()))
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, req *http.Request) {
+		r.metrics.refresh(r)
+		r.metrics.registry.Handler().ServeHTTP(w, req)
+	})
+	mux.HandleFunc("GET /approvals", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, r.Queue.List())
+	})
+	mux.Handle("POST /approvals/{id}/approve", authorize(token, decide(r, true)))
+	mux.Handle("POST /approvals/{id}/reject", authorize(token, decide(r, false)))
+	mux.Handle("POST /reconcile", authorize(token, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		r.Trigger()
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "triggered"})
+	})))
+	return mux
+}
+
+func decide(r *Reconciler, approve bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		approval, err := r.Queue.Decide(req.PathValue("id"), approve)
+		switch {
+		case errors.Is(err, ErrUnknownApproval):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		r.logger.Info("approval decided", "id", approval.ID, "status", approval.Status, "operation", approval.Operation.Type+" "+approval.Operation.Target)
+		if approve {
+			r.Trigger()
+		}
+		writeJSON(w, http.StatusOK, approval)
+	})
+}
+
+// authorize requires token as bearer token; an empty token allows every
+// request.
+func authorize(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), want) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid bearer token"})
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// statusDocument is the JSON form of Status with durations in seconds.
+type statusDocument struct {
+	Runs          int       `json:"runs"`
+	Failures      int       `json:"failures"`
+	Applied       int       `json:"applied"`
+	Running       bool      `json:"running"`
+	LastStarted   time.Time `json:"lastStarted,omitzero"`
+	LastCompleted time.Time `json:"lastCompleted,omitzero"`
+	LastDuration  float64   `json:"lastDurationSeconds"`
+	LastResult    string    `json:"lastResult,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	NextRun       time.Time `json:"nextRun,omitzero"`
+}
+
+func newStatusDocument(s Status) statusDocument {
+	return statusDocument{
+		Runs:          s.Runs,
+		Failures:      s.Failures,
+		Applied:       s.Applied,
+		Running:       s.Running,
+		LastStarted:   s.LastStarted,
+		LastCompleted: s.LastCompleted,
+		LastDuration:  s.LastDuration.Seconds(),
+		LastResult:    s.LastResult,
+		LastError:     s.LastError,
+		NextRun:       s.NextRun,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
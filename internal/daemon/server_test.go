@@ -0,0 +1,90 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/internal/metrics"
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+)
+
+func newTestReconciler(t *testing.T, plan *models.Plan) *Reconciler {
+	t.Helper()
+	queue, err := OpenApprovalQueue(filepath.Join(t.TempDir(), "approvals.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func(context.Context) (*config.Config, *models.Plan, error) {
+		return config.DefaultConfig(), plan, nil
+	}
+	newExecutor := func(*config.Config) (tasks.Executor, error) { return &fakeExecutor{}, nil }
+	return NewReconciler(nil, load, newExecutor, queue)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	plan := &models.Plan{ServerOps: []models.Operation{{Type: "create", Target: "server:a"}}}
+	r := newTestReconciler(t, plan)
+	r.RunOnce(context.Background())
+	r.ObserveProviderCall("hetzner", "GET /servers", 30*time.Millisecond, nil)
+	r.ObserveProviderCall("hetzner", "POST /servers/{id}/actions/poweron", time.Second, &models.APIError{Provider: "hetzner", StatusCode: 423})
+
+	rec := httptest.NewRecorder()
+	NewHandler(r, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != metrics.ContentType {
+		t.Fatalf("status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`endnet_reconcile_runs_total{result="blocked-by-approval"} 1`,
+		`endnet_reconcile_runs_total{result="failed"} 0`,
+		`endnet_reconcile_duration_seconds_count{result="blocked-by-approval"} 1`,
+		`endnet_plan_operations{action="create",kind="server"} 1`,
+		`endnet_approvals{status="pending"} 1`,
+		`endnet_reconcile_running 0`,
+		`endnet_provider_request_duration_seconds_bucket{provider="hetzner",endpoint="GET /servers",le="0.05"} 1`,
+		`endnet_provider_request_duration_seconds_count{provider="hetzner",endpoint="POST /servers/{id}/actions/poweron"} 1`,
+		`endnet_provider_request_errors_total{provider="hetzner",endpoint="POST /servers/{id}/actions/poweron"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if strings.Contains(body, `endnet_provider_request_errors_total{provider="hetzner",endpoint="GET /servers"}`) {
+		t.Error("a successful call was counted as error")
+	}
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	r := newTestReconciler(t, &models.Plan{})
+	h := NewHandler(r, "secret")
+
+	tests := []struct {
+		method, path, auth string
+		want               int
+	}{
+		{http.MethodPost, "/reconcile", "", http.StatusUnauthorized},
+		{http.MethodPost, "/reconcile", "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodPost, "/reconcile", "Bearer secret", http.StatusAccepted},
+		{http.MethodPost, "/approvals/unknown/approve", "Bearer secret", http.StatusNotFound},
+		{http.MethodGet, "/status", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s with %q: status %d, want %d", tt.method, tt.path, tt.auth, rec.Code, tt.want)
+		}
+	}
+}
@@ -1,28 +1,120 @@
 package hetzner
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"endnet-cli/pkg/models"
 )
 
+// DefaultEndpoint is the base URL of the Hetzner Cloud API.
+const DefaultEndpoint = "https://api.hetzner.cloud/v1"
+
 // Client describes the operations required to interact with the Hetzner Cloud.
+// Every API call is aborted when its context is cancelled. Error responses
+// are returned as *models.APIError.
 type Client interface {
 	Authenticate(token string) error
-	ListServers() ([]models.Server, error)
+
+	ListNetworks(ctx context.Context) ([]models.Network, error)
+	CreateNetwork(ctx context.Context, opts CreateNetworkOpts) (*models.Network, error)
+	DeleteNetwork(ctx context.Context, id int) error
+
+	ListServers(ctx context.Context) ([]models.Server, error)
+	CreateServer(ctx context.Context, opts CreateServerOpts) (*models.Server, []models.Action, error)
+	AttachServerToNetwork(ctx context.Context, id, networkID int, ip string) (*models.Action, error)
+	PowerOnServer(ctx context.Context, id int) (*models.Action, error)
+	DeleteServer(ctx context.Context, id int) (*models.Action, error)
+
+	ListSSHKeys(ctx context.Context) ([]models.SSHKey, error)
+	CreateSSHKey(ctx context.Context, name, publicKey string) (*models.SSHKey, error)
+	DeleteSSHKey(ctx context.Context, id int) error
+
+	ListFirewalls(ctx context.Context) ([]models.Firewall, error)
+	CreateFirewall(ctx context.Context, opts CreateFirewallOpts) (*models.Firewall, []models.Action, error)
+	SetFirewallRules(ctx context.Context, id int, rules []models.FirewallRule) ([]models.Action, error)
+	ApplyFirewallToServers(ctx context.Context, id int, serverIDs []int) ([]models.Action, error)
+	RemoveFirewallFromServers(ctx context.Context, id int, serverIDs []int) ([]models.Action, error)
+	DeleteFirewall(ctx context.Context, id int) error
+
+	GetAction(ctx context.Context, id int) (*models.Action, error)
+}
+
+// CreateNetworkOpts describes a network with a single cloud subnet.
+type CreateNetworkOpts struct {
+	Name       string
+	CIDR       string
+	SubnetCIDR string
+	// Zone is the network zone of the subnet, e.g. eu-central; see
+	// NetworkZone.
+	Zone string
+}
+
+// CreateServerOpts describes a server to create. SSHKeys and Firewalls are
+// resource IDs. Servers are created stopped when StartAfterCreate is false,
+// so they can be attached to a network before they boot.
+type CreateServerOpts struct {
+	Name             string
+	Type             string
+	Image            string
+	Location         string
+	SSHKeys          []int
+	Firewalls        []int
+	EnableIPv4       bool
+	EnableIPv6       bool
+	StartAfterCreate bool
+}
+
+// CreateFirewallOpts describes a firewall applied to the servers with the
+// IDs in ApplyTo.
+type CreateFirewallOpts struct {
+	Name    string
+	Rules   []models.FirewallRule
+	ApplyTo []int
+}
+
+// NetworkZone returns the network zone of a Hetzner location, e.g.
+// eu-central for nbg1.
+func NetworkZone(location string) string {
+	switch {
+	case strings.HasPrefix(location, "ash"):
+		return "us-east"
+	case strings.HasPrefix(location, "hil"):
+		return "us-west"
+	case strings.HasPrefix(location, "sin"):
+		return "ap-southeast"
+	default:
+		return "eu-central"
+	}
 }
 
-// APIClient is a stub implementation until the real SDK integration is written.
+// APIClient calls the Hetzner Cloud API over HTTP.
 type APIClient struct {
+	// Endpoint is the base URL of the API; DefaultEndpoint when empty.
+	Endpoint string
+	// HTTPClient makes the requests; http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// Observe, when set, is called after every request with its endpoint,
+	// such as "GET /servers/{id}", its duration and its error.
+	Observe func(endpoint string, elapsed time.Duration, err error)
+
 	token string
 }
 
-// NewClient returns a placeholder Hetzner client.
-func NewClient() Client {
+// NewClient returns a client for the public Hetzner Cloud API.
+func NewClient() *APIClient {
 	return &APIClient{}
 }
 
-// Authenticate stores the provided token for later use.
+// Authenticate stores the API token sent with every request.
 func (c *APIClient) Authenticate(token string) error {
 	if token == "" {
 		return fmt.Errorf("token must not be empty")
@@ -31,17 +123,381 @@ func (c *APIClient) Authenticate(token string) error {
 	return nil
 }
 
-// ListServers returns a deterministic list so higher layers can be developed.
-func (c *APIClient) ListServers() ([]models.Server, error) {
+// ListNetworks returns every network of the project.
+func (c *APIClient) ListNetworks(ctx context.Context) ([]models.Network, error) {
+	var networks []models.Network
+	err := c.list(ctx, "/networks", "networks", func(raw json.RawMessage) error {
+		var n network
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return err
+		}
+		networks = append(networks, n.model())
+		return nil
+	})
+	return networks, err
+}
+
+// CreateNetwork creates a network. Networks are created synchronously.
+func (c *APIClient) CreateNetwork(ctx context.Context, opts CreateNetworkOpts) (*models.Network, error) {
+	req := map[string]any{
+		"name":     opts.Name,
+		"ip_range": opts.CIDR,
+		"subnets": []map[string]any{{
+			"type":         "cloud",
+			"ip_range":     opts.SubnetCIDR,
+			"network_zone": opts.Zone,
+		}},
+	}
+	var resp struct {
+		Network network `json:"network"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/networks", req, &resp); err != nil {
+		return nil, err
+	}
+	n := resp.Network.model()
+	return &n, nil
+}
+
+// DeleteNetwork deletes a network.
+func (c *APIClient) DeleteNetwork(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "/networks/"+strconv.Itoa(id), nil, nil)
+}
+
+// ListServers returns every server of the project.
+func (c *APIClient) ListServers(ctx context.Context) ([]models.Server, error) {
+	var servers []models.Server
+	err := c.list(ctx, "/servers", "servers", func(raw json.RawMessage) error {
+		var s server
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		servers = append(servers, s.model())
+		return nil
+	})
+	return servers, err
+}
+
+// CreateServer creates a server and returns the actions creating it.
+func (c *APIClient) CreateServer(ctx context.Context, opts CreateServerOpts) (*models.Server, []models.Action, error) {
+	firewalls := make([]map[string]int, len(opts.Firewalls))
+	for i, id := range opts.Firewalls {
+		firewalls[i] = map[string]int{"firewall": id}
+	}
+	req := map[string]any{
+		"name":               opts.Name,
+		"server_type":        opts.Type,
+		"image":              opts.Image,
+		"location":           opts.Location,
+		"ssh_keys":           nonNil(opts.SSHKeys),
+		"firewalls":          firewalls,
+		"start_after_create": opts.StartAfterCreate,
+		"public_net": map[string]bool{
+			"enable_ipv4": opts.EnableIPv4,
+			"enable_ipv6": opts.EnableIPv6,
+		},
+	}
+	var resp struct {
+		Server      server   `json:"server"`
+		Action      *action  `json:"action"`
+		NextActions []action `json:"next_actions"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/servers", req, &resp); err != nil {
+		return nil, nil, err
+	}
+	s := resp.Server.model()
+	return &s, actions(resp.Action, resp.NextActions), nil
+}
+
+// AttachServerToNetwork attaches a server to a network with the given
+// private IP.
+func (c *APIClient) AttachServerToNetwork(ctx context.Context, id, networkID int, ip string) (*models.Action, error) {
+	req := map[string]any{"network": networkID, "ip": ip}
+	return c.serverAction(ctx, id, "attach_to_network", req)
+}
+
+// PowerOnServer starts a server.
+func (c *APIClient) PowerOnServer(ctx context.Context, id int) (*models.Action, error) {
+	return c.serverAction(ctx, id, "poweron", nil)
+}
+
+func (c *APIClient) serverAction(ctx context.Context, id int, command string, req any) (*models.Action, error) {
+	var resp struct {
+		Action action `json:"action"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/servers/"+strconv.Itoa(id)+"/actions/"+command, req, &resp); err != nil {
+		return nil, err
+	}
+	a := resp.Action.model()
+	return &a, nil
+}
+
+// DeleteServer deletes a server and returns the action deleting it.
+func (c *APIClient) DeleteServer(ctx context.Context, id int) (*models.Action, error) {
+	var resp struct {
+		Action action `json:"action"`
+	}
+	if err := c.do(ctx, http.MethodDelete, "/servers/"+strconv.Itoa(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	a := resp.Action.model()
+	return &a, nil
+}
+
+// ListSSHKeys returns every SSH key of the project.
+func (c *APIClient) ListSSHKeys(ctx context.Context) ([]models.SSHKey, error) {
+	var keys []models.SSHKey
+	err := c.list(ctx, "/ssh_keys", "ssh_keys", func(raw json.RawMessage) error {
+		var k sshKey
+		if err := json.Unmarshal(raw, &k); err != nil {
+			return err
+		}
+		keys = append(keys, k.model())
+		return nil
+	})
+	return keys, err
+}
+
+// CreateSSHKey registers a public key under the given name.
+func (c *APIClient) CreateSSHKey(ctx context.Context, name, publicKey string) (*models.SSHKey, error) {
+	if name == "" || publicKey == "" {
+		return nil, fmt.Errorf("ssh key name and public key must not be empty")
+	}
+	req := map[string]string{"name": name, "public_key": publicKey}
+	var resp struct {
+		SSHKey sshKey `json:"ssh_key"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/ssh_keys", req, &resp); err != nil {
+		return nil, err
+	}
+	k := resp.SSHKey.model()
+	return &k, nil
+}
+
+// DeleteSSHKey deletes an SSH key. Servers created with it keep it.
+func (c *APIClient) DeleteSSHKey(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "/ssh_keys/"+strconv.Itoa(id), nil, nil)
+}
+
+// ListFirewalls returns every firewall of the project.
+func (c *APIClient) ListFirewalls(ctx context.Context) ([]models.Firewall, error) {
+	var firewalls []models.Firewall
+	err := c.list(ctx, "/firewalls", "firewalls", func(raw json.RawMessage) error {
+		var f firewall
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return err
+		}
+		firewalls = append(firewalls, f.model())
+		return nil
+	})
+	return firewalls, err
+}
+
+// CreateFirewall creates a firewall and returns the actions applying it.
+func (c *APIClient) CreateFirewall(ctx context.Context, opts CreateFirewallOpts) (*models.Firewall, []models.Action, error) {
+	req := map[string]any{
+		"name":     opts.Name,
+		"rules":    toRules(opts.Rules),
+		"apply_to": serverResources(opts.ApplyTo),
+	}
+	var resp struct {
+		Firewall firewall `json:"firewall"`
+		Actions  []action `json:"actions"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/firewalls", req, &resp); err != nil {
+		return nil, nil, err
+	}
+	f := resp.Firewall.model()
+	return &f, actions(nil, resp.Actions), nil
+}
+
+// SetFirewallRules replaces the rules of a firewall.
+func (c *APIClient) SetFirewallRules(ctx context.Context, id int, rules []models.FirewallRule) ([]models.Action, error) {
+	return c.firewallAction(ctx, id, "set_rules", map[string]any{"rules": toRules(rules)})
+}
+
+// ApplyFirewallToServers applies a firewall to the given servers.
+func (c *APIClient) ApplyFirewallToServers(ctx context.Context, id int, serverIDs []int) ([]models.Action, error) {
+	return c.firewallAction(ctx, id, "apply_to_resources", map[string]any{"apply_to": serverResources(serverIDs)})
+}
+
+// RemoveFirewallFromServers stops applying a firewall to the given servers.
+func (c *APIClient) RemoveFirewallFromServers(ctx context.Context, id int, serverIDs []int) ([]models.Action, error) {
+	return c.firewallAction(ctx, id, "remove_from_resources", map[string]any{"remove_from": serverResources(serverIDs)})
+}
+
+func (c *APIClient) firewallAction(ctx context.Context, id int, command string, req any) ([]models.Action, error) {
+	var resp struct {
+		Actions []action `json:"actions"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/firewalls/"+strconv.Itoa(id)+"/actions/"+command, req, &resp); err != nil {
+		return nil, err
+	}
+	return actions(nil, resp.Actions), nil
+}
+
+// DeleteFirewall deletes a firewall, which must not be applied to any
+// resource.
+func (c *APIClient) DeleteFirewall(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "/firewalls/"+strconv.Itoa(id), nil, nil)
+}
+
+// GetAction reports the status of an asynchronous action.
+func (c *APIClient) GetAction(ctx context.Context, id int) (*models.Action, error) {
+	var resp struct {
+		Action action `json:"action"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/actions/"+strconv.Itoa(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	a := resp.Action.model()
+	return &a, nil
+}
+
+// list fetches every page of a collection and passes its entries, found
+// under key, to add.
+func (c *APIClient) list(ctx context.Context, path, key string, add func(json.RawMessage) error) error {
+	for page := 1; page != 0; {
+		query := url.Values{"page": {strconv.Itoa(page)}, "per_page": {"50"}}
+		var resp map[string]json.RawMessage
+		if err := c.do(ctx, http.MethodGet, path+"?"+query.Encode(), nil, &resp); err != nil {
+			return err
+		}
+		var entries []json.RawMessage
+		if err := json.Unmarshal(resp[key], &entries); err != nil {
+			return fmt.Errorf("hetzner: decode %s: %w", path, err)
+		}
+		for _, entry := range entries {
+			if err := add(entry); err != nil {
+				return fmt.Errorf("hetzner: decode %s: %w", path, err)
+			}
+		}
+
+		var meta struct {
+			Pagination struct {
+				NextPage *int `json:"next_page"`
+			} `json:"pagination"`
+		}
+		if raw, ok := resp["meta"]; ok {
+			if err := json.Unmarshal(raw, &meta); err != nil {
+				return fmt.Errorf("hetzner: decode %s: %w", path, err)
+			}
+		}
+		page = 0
+		if meta.Pagination.NextPage != nil {
+			page = *meta.Pagination.NextPage
+		}
+	}
+	return nil
+}
+
+// do sends a request with body encoded as JSON and decodes the response into
+// out. Error responses are returned as *models.APIError.
+func (c *APIClient) do(ctx context.Context, method, path string, body, out any) error {
 	if c.token == "" {
-		return nil, models.ErrUnauthenticated
+		return models.ErrUnauthenticated
+	}
+	started := time.Now()
+	err := c.request(ctx, method, path, body, out)
+	if c.Observe != nil {
+		c.Observe(endpointName(method, path), time.Since(started), err)
+	}
+	return err
+}
+
+// endpointName returns the method and path of a request without query and
+// with IDs replaced by {id}, e.g. "POST /servers/{id}/actions/poweron".
+func endpointName(method, path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if _, err := strconv.Atoi(segment); err == nil {
+			segments[i] = "{id}"
+		}
+	}
+	return method + " " + strings.Join(segments, "/")
+}
+
+func (c *APIClient) request(ctx context.Context, method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(endpoint, "/")+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
 
-	return []models.Server{{
-		ID:        1,
-		Name:      "placeholder-server",
-		Type:      "cx23",
-		Image:     "debian-12",
-		PrivateIP: "10.10.0.2",
-	}}, nil
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		apiErr := &models.APIError{Provider: "hetzner", StatusCode: resp.StatusCode, Code: http.StatusText(resp.StatusCode)}
+		var envelope struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &envelope) == nil && envelope.Error.Code != "" {
+			apiErr.Code, apiErr.Message = envelope.Error.Code, envelope.Error.Message
+		}
+		return apiErr
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("hetzner: decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+func nonNil(ids []int) []int {
+	if ids == nil {
+		return []int{}
+	}
+	return ids
+}
+
+func serverResources(ids []int) []map[string]any {
+	resources := make([]map[string]any, len(ids))
+	for i, id := range ids {
+		resources[i] = map[string]any{"type": "server", "server": map[string]int{"id": id}}
+	}
+	return resources
+}
+
+// actions collects the actions of a response, skipping a missing first one.
+func actions(first *action, rest []action) []models.Action {
+	var out []models.Action
+	if first != nil {
+		out = append(out, first.model())
+	}
+	for _, a := range rest {
+		out = append(out, a.model())
+	}
+	return out
 }
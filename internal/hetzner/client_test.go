@@ -0,0 +1,186 @@
+package hetzner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+// newTestClient returns a client calling handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *APIClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c := &APIClient{Endpoint: server.URL}
+	if err := c.Authenticate("token"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestListServersFollowsPages(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if r.URL.Path != "/servers" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Write([]byte(`{"servers":[{"id":1,"name":"edge","server_type":{"name":"cx23"},"image":{"name":"debian-12"},
+				"public_net":{"ipv4":{"ip":"192.0.2.1"}},"private_net":[{"network":7,"ip":"10.10.0.2"}]}],
+				"meta":{"pagination":{"page":1,"next_page":2}}}`))
+		case "2":
+			w.Write([]byte(`{"servers":[{"id":2,"name":"wg","server_type":{"name":"cx23"},"image":null,
+				"public_net":{"ipv4":null},"private_net":[]}],"meta":{"pagination":{"page":2,"next_page":null}}}`))
+		default:
+			t.Errorf("unexpected page %q", r.URL.Query().Get("page"))
+		}
+	})
+
+	servers, err := c.ListServers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.Server{
+		{ID: 1, Name: "edge", Type: "cx23", Image: "debian-12", PrivateIP: "10.10.0.2", PublicIP: "192.0.2.1"},
+		{ID: 2, Name: "wg", Type: "cx23"},
+	}
+	if len(servers) != len(want) || servers[0] != want[0] || servers[1] != want[1] {
+		t.Fatalf("servers = %+v, want %+v", servers, want)
+	}
+}
+
+func TestErrorsAreAPIErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		want      models.APIError
+		retryable bool
+	}{
+		{
+			name:      "locked",
+			status:    http.StatusLocked,
+			body:      `{"error":{"code":"locked","message":"server is locked"}}`,
+			want:      models.APIError{Provider: "hetzner", StatusCode: 423, Code: "locked", Message: "server is locked"},
+			retryable: true,
+		},
+		{
+			name:      "rate limited",
+			status:    http.StatusTooManyRequests,
+			body:      `{"error":{"code":"rate_limit_exceeded","message":"slow down"}}`,
+			want:      models.APIError{Provider: "hetzner", StatusCode: 429, Code: "rate_limit_exceeded", Message: "slow down"},
+			retryable: true,
+		},
+		{
+			name:   "invalid input",
+			status: http.StatusBadRequest,
+			body:   `{"error":{"code":"invalid_input","message":"invalid name"}}`,
+			want:   models.APIError{Provider: "hetzner", StatusCode: 400, Code: "invalid_input", Message: "invalid name"},
+		},
+		{
+			name:      "gateway error without JSON",
+			status:    http.StatusBadGateway,
+			body:      `<html>bad gateway</html>`,
+			want:      models.APIError{Provider: "hetzner", StatusCode: 502, Code: "Bad Gateway"},
+			retryable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			_, err := c.GetAction(context.Background(), 1)
+			var apiErr *models.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want a *models.APIError", err)
+			}
+			if *apiErr != tt.want {
+				t.Fatalf("error = %+v, want %+v", *apiErr, tt.want)
+			}
+			if apiErr.Retryable() != tt.retryable {
+				t.Fatalf("Retryable() = %v, want %v", apiErr.Retryable(), tt.retryable)
+			}
+		})
+	}
+}
+
+func TestCreateServerReturnsActions(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/servers" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if keys, _ := req["ssh_keys"].([]any); len(keys) != 1 || keys[0] != float64(42) {
+			t.Errorf("ssh_keys = %v", req["ssh_keys"])
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"server":{"id":5,"name":"edge","server_type":{"name":"cx23"}},
+			"action":{"id":10,"command":"create_server","status":"running","progress":0,"error":null},
+			"next_actions":[{"id":11,"command":"start_server","status":"running","progress":0}]}`))
+	})
+
+	server, actions, err := c.CreateServer(context.Background(), CreateServerOpts{Name: "edge", SSHKeys: []int{42}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.ID != 5 || len(actions) != 2 || actions[0].ID != 10 || actions[1].Command != "start_server" {
+		t.Fatalf("server %+v, actions %+v", server, actions)
+	}
+}
+
+func TestUnauthenticated(t *testing.T) {
+	_, err := NewClient().ListServers(context.Background())
+	if !errors.Is(err, models.ErrUnauthenticated) {
+		t.Fatalf("error = %v, want ErrUnauthenticated", err)
+	}
+}
+
+func TestObserveNamesEndpoints(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/actions/42":
+			w.Write([]byte(`{"action":{"id":42,"command":"start_server","status":"success"}}`))
+		case "/servers/5/actions/poweron":
+			w.WriteHeader(http.StatusLocked)
+			w.Write([]byte(`{"error":{"code":"locked","message":"server is locked"}}`))
+		default:
+			w.Write([]byte(`{"networks":[],"meta":{"pagination":{"next_page":null}}}`))
+		}
+	})
+	var calls []string
+	var errs []error
+	c.Observe = func(endpoint string, elapsed time.Duration, err error) {
+		calls = append(calls, endpoint)
+		errs = append(errs, err)
+	}
+
+	c.ListNetworks(context.Background())
+	c.GetAction(context.Background(), 42)
+	c.PowerOnServer(context.Background(), 5)
+
+	want := []string{"GET /networks", "GET /actions/{id}", "POST /servers/{id}/actions/poweron"}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("endpoints = %v, want %v", calls, want)
+	}
+	var apiErr *models.APIError
+	if errs[0] != nil || errs[1] != nil || !errors.As(errs[2], &apiErr) {
+		t.Fatalf("errors = %v, want only the power-on call to fail", errs)
+	}
+}
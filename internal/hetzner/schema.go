@@ -0,0 +1,149 @@
+package hetzner
+
+import (
+	"strings"
+
+	"endnet-cli/pkg/models"
+)
+
+// The types below mirror the JSON representation of the API resources.
+
+type network struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	IPRange string `json:"ip_range"`
+}
+
+func (n network) model() models.Network {
+	return models.Network{ID: n.ID, Name: n.Name, CIDR: n.IPRange}
+}
+
+type server struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	ServerType struct {
+		Name string `json:"name"`
+	} `json:"server_type"`
+	Image *struct {
+		Name string `json:"name"`
+	} `json:"image"`
+	PublicNet struct {
+		IPv4 *struct {
+			IP string `json:"ip"`
+		} `json:"ipv4"`
+	} `json:"public_net"`
+	PrivateNet []struct {
+		Network int    `json:"network"`
+		IP      string `json:"ip"`
+	} `json:"private_net"`
+}
+
+func (s server) model() models.Server {
+	m := models.Server{ID: s.ID, Name: s.Name, Type: s.ServerType.Name, Status: s.Status}
+	if s.Image != nil {
+		m.Image = s.Image.Name
+	}
+	if s.PublicNet.IPv4 != nil {
+		m.PublicIP = s.PublicNet.IPv4.IP
+	}
+	if len(s.PrivateNet) > 0 {
+		m.PrivateIP = s.PrivateNet[0].IP
+	}
+	return m
+}
+
+type sshKey struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"public_key"`
+}
+
+func (k sshKey) model() models.SSHKey {
+	return models.SSHKey{ID: k.ID, Name: k.Name, Fingerprint: k.Fingerprint, PublicKey: k.PublicKey}
+}
+
+type firewallRule struct {
+	Direction      string   `json:"direction"`
+	Protocol       string   `json:"protocol"`
+	Port           string   `json:"port,omitempty"`
+	SourceIPs      []string `json:"source_ips"`
+	DestinationIPs []string `json:"destination_ips"`
+}
+
+type firewall struct {
+	ID        int            `json:"id"`
+	Name      string         `json:"name"`
+	Rules     []firewallRule `json:"rules"`
+	AppliedTo []struct {
+		Type   string `json:"type"`
+		Server *struct {
+			ID int `json:"id"`
+		} `json:"server"`
+	} `json:"applied_to"`
+}
+
+func (f firewall) model() models.Firewall {
+	m := models.Firewall{ID: f.ID, Name: f.Name}
+	for _, r := range f.Rules {
+		m.Rules = append(m.Rules, models.FirewallRule{
+			Direction: r.Direction,
+			Protocol:  r.Protocol,
+			Port:      r.Port,
+			Source:    strings.Join(r.SourceIPs, ","),
+			Target:    strings.Join(r.DestinationIPs, ","),
+		})
+	}
+	for _, a := range f.AppliedTo {
+		if a.Type == "server" && a.Server != nil {
+			m.AppliedTo = append(m.AppliedTo, a.Server.ID)
+		}
+	}
+	return m
+}
+
+// toRules converts rules to their JSON representation. Source and Target
+// hold comma-separated CIDRs.
+func toRules(rules []models.FirewallRule) []firewallRule {
+	out := make([]firewallRule, len(rules))
+	for i, r := range rules {
+		out[i] = firewallRule{
+			Direction:      r.Direction,
+			Protocol:       r.Protocol,
+			Port:           r.Port,
+			SourceIPs:      splitIPs(r.Source),
+			DestinationIPs: splitIPs(r.Target),
+		}
+	}
+	return out
+}
+
+func splitIPs(s string) []string {
+	ips := []string{}
+	for _, ip := range strings.Split(s, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+type action struct {
+	ID       int    `json:"id"`
+	Command  string `json:"command"`
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+	Error    *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (a action) model() models.Action {
+	m := models.Action{ID: a.ID, Command: a.Command, Status: a.Status, Progress: a.Progress}
+	if a.Error != nil {
+		m.Error = a.Error.Code + ": " + a.Error.Message
+	}
+	return m
+}
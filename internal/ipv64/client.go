@@ -1,28 +1,69 @@
 package ipv64
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"endnet-cli/pkg/models"
 )
 
+// Default endpoints of the IPv64 API and its DynDNS service.
+const (
+	DefaultEndpoint       = "https://ipv64.net/api.php"
+	DefaultDynDNSEndpoint = "https://ipv64.net/nic/update"
+)
+
+// ErrNoDynDNSToken is returned by UpdateDynDNS when no DynDNS token is set.
+var ErrNoDynDNSToken = errors.New("no DynDNS token is configured")
+
 // Client exposes the subset of the IPv64 API required by the controller.
+// Every API call is aborted when its context is cancelled. Error responses
+// are returned as *models.APIError.
 type Client interface {
 	Authenticate(token string) error
-	ListRecords() ([]models.DNSRecord, error)
+	// ListDomains returns the domains of the account with their records.
+	ListDomains(ctx context.Context) ([]models.Domain, error)
+	// AddRecord adds a record to domain. record.Name is fully qualified
+	// and must be domain or a name under it.
+	AddRecord(ctx context.Context, domain string, record models.DNSRecord) error
+	DeleteRecord(ctx context.Context, id int) error
+	// UpdateDynDNS points the A record of domain at ip through the DynDNS
+	// service.
+	UpdateDynDNS(ctx context.Context, domain, ip string) error
 }
 
-// APIClient is a stubbed IPv64 implementation.
+// APIClient calls the IPv64 API over HTTP.
 type APIClient struct {
+	// Endpoint and DynDNSEndpoint are the URLs of the API and the DynDNS
+	// service; the defaults when empty.
+	Endpoint       string
+	DynDNSEndpoint string
+	// DynDNSToken authorises UpdateDynDNS.
+	DynDNSToken string
+	// HTTPClient makes the requests; http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// Observe, when set, is called after every request with its endpoint,
+	// such as "POST add_record", its duration and its error.
+	Observe func(endpoint string, elapsed time.Duration, err error)
+
 	token string
 }
 
-// NewClient returns a placeholder IPv64 client implementation.
-func NewClient() Client {
+// NewClient returns a client for the public IPv64 API.
+func NewClient() *APIClient {
 	return &APIClient{}
 }
 
-// Authenticate stores the API token for later use.
+// Authenticate stores the API key sent with every request.
 func (c *APIClient) Authenticate(token string) error {
 	if token == "" {
 		return fmt.Errorf("token must not be empty")
@@ -31,16 +72,180 @@ func (c *APIClient) Authenticate(token string) error {
 	return nil
 }
 
-// ListRecords returns a static set of DNS records for now.
-func (c *APIClient) ListRecords() ([]models.DNSRecord, error) {
+// ListDomains returns the domains of the account with their records.
+func (c *APIClient) ListDomains(ctx context.Context) ([]models.Domain, error) {
+	var resp struct {
+		Subdomains map[string]struct {
+			Records []struct {
+				ID      int    `json:"record_id"`
+				Prefix  string `json:"praefix"`
+				Type    string `json:"type"`
+				Content string `json:"content"`
+				TTL     int    `json:"ttl"`
+			} `json:"records"`
+		} `json:"subdomains"`
+	}
+	if err := c.do(ctx, http.MethodGet, "get_domains", url.Values{"get_domains": {""}}, &resp); err != nil {
+		return nil, err
+	}
+
+	domains := make([]models.Domain, 0, len(resp.Subdomains))
+	for name, d := range resp.Subdomains {
+		domain := models.Domain{Name: name}
+		for _, r := range d.Records {
+			domain.Records = append(domain.Records, models.DNSRecord{
+				ID:    r.ID,
+				Type:  r.Type,
+				Name:  recordName(r.Prefix, name),
+				Value: r.Content,
+				TTL:   r.TTL,
+			})
+		}
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Name < domains[j].Name })
+	return domains, nil
+}
+
+// AddRecord adds a record to domain.
+func (c *APIClient) AddRecord(ctx context.Context, domain string, record models.DNSRecord) error {
+	prefix, ok := recordPrefix(record.Name, domain)
+	if !ok {
+		return fmt.Errorf("record %s is not in domain %s", record.Name, domain)
+	}
+	form := url.Values{
+		"add_record": {domain},
+		"praefix":    {prefix},
+		"type":       {record.Type},
+		"content":    {record.Value},
+	}
+	return c.do(ctx, http.MethodPost, "add_record", form, nil)
+}
+
+// DeleteRecord deletes the record with the given ID.
+func (c *APIClient) DeleteRecord(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "del_record", url.Values{"del_record": {strconv.Itoa(id)}}, nil)
+}
+
+// UpdateDynDNS points the A record of domain at ip. It returns
+// ErrNoDynDNSToken when DynDNSToken is empty.
+func (c *APIClient) UpdateDynDNS(ctx context.Context, domain, ip string) error {
+	if c.DynDNSToken == "" {
+		return ErrNoDynDNSToken
+	}
+	endpoint := c.DynDNSEndpoint
+	if endpoint == "" {
+		endpoint = DefaultDynDNSEndpoint
+	}
+	// The token goes into the Authorization header rather than the key
+	// query parameter, as errors of failed requests include the URL.
+	query := url.Values{"domain": {domain}, "ip": {ip}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("none", c.DynDNSToken)
+	_, err = c.send("GET nic/update", req)
+	return err
+}
+
+// do calls the API method with the given parameters, sent as query for GET
+// requests and as form otherwise, and decodes the response into out.
+func (c *APIClient) do(ctx context.Context, method, name string, params url.Values, out any) error {
 	if c.token == "" {
-		return nil, models.ErrUnauthenticated
+		return models.ErrUnauthenticated
+	}
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
 	}
 
-	return []models.DNSRecord{{
-		Type:  "A",
-		Name:  "endnet.ipv64.net",
-		Value: "192.0.2.1",
-		TTL:   300,
-	}}, nil
+	var req *http.Request
+	var err error
+	if method == http.MethodGet {
+		req, err = http.NewRequestWithContext(ctx, method, endpoint+"?"+strings.TrimSuffix(params.Encode(), "="), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, endpoint, strings.NewReader(params.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	data, err := c.send(method+" "+name, req)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("ipv64: decode %s: %w", name, err)
+	}
+	return nil
+}
+
+// send makes the request to endpoint and returns the response body. Error
+// responses are returned as *models.APIError.
+func (c *APIClient) send(endpoint string, req *http.Request) ([]byte, error) {
+	started := time.Now()
+	data, err := c.roundTrip(req)
+	if c.Observe != nil {
+		c.Observe(endpoint, time.Since(started), err)
+	}
+	return data, err
+}
+
+func (c *APIClient) roundTrip(req *http.Request) ([]byte, error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		apiErr := &models.APIError{Provider: "ipv64", StatusCode: resp.StatusCode, Code: http.StatusText(resp.StatusCode)}
+		var body struct {
+			Info string `json:"info"`
+		}
+		if json.Unmarshal(data, &body) == nil && body.Info != "" {
+			apiErr.Message = body.Info
+		} else {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			apiErr.Code = "rate_limit_exceeded"
+		}
+		return nil, apiErr
+	}
+	return data, nil
+}
+
+// recordName returns the fully qualified name of a record with the given
+// prefix, which is empty for the domain itself.
+func recordName(prefix, domain string) string {
+	if prefix == "" {
+		return domain
+	}
+	return prefix + "." + domain
+}
+
+// recordPrefix is the inverse of recordName.
+func recordPrefix(name, domain string) (string, bool) {
+	if name == domain {
+		return "", true
+	}
+	prefix, ok := strings.CutSuffix(name, "."+domain)
+	return prefix, ok && prefix != ""
 }
@@ -0,0 +1,169 @@
+package ipv64
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *APIClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c := &APIClient{Endpoint: server.URL + "/api.php", DynDNSEndpoint: server.URL + "/nic/update"}
+	if err := c.Authenticate("key"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestListDomains(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "get_domains" || r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("request %s with %q", r.URL, r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"subdomains":{"endnet.ipv64.net":{"records":[
+			{"record_id":1,"praefix":"","type":"A","content":"192.0.2.1","ttl":60},
+			{"record_id":2,"praefix":"git","type":"CNAME","content":"endnet.ipv64.net","ttl":60}]}},
+			"info":"success","status":"200 OK"}`))
+	})
+
+	domains, err := c.ListDomains(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.DNSRecord{
+		{ID: 1, Type: "A", Name: "endnet.ipv64.net", Value: "192.0.2.1", TTL: 60},
+		{ID: 2, Type: "CNAME", Name: "git.endnet.ipv64.net", Value: "endnet.ipv64.net", TTL: 60},
+	}
+	if len(domains) != 1 || domains[0].Name != "endnet.ipv64.net" || len(domains[0].Records) != 2 ||
+		domains[0].Records[0] != want[0] || domains[0].Records[1] != want[1] {
+		t.Fatalf("domains = %+v", domains)
+	}
+}
+
+func TestAddRecord(t *testing.T) {
+	tests := []struct {
+		name       string
+		record     string
+		wantPrefix string
+		wantErr    bool
+	}{
+		{"domain itself", "endnet.ipv64.net", "", false},
+		{"subdomain", "git.endnet.ipv64.net", "git", false},
+		{"other domain", "git.example.org", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				if err := r.ParseForm(); err != nil {
+					t.Fatal(err)
+				}
+				if r.Method != http.MethodPost || r.PostForm.Get("add_record") != "endnet.ipv64.net" ||
+					r.PostForm.Get("praefix") != tt.wantPrefix || r.PostForm.Get("type") != "CNAME" {
+					t.Errorf("request %s %v", r.Method, r.PostForm)
+				}
+				w.Write([]byte(`{"info":"success"}`))
+			})
+
+			err := c.AddRecord(context.Background(), "endnet.ipv64.net", models.DNSRecord{Type: "CNAME", Name: tt.record, Value: "endnet.ipv64.net"})
+			if (err != nil) != tt.wantErr || called == tt.wantErr {
+				t.Fatalf("error = %v, called = %v", err, called)
+			}
+		})
+	}
+}
+
+func TestErrorsAreAPIErrors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"info":"Updateintervall overcommitted","status":"429 Too Many Requests"}`))
+	})
+
+	err := c.DeleteRecord(context.Background(), 3)
+	var apiErr *models.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want a *models.APIError", err)
+	}
+	want := models.APIError{Provider: "ipv64", StatusCode: 429, Code: "rate_limit_exceeded", Message: "Updateintervall overcommitted"}
+	if *apiErr != want || !apiErr.Retryable() {
+		t.Fatalf("error = %+v, want %+v", *apiErr, want)
+	}
+}
+
+func TestUpdateDynDNS(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/nic/update" || q.Has("key") || q.Get("domain") != "endnet.ipv64.net" || q.Get("ip") != "192.0.2.7" {
+			t.Errorf("request %s", r.URL)
+		}
+		if _, password, ok := r.BasicAuth(); !ok || password != "dyn" {
+			t.Errorf("Authorization = %q, want the token as basic auth password", r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"info":"good"}`))
+	})
+
+	if err := c.UpdateDynDNS(context.Background(), "endnet.ipv64.net", "192.0.2.7"); !errors.Is(err, ErrNoDynDNSToken) {
+		t.Fatalf("without token: %v", err)
+	}
+	c.DynDNSToken = "dyn"
+	if err := c.UpdateDynDNS(context.Background(), "endnet.ipv64.net", "192.0.2.7"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObserveNamesEndpoints(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"info":"success","subdomains":{}}`))
+	})
+	c.DynDNSToken = "dyn"
+	var calls []string
+	var errs []error
+	c.Observe = func(endpoint string, elapsed time.Duration, err error) {
+		calls = append(calls, endpoint)
+		errs = append(errs, err)
+	}
+
+	c.ListDomains(context.Background())
+	c.AddRecord(context.Background(), "endnet.ipv64.net", models.DNSRecord{Type: "A", Name: "git.endnet.ipv64.net", Value: "192.0.2.1"})
+	c.DeleteRecord(context.Background(), 3)
+	c.UpdateDynDNS(context.Background(), "endnet.ipv64.net", "192.0.2.7")
+
+	want := []string{"GET get_domains", "POST add_record", "DELETE del_record", "GET nic/update"}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("endpoints = %v, want %v", calls, want)
+	}
+	if errs[2] == nil {
+		t.Fatal("the failed call was observed without its error")
+	}
+}
+
+func TestFailedDynDNSErrorOmitsToken(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	c := &APIClient{DynDNSEndpoint: server.URL + "/nic/update", DynDNSToken: "s3cr3t/+token"}
+
+	err := c.UpdateDynDNS(context.Background(), "endnet.ipv64.net", "192.0.2.7")
+	if err == nil {
+		t.Fatal("UpdateDynDNS succeeded against a closed server")
+	}
+	for _, form := range []string{c.DynDNSToken, url.QueryEscape(c.DynDNSToken)} {
+		if strings.Contains(err.Error(), form) {
+			t.Fatalf("error %q contains the token", err)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Package metrics implements counters, gauges and histograms exposed in the
+// Prometheus text format without depending on a Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are histogram upper bounds in seconds suited to API calls
+// and provisioning steps.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Registry holds metric families and writes them in the order they were
+// registered. It is safe for concurrent use. Metrics never panic: samples
+// with the wrong number of label values are dropped.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// family is a metric with its series keyed by their label values.
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+	// counts holds the cumulative bucket counts of a histogram.
+	counts []uint64
+	count  uint64
+}
+
+// Counter is a monotonically increasing value per label combination.
+type Counter struct {
+	r *Registry
+	f *family
+}
+
+// Gauge is a value per label combination that can go up and down.
+type Gauge struct {
+	r *Registry
+	f *family
+}
+
+// Histogram counts observations in buckets per label combination.
+type Histogram struct {
+	r *Registry
+	f *family
+}
+
+// NewCounter registers a counter. Its name should end in _total.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r: r, f: r.register(name, help, "counter", labels, nil)}
+}
+
+// NewGauge registers a gauge.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r: r, f: r.register(name, help, "gauge", labels, nil)}
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds,
+// which must be sorted. The +Inf bucket is added implicitly.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r: r, f: r.register(name, help, "histogram", labels, buckets)}
+}
+
+// register adds a family. Registering a name again returns the family
+// registered first; if its type differs, the new metric is not exported.
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	for _, existing := range r.families {
+		if existing.name != name {
+			continue
+		}
+		if existing.kind == kind {
+			return existing
+		}
+		return f
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// get returns the series for the label values, creating it on first use,
+// or nil when the number of values does not match the labels. The caller
+// holds r.mu.
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		return nil
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: slices.Clone(values)}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Inc adds 1 to the counter with the given label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the counter with the given label values. Negative values
+// are ignored, as counters never decrease.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	if s := c.f.get(values); s != nil {
+		s.value += v
+	}
+}
+
+// Set sets the gauge with the given label values.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.r.mu.Lock()
+	defer g.r.mu.Unlock()
+	if s := g.f.get(values); s != nil {
+		s.value = v
+	}
+}
+
+// Reset removes every series of the gauge, e.g. before setting the values
+// of resources that may have disappeared.
+func (g *Gauge) Reset() {
+	g.r.mu.Lock()
+	defer g.r.mu.Unlock()
+	clear(g.f.series)
+}
+
+// Observe records v in the histogram with the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	s := h.f.get(values)
+	if s == nil {
+		return
+	}
+	for i, upper := range h.f.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// WriteText writes every family in the Prometheus text format, series sorted
+// by their label values.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range r.families {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != "histogram" {
+				fmt.Fprintf(bw, "%s%s %s\n", f.name, labelSet(f.labels, s.values, "", ""), formatValue(s.value))
+				continue
+			}
+			for i, upper := range f.buckets {
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, labelSet(f.labels, s.values, "le", formatValue(upper)), s.counts[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, labelSet(f.labels, s.values, "le", "+Inf"), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", f.name, labelSet(f.labels, s.values, "", ""), formatValue(s.value))
+			fmt.Fprintf(bw, "%s_count%s %d\n", f.name, labelSet(f.labels, s.values, "", ""), s.count)
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteText(w)
+	})
+}
+
+// labelSet formats the labels of a sample, with an extra label such as le
+// appended when extraName is not empty.
+func labelSet(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extraName, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
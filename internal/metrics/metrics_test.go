@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests by method and code.", "method", "code")
+	requests.Inc("POST", "500")
+	requests.Inc("GET", "200")
+	requests.Add(2, "GET", "200")
+	r.NewGauge("up", `Help with a \ and a`+"\nnewline.").Set(1)
+	labelled := r.NewGauge("resource", "Resources by name.", "name")
+	labelled.Set(3, `a "quoted" \ name`+"\n")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.25, 1}, "endpoint")
+	for _, v := range []float64{0.25, 0.5, 4} {
+		latency.Observe(v, "GET /servers/{id}")
+	}
+	r.NewCounter("empty_total", "A counter without series.")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Requests by method and code.
+# TYPE requests_total counter
+requests_total{method="GET",code="200"} 3
+requests_total{method="POST",code="500"} 1
+# HELP up Help with a \\ and a\nnewline.
+# TYPE up gauge
+up 1
+# HELP resource Resources by name.
+# TYPE resource gauge
+resource{name="a \"quoted\" \\ name\n"} 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{endpoint="GET /servers/{id}",le="0.25"} 1
+latency_seconds_bucket{endpoint="GET /servers/{id}",le="1"} 2
+latency_seconds_bucket{endpoint="GET /servers/{id}",le="+Inf"} 3
+latency_seconds_sum{endpoint="GET /servers/{id}"} 4.75
+latency_seconds_count{endpoint="GET /servers/{id}"} 3
+# HELP empty_total A counter without series.
+# TYPE empty_total counter
+`
+	if got := b.String(); got != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestInvalidSamplesAreDropped(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("calls_total", "Calls.", "endpoint")
+	c.Inc("GET /actions/{id}")
+	c.Add(-5, "GET /actions/{id}")
+	c.Inc()
+	c.Inc("GET", "extra")
+	r.NewGauge("g", "Gauge.", "a").Set(1)
+	r.NewHistogram("h_seconds", "Histogram.", []float64{1}, "a").Observe(1)
+
+	// A second registration of the same counter shares its series; one of
+	// another type is not exported.
+	r.NewCounter("calls_total", "Calls.", "endpoint").Inc("GET /actions/{id}")
+	r.NewGauge("calls_total", "Calls.", "endpoint").Set(42, "GET /actions/{id}")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP calls_total Calls.
+# TYPE calls_total counter
+calls_total{endpoint="GET /actions/{id}"} 2
+# HELP g Gauge.
+# TYPE g gauge
+# HELP h_seconds Histogram.
+# TYPE h_seconds histogram
+`
+	if got := b.String(); got != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := map[float64]string{
+		0:       "0",
+		1.5:     "1.5",
+		1e21:    "1e+21",
+		0.00001: "1e-05",
+	}
+	for v, want := range tests {
+		if got := formatValue(v); got != want {
+			t.Errorf("formatValue(%g) = %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("up", "Whether the daemon is up.").Set(1)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	if want := "# TYPE up gauge\nup 1\n"; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("body = %q, want it to contain %q", rec.Body.String(), want)
+	}
+}
@@ -0,0 +1,157 @@
+package sshkey
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"endnet-cli/pkg/models"
+	"endnet-cli/pkg/util"
+)
+
+const keyTypeEd25519 = "ssh-ed25519"
+
+// Populate reads the public key referenced by spec.PublicKeyPath and fills in
+// the key material and fingerprint. A missing key file is not an error; the
+// planner will schedule the key pair to be generated instead.
+func Populate(spec *models.SSHKeySpec) error {
+	if spec.PublicKeyPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(util.ExpandPath(spec.PublicKeyPath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read ssh public key: %w", err)
+	}
+
+	publicKey := strings.TrimSpace(string(data))
+	fingerprint, err := Fingerprint(publicKey)
+	if err != nil {
+		return fmt.Errorf("ssh public key %s: %w", spec.PublicKeyPath, err)
+	}
+
+	spec.PublicKey = publicKey
+	spec.Fingerprint = fingerprint
+	return nil
+}
+
+// Fingerprint returns the MD5 fingerprint of an authorized_keys formatted
+// public key in the colon separated notation used by the Hetzner API.
+func Fingerprint(publicKey string) (string, error) {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 {
+		return "", errors.New("public key must be in authorized_keys format")
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("decode public key: %w", err)
+	}
+
+	sum := md5.Sum(blob)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// Generate creates a new ed25519 key pair. The public key is written to
+// publicKeyPath and the private key to the same path without the ".pub"
+// suffix. The authorized_keys formatted public key is returned.
+func Generate(publicKeyPath, comment string) (string, error) {
+	if publicKeyPath == "" {
+		return "", errors.New("public key path must not be empty")
+	}
+
+	publicKeyPath = util.ExpandPath(publicKeyPath)
+	privateKeyPath := strings.TrimSuffix(publicKeyPath, ".pub")
+	if privateKeyPath == publicKeyPath {
+		return "", fmt.Errorf("public key path %s must end in .pub", publicKeyPath)
+	}
+	if _, err := os.Stat(privateKeyPath); err == nil {
+		return "", fmt.Errorf("refusing to overwrite existing private key %s", privateKeyPath)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("generate ed25519 key: %w", err)
+	}
+
+	privatePEM, err := marshalPrivateKey(pub, priv, comment)
+	if err != nil {
+		return "", err
+	}
+
+	publicKey := fmt.Sprintf("%s %s", keyTypeEd25519, base64.StdEncoding.EncodeToString(marshalPublicKey(pub)))
+	if comment != "" {
+		publicKey += " " + comment
+	}
+
+	if err := os.MkdirAll(filepath.Dir(privateKeyPath), 0o700); err != nil {
+		return "", fmt.Errorf("create key directory: %w", err)
+	}
+	if err := os.WriteFile(privateKeyPath, privatePEM, 0o600); err != nil {
+		return "", fmt.Errorf("write private key: %w", err)
+	}
+	if err := os.WriteFile(publicKeyPath, []byte(publicKey+"\n"), 0o644); err != nil {
+		return "", fmt.Errorf("write public key: %w", err)
+	}
+
+	return publicKey, nil
+}
+
+func marshalPublicKey(pub ed25519.PublicKey) []byte {
+	buf := bytes.NewBuffer(nil)
+	writeString(buf, []byte(keyTypeEd25519))
+	writeString(buf, pub)
+	return buf.Bytes()
+}
+
+// marshalPrivateKey encodes an unencrypted key in the openssh-key-v1 format
+// understood by ssh(1).
+func marshalPrivateKey(pub ed25519.PublicKey, priv ed25519.PrivateKey, comment string) ([]byte, error) {
+	var check [4]byte
+	if _, err := rand.Read(check[:]); err != nil {
+		return nil, fmt.Errorf("generate check bytes: %w", err)
+	}
+
+	section := bytes.NewBuffer(nil)
+	section.Write(check[:])
+	section.Write(check[:])
+	writeString(section, []byte(keyTypeEd25519))
+	writeString(section, pub)
+	writeString(section, priv)
+	writeString(section, []byte(comment))
+	for i := byte(1); section.Len()%8 != 0; i++ {
+		section.WriteByte(i)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("openssh-key-v1\x00")
+	writeString(buf, []byte("none"))
+	writeString(buf, []byte("none"))
+	writeString(buf, nil)
+	_ = binary.Write(buf, binary.BigEndian, uint32(1))
+	writeString(buf, marshalPublicKey(pub))
+	writeString(buf, section.Bytes())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: buf.Bytes()}), nil
+}
+
+func writeString(buf *bytes.Buffer, data []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+}
@@ -1,15 +1,21 @@
 package state
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 
+	"endnet-cli/internal/hetzner"
+	"endnet-cli/internal/ipv64"
 	"endnet-cli/pkg/models"
+	"endnet-cli/pkg/util"
 )
 
-// Retriever gathers state from infrastructure providers.
+// Retriever gathers state from infrastructure providers. Retrieval is aborted
+// when the context is cancelled.
 type Retriever interface {
-	Current(spec models.EndnetSpec) (*models.RemoteState, error)
+	Current(ctx context.Context, spec models.EndnetSpec) (*models.RemoteState, error)
 }
 
 // Snapshotter is a placeholder Retriever that returns empty provider state.
@@ -23,10 +29,13 @@ func NewRetriever() Retriever {
 }
 
 // Current produces a deterministic RemoteState snapshot for bootstrapping.
-func (r *Snapshotter) Current(spec models.EndnetSpec) (*models.RemoteState, error) {
+func (r *Snapshotter) Current(ctx context.Context, spec models.EndnetSpec) (*models.RemoteState, error) {
 	if spec.Project == "" {
 		return nil, errors.New("spec project must not be empty")
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	now := r.Now()
 
@@ -36,6 +45,7 @@ func (r *Snapshotter) Current(spec models.EndnetSpec) (*models.RemoteState, erro
 			Routes:    []models.Route{},
 			Servers:   []models.Server{},
 			Firewalls: []models.Firewall{},
+			SSHKeys:   []models.SSHKey{},
 		},
 		IPv64: models.IPv64State{
 			Domains: map[string]models.Domain{},
@@ -43,3 +53,66 @@ func (r *Snapshotter) Current(spec models.EndnetSpec) (*models.RemoteState, erro
 		RetrievedAt: now,
 	}, nil
 }
+
+// ProviderRetriever reads the current state from the Hetzner and IPv64 APIs.
+// A provider without client is reported as empty, with a warning.
+type ProviderRetriever struct {
+	Hetzner hetzner.Client
+	IPv64   ipv64.Client
+	Now     func() time.Time
+
+	logger util.Logger
+}
+
+// NewProviderRetriever returns a retriever using the given clients, either
+// of which may be nil.
+func NewProviderRetriever(logger util.Logger, hz hetzner.Client, dns ipv64.Client) *ProviderRetriever {
+	if logger == nil {
+		logger = util.NewLogger()
+	}
+	return &ProviderRetriever{Hetzner: hz, IPv64: dns, Now: time.Now, logger: logger}
+}
+
+// Current lists the resources of both providers.
+func (r *ProviderRetriever) Current(ctx context.Context, spec models.EndnetSpec) (*models.RemoteState, error) {
+	if spec.Project == "" {
+		return nil, errors.New("spec project must not be empty")
+	}
+	current, err := (&Snapshotter{Now: r.Now}).Current(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Hetzner == nil {
+		r.logger.Warn("no Hetzner API token is configured; assuming no Hetzner resources exist", util.FieldProvider, "hetzner")
+	} else {
+		hz := &current.Hetzner
+		if hz.Networks, err = r.Hetzner.ListNetworks(ctx); err != nil {
+			return nil, fmt.Errorf("list networks: %w", err)
+		}
+		if hz.Servers, err = r.Hetzner.ListServers(ctx); err != nil {
+			return nil, fmt.Errorf("list servers: %w", err)
+		}
+		if hz.Firewalls, err = r.Hetzner.ListFirewalls(ctx); err != nil {
+			return nil, fmt.Errorf("list firewalls: %w", err)
+		}
+		if hz.SSHKeys, err = r.Hetzner.ListSSHKeys(ctx); err != nil {
+			return nil, fmt.Errorf("list ssh keys: %w", err)
+		}
+	}
+
+	if r.IPv64 == nil {
+		r.logger.Warn("no IPv64 API key is configured; assuming no domains exist", util.FieldProvider, "ipv64")
+	} else {
+		domains, err := r.IPv64.ListDomains(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list domains: %w", err)
+		}
+		for _, d := range domains {
+			current.IPv64.Domains[d.Name] = d
+		}
+	}
+
+	current.RetrievedAt = r.Now()
+	return current, nil
+}
@@ -0,0 +1,200 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+// Severity ranks how serious a drift between the desired and the observed
+// state is.
+type Severity int
+
+// Severities in increasing order.
+const (
+	// SeverityCosmetic drift does not change how the infrastructure behaves,
+	// such as labels or record TTLs.
+	SeverityCosmetic Severity = iota + 1
+	// SeverityFunctional drift changes behaviour, such as missing servers or
+	// DNS records pointing elsewhere.
+	SeverityFunctional
+	// SeveritySecurity drift affects who can reach or access the
+	// infrastructure: firewall rules, SSH key fingerprints and public
+	// addresses.
+	SeveritySecurity
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityCosmetic:
+		return "cosmetic"
+	case SeverityFunctional:
+		return "functional"
+	case SeveritySecurity:
+		return "security"
+	default:
+		return "none"
+	}
+}
+
+// MarshalText renders the severity by name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Changes of alwaysSecurityFields are security-relevant, as are changed
+// values of the securityFields; new values of these are functional. Drift
+// touching only cosmeticFields is cosmetic.
+var (
+	alwaysSecurityFields = []string{"rules", "appliesTo"}
+	securityFields       = []string{"publicIp", "sshKey", "fingerprint"}
+	cosmeticFields       = []string{"labels", "description", "ttl"}
+)
+
+// Classify returns the severity of the drift op reconciles. It depends only
+// on the changed fields, so a missing firewall is security-relevant while a
+// missing SSH key is functional.
+func Classify(op models.Operation) Severity {
+	if len(op.Changes) == 0 {
+		return SeverityFunctional
+	}
+	severity := SeverityCosmetic
+	for _, c := range op.Changes {
+		switch {
+		case slices.Contains(alwaysSecurityFields, c.Field):
+			return SeveritySecurity
+		case slices.Contains(securityFields, c.Field) && c.Before != "":
+			return SeveritySecurity
+		case !slices.Contains(cosmeticFields, c.Field):
+			severity = SeverityFunctional
+		}
+	}
+	return severity
+}
+
+// Drift is a difference between the desired and the observed state of one
+// resource: an actionable plan operation and its severity.
+type Drift struct {
+	Operation models.Operation `json:"operation"`
+	Severity  Severity         `json:"severity"`
+}
+
+// DetectDrift returns the drift in plan ordered by plan, leaving out no-ops
+// and the drift accepted by baseline, which is returned separately.
+func DetectDrift(plan *models.Plan, baseline *Baseline) (drift, accepted []Drift) {
+	for _, op := range plan.Operations() {
+		if !op.Actionable() {
+			continue
+		}
+		d := Drift{Operation: op, Severity: Classify(op)}
+		if baseline.Accepts(op) {
+			accepted = append(accepted, d)
+			continue
+		}
+		drift = append(drift, d)
+	}
+	return drift, accepted
+}
+
+// MaxSeverity returns the highest severity in drift, 0 when there is none.
+func MaxSeverity(drift []Drift) Severity {
+	var highest Severity
+	for _, d := range drift {
+		highest = max(highest, d.Severity)
+	}
+	return highest
+}
+
+// BaselineFormatVersion is the version of the baseline file format.
+const BaselineFormatVersion = 1
+
+// Baseline lists drift that was reviewed and accepted, so scheduled checks
+// only report new drift.
+type Baseline struct {
+	FormatVersion int             `json:"formatVersion"`
+	Accepted      []BaselineEntry `json:"accepted"`
+}
+
+// BaselineEntry accepts drift of Target. Type and Changes narrow it down to
+// drift of that operation type and with exactly those changes, so a different
+// drift of the target is reported again; omitted, they match any drift.
+type BaselineEntry struct {
+	Target     string          `json:"target"`
+	Type       string          `json:"type,omitempty"`
+	Changes    []models.Change `json:"changes,omitempty"`
+	AcceptedAt time.Time       `json:"acceptedAt,omitzero"`
+	Reason     string          `json:"reason,omitempty"`
+}
+
+// LoadBaseline reads the baseline file at path. Errors for a missing file
+// match os.ErrNotExist.
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read baseline: %w", err)
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("parse baseline %s: %w", path, err)
+	}
+	if b.FormatVersion > BaselineFormatVersion {
+		return nil, fmt.Errorf("baseline %s has formatVersion %d; this version supports %d", path, b.FormatVersion, BaselineFormatVersion)
+	}
+	for i, e := range b.Accepted {
+		if e.Target == "" {
+			return nil, fmt.Errorf("baseline %s: entry %d has no target", path, i+1)
+		}
+	}
+	return &b, nil
+}
+
+// Update returns a baseline accepting exactly drift, the current drift
+// including the drift b already accepts. Entries of b still matching drift
+// are kept with their reasons, entries no longer needed are dropped and the
+// remaining drift is accepted as of now. b may be nil.
+func (b *Baseline) Update(drift []Drift) *Baseline {
+	updated := &Baseline{FormatVersion: BaselineFormatVersion, Accepted: []BaselineEntry{}}
+	if b != nil {
+		for _, e := range b.Accepted {
+			single := &Baseline{Accepted: []BaselineEntry{e}}
+			if slices.ContainsFunc(drift, func(d Drift) bool { return single.Accepts(d.Operation) }) {
+				updated.Accepted = append(updated.Accepted, e)
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, d := range drift {
+		if updated.Accepts(d.Operation) {
+			continue
+		}
+		updated.Accepted = append(updated.Accepted, BaselineEntry{
+			Target:     d.Operation.Target,
+			Type:       d.Operation.Type,
+			Changes:    d.Operation.Changes,
+			AcceptedAt: now,
+		})
+	}
+	return updated
+}
+
+// Accepts reports whether the baseline accepts the drift op reconciles. A nil
+// baseline accepts nothing.
+func (b *Baseline) Accepts(op models.Operation) bool {
+	if b == nil {
+		return false
+	}
+	for _, e := range b.Accepted {
+		if e.Target != op.Target {
+			continue
+		}
+		if (e.Type == "" || e.Type == op.Type) && (len(e.Changes) == 0 || slices.Equal(e.Changes, op.Changes)) {
+			return true
+		}
+	}
+	return false
+}
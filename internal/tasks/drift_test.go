@@ -0,0 +1,168 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		op   models.Operation
+		want Severity
+	}{
+		{
+			name: "firewall rules differ",
+			op:   models.Operation{Type: "reconcile", Target: "firewall:endnet-edge", Changes: []models.Change{{Field: "rules", Before: "in tcp 22", After: "in tcp 22; in tcp 443"}}},
+			want: SeveritySecurity,
+		},
+		{
+			name: "missing firewall",
+			op:   models.Operation{Type: "create", Target: "firewall:endnet-edge", Changes: []models.Change{{Field: "rules", After: "in tcp 22"}}},
+			want: SeveritySecurity,
+		},
+		{
+			name: "fingerprint changed",
+			op:   models.Operation{Type: "drift", Target: "sshkey:endnet", Changes: []models.Change{{Field: "fingerprint", Before: "SHA256:a", After: "SHA256:b"}}},
+			want: SeveritySecurity,
+		},
+		{
+			name: "missing ssh key",
+			op:   models.Operation{Type: "create", Target: "sshkey:endnet", Changes: []models.Change{{Field: "fingerprint", After: "SHA256:b"}}},
+			want: SeverityFunctional,
+		},
+		{
+			name: "missing server",
+			op: models.Operation{Type: "create", Target: "server:endnet-edge-1", Changes: []models.Change{
+				{Field: "type", After: "cx23"}, {Field: "publicIp", After: "true"}, {Field: "sshKey", After: "endnet"},
+			}},
+			want: SeverityFunctional,
+		},
+		{
+			name: "A record points elsewhere",
+			op:   models.Operation{Type: "update", Target: "dns:A endnet.ipv64.net", Changes: []models.Change{{Field: "value", Before: "192.0.2.9", After: "192.0.2.1"}}},
+			want: SeverityFunctional,
+		},
+		{
+			name: "only ttl differs",
+			op:   models.Operation{Type: "update", Target: "dns:A endnet.ipv64.net", Changes: []models.Change{{Field: "ttl", Before: "60", After: "300"}}},
+			want: SeverityCosmetic,
+		},
+		{
+			name: "no changes listed",
+			op:   models.Operation{Type: "verify", Target: "dns:endnet.ipv64.net"},
+			want: SeverityFunctional,
+		},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.op); got != tt.want {
+			t.Errorf("%s: Classify = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectDriftConverged(t *testing.T) {
+	spec := testSpec()
+	plan, err := NewPlanner().Plan(context.Background(), spec, convergedState(spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drift, accepted := DetectDrift(plan, nil)
+	if len(drift) != 0 || len(accepted) != 0 || MaxSeverity(drift) != 0 {
+		t.Fatalf("drift %+v, accepted %+v; want none", drift, accepted)
+	}
+}
+
+func TestBaselineAccepts(t *testing.T) {
+	changes := []models.Change{{Field: "value", Before: "192.0.2.9", After: "192.0.2.1"}}
+	op := models.Operation{Type: "update", Target: "dns:A endnet.ipv64.net", Changes: changes}
+
+	tests := []struct {
+		name  string
+		entry BaselineEntry
+		want  bool
+	}{
+		{"target only", BaselineEntry{Target: op.Target}, true},
+		{"target and type", BaselineEntry{Target: op.Target, Type: "update"}, true},
+		{"exact changes", BaselineEntry{Target: op.Target, Type: "update", Changes: changes}, true},
+		{"other target", BaselineEntry{Target: "dns:CNAME git.endnet.ipv64.net"}, false},
+		{"other type", BaselineEntry{Target: op.Target, Type: "ensure"}, false},
+		{"other changes", BaselineEntry{Target: op.Target, Changes: []models.Change{{Field: "value", Before: "192.0.2.8", After: "192.0.2.1"}}}, false},
+	}
+	for _, tt := range tests {
+		b := &Baseline{Accepted: []BaselineEntry{tt.entry}}
+		if got := b.Accepts(op); got != tt.want {
+			t.Errorf("%s: Accepts = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	var nilBaseline *Baseline
+	if nilBaseline.Accepts(op) {
+		t.Error("nil baseline accepts drift")
+	}
+}
+
+func TestBaselineUpdate(t *testing.T) {
+	aRecord := models.Operation{Type: "update", Target: "dns:A endnet.ipv64.net", Changes: []models.Change{{Field: "value", Before: "192.0.2.9", After: "192.0.2.1"}}}
+	firewall := models.Operation{Type: "reconcile", Target: "firewall:endnet-edge", Changes: []models.Change{{Field: "rules", Before: "in tcp 22", After: "in tcp 22; in tcp 443"}}}
+	old := &Baseline{FormatVersion: BaselineFormatVersion, Accepted: []BaselineEntry{
+		{Target: aRecord.Target, Reason: "migrating DNS"},
+		{Target: "server:endnet-git-1", Reason: "no longer drifting"},
+	}}
+
+	updated := old.Update([]Drift{{Operation: aRecord}, {Operation: firewall}})
+
+	if len(updated.Accepted) != 2 {
+		t.Fatalf("accepted = %+v, want the A record and the firewall", updated.Accepted)
+	}
+	if kept := updated.Accepted[0]; kept.Target != aRecord.Target || kept.Reason != "migrating DNS" || kept.Type != "" {
+		t.Errorf("kept entry = %+v, want the original entry with its reason", kept)
+	}
+	added := updated.Accepted[1]
+	if added.Target != firewall.Target || added.Type != "reconcile" || !slices.Equal(added.Changes, firewall.Changes) || added.AcceptedAt.IsZero() {
+		t.Errorf("added entry = %+v, want the firewall drift accepted now", added)
+	}
+
+	if got := (*Baseline)(nil).Update(nil); got.FormatVersion != BaselineFormatVersion || got.Accepted == nil || len(got.Accepted) != 0 {
+		t.Errorf("Update of nil baseline = %+v, want an empty baseline", got)
+	}
+}
+
+func TestLoadBaseline(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	b, err := LoadBaseline(write("ok.json", `{"formatVersion":1,"accepted":[{"target":"server:a","acceptedAt":"2026-01-02T03:04:05Z"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Accepted) != 1 || !b.Accepted[0].AcceptedAt.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("baseline = %+v", b)
+	}
+
+	for name, content := range map[string]string{
+		"newer.json":     `{"formatVersion":2,"accepted":[]}`,
+		"notarget.json":  `{"formatVersion":1,"accepted":[{"type":"create"}]}`,
+		"malformed.json": `{"formatVersion":`,
+	} {
+		if _, err := LoadBaseline(write(name, content)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	if _, err := LoadBaseline(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: error %v, want os.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,79 @@
+package tasks
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+// EventKind identifies the stage of an operation an Event reports on.
+type EventKind string
+
+// Event kinds emitted by the executor.
+const (
+	EventStarted  EventKind = "started"
+	EventProgress EventKind = "progress"
+	EventRetrying EventKind = "retrying"
+	EventFinished EventKind = "finished"
+	EventFailed   EventKind = "failed"
+	// EventSkipped reports an operation the resumed run had already applied.
+	EventSkipped EventKind = "skipped"
+
+	// Rollback events carry the compensating operation and the Index of
+	// the operation it undoes.
+	EventRollingBack    EventKind = "rolling-back"
+	EventRolledBack     EventKind = "rolled-back"
+	EventRollbackFailed EventKind = "rollback-failed"
+)
+
+// Event reports progress of a single operation while a plan is executed.
+// Index is the zero-based position of the operation among Total operations.
+// Action is set for EventProgress events emitted while polling a provider
+// action. Retry is set for EventRetrying events emitted before a failed
+// provider call is repeated. Elapsed is measured from the operation's
+// EventStarted event.
+type Event struct {
+	Kind      EventKind
+	Operation models.Operation
+	Index     int
+	Total     int
+	Action    *models.Action
+	Retry     *models.Retry
+	Elapsed   time.Duration
+	Err       error
+	Time      time.Time
+}
+
+// Observer receives execution events. Operations run concurrently, but
+// observers are called one event at a time and must not block.
+type Observer func(Event)
+
+// NewProgressWriter returns an Observer that prints one line per event to w,
+// suitable for plain CLI output.
+func NewProgressWriter(w io.Writer) Observer {
+	return func(e Event) {
+		prefix := fmt.Sprintf("[%d/%d] %s %s", e.Index+1, e.Total, e.Operation.Type, e.Operation.Target)
+		switch e.Kind {
+		case EventStarted:
+			fmt.Fprintf(w, "%s ...\n", prefix)
+		case EventProgress:
+			fmt.Fprintf(w, "%s: action %d %s %s %d%%\n", prefix, e.Action.ID, e.Action.Command, e.Action.Status, e.Action.Progress)
+		case EventSkipped:
+			fmt.Fprintf(w, "%s skipped, applied by the interrupted run\n", prefix)
+		case EventRetrying:
+			fmt.Fprintf(w, "%s: attempt %d failed, retrying in %s: %s\n", prefix, e.Retry.Attempt, e.Retry.Delay.Round(time.Millisecond), e.Retry.Error)
+		case EventFinished:
+			fmt.Fprintf(w, "%s done in %s\n", prefix, e.Elapsed.Round(time.Millisecond))
+		case EventFailed:
+			fmt.Fprintf(w, "%s failed after %s: %v\n", prefix, e.Elapsed.Round(time.Millisecond), e.Err)
+		case EventRollingBack:
+			fmt.Fprintf(w, "%s: rolling back ...\n", prefix)
+		case EventRolledBack:
+			fmt.Fprintf(w, "%s rolled back in %s\n", prefix, e.Elapsed.Round(time.Millisecond))
+		case EventRollbackFailed:
+			fmt.Fprintf(w, "%s rollback failed after %s: %v\n", prefix, e.Elapsed.Round(time.Millisecond), e.Err)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package tasks
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 
 	"endnet-cli/pkg/models"
@@ -10,43 +15,467 @@ import (
 
 // Executor applies plans and reports their results.
 type Executor interface {
-	Execute(plan *models.Plan) (*models.ExecutionResult, error)
+	Execute(ctx context.Context, plan *models.Plan) (*models.ExecutionResult, error)
+	// Observe registers an observer for the events of subsequent
+	// executions and returns a function removing it again.
+	Observe(observer Observer) (remove func())
 }
 
-// DefaultExecutor logs the operations that would be executed.
-type DefaultExecutor struct {
+// Applier performs the provider calls behind a single operation and returns
+// the asynchronous provider actions it started, if any. Provider calls are
+// aborted when the context is cancelled.
+type Applier interface {
+	Apply(ctx context.Context, op models.Operation) ([]models.Action, error)
+}
+
+// ActionPoller reports the current status of an asynchronous provider action.
+// hetzner.Client satisfies this interface.
+type ActionPoller interface {
+	GetAction(ctx context.Context, id int) (*models.Action, error)
+}
+
+// DryRunApplier logs operations without contacting any provider.
+type DryRunApplier struct {
 	logger util.Logger
 }
 
-// NewExecutor constructs an Executor with the provided logger.
+// Apply logs the operation.
+func (a *DryRunApplier) Apply(ctx context.Context, op models.Operation) ([]models.Action, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	operationLogger(a.logger, op).Info("dry run", "details", op.Details)
+	return nil, nil
+}
+
+// DefaultExecutor applies operations through its Applier and waits for the
+// provider actions they start to complete. Operations run as soon as all
+// operations they depend on have been applied, at most Parallelism at a time,
+// so the Applier must be safe for concurrent use.
+//
+// Applier and Poller calls failing with a retryable error (see IsRetryable)
+// are repeated according to the RetryPolicy for the operation's resource kind
+// in Retry, falling back to DefaultRetryPolicy.
+//
+// With RollbackOnFailure, a failed execution is rolled back by applying the
+// Compensation of every applied operation in reverse order.
+//
+// Hooks run before and after the operations they match. A failing before
+// hook vetoes its operation, which then fails with a VetoError. Hooks do not
+// run for compensating operations.
+type DefaultExecutor struct {
+	Applier      Applier
+	Poller       ActionPoller
+	PollInterval time.Duration
+	Parallelism  int
+	Retry        map[string]models.RetryPolicy
+	Hooks        []models.Hook
+
+	RollbackOnFailure bool
+
+	// Journal, when set, records the progress of every execution. With
+	// Resume, Execute continues the run described by the journal.
+	Journal *Journal
+	Resume  *ResumeState
+
+	logger    util.Logger
+	mu        sync.Mutex
+	observers []*Observer
+	// emitMu serialises observer calls from concurrent operations.
+	emitMu sync.Mutex
+}
+
+// ExecutorOptions configures an executor created by NewExecutorWithOptions.
+type ExecutorOptions struct {
+	// Applier performs the operations; a DryRunApplier when nil.
+	Applier Applier
+	// Poller reports the status of the provider actions operations start,
+	// including those of a resumed run.
+	Poller ActionPoller
+	// Parallelism bounds the number of operations applied at the same time.
+	// Defaults to DefaultParallelism.
+	Parallelism int
+	// Retry holds retry policies by resource kind, such as "server" or
+	// "dns". Kinds without a policy use DefaultRetryPolicy.
+	Retry map[string]models.RetryPolicy
+	// RollbackOnFailure undoes the applied operations when one fails.
+	RollbackOnFailure bool
+	// Journal records the progress of executions so they can be resumed.
+	Journal *Journal
+	// Resume continues the interrupted run read from a journal. Operations
+	// it finished are skipped and provider actions of operations that were
+	// in flight are awaited instead of applying the operations again.
+	Resume *ResumeState
+	// Hooks are commands run before and after matching operations.
+	Hooks []models.Hook
+}
+
+// DefaultParallelism is the number of operations applied concurrently unless
+// configured otherwise.
+const DefaultParallelism = 4
+
+// NewExecutor constructs an Executor with the provided logger. The returned
+// executor performs a dry run until a different Applier is configured.
 func NewExecutor(logger util.Logger) Executor {
+	return NewExecutorWithOptions(logger, ExecutorOptions{})
+}
+
+// NewExecutorWithOptions constructs an Executor from the given options.
+func NewExecutorWithOptions(logger util.Logger, opts ExecutorOptions) Executor {
 	if logger == nil {
 		logger = util.NewLogger()
 	}
-	return &DefaultExecutor{logger: logger}
+	if opts.Parallelism < 1 {
+		opts.Parallelism = DefaultParallelism
+	}
+	var applier Applier = &DryRunApplier{logger: logger}
+	if opts.Applier != nil {
+		applier = opts.Applier
+	}
+	return &DefaultExecutor{
+		Applier:      applier,
+		Poller:       opts.Poller,
+		PollInterval: time.Second,
+		Parallelism:  opts.Parallelism,
+		Retry:        opts.Retry,
+		Hooks:        opts.Hooks,
+		logger:       logger,
+
+		RollbackOnFailure: opts.RollbackOnFailure,
+		Journal:           opts.Journal,
+		Resume:            opts.Resume,
+	}
+}
+
+// Observe registers an observer for the events of subsequent executions and
+// returns a function removing it again.
+func (e *DefaultExecutor) Observe(observer Observer) (remove func()) {
+	if observer == nil {
+		return func() {}
+	}
+	registered := &observer
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.observers = append(e.observers, registered)
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.observers = slices.DeleteFunc(e.observers, func(o *Observer) bool { return o == registered })
+	}
 }
 
-// Execute iterates through plan operations and logs them.
-func (e *DefaultExecutor) Execute(plan *models.Plan) (*models.ExecutionResult, error) {
+// Execute applies the plan operations in dependency order. After the first
+// failure no further operations are started; those already running are
+// awaited. The returned result lists the applied operations in the order
+// they completed and the error joins every failure.
+//
+// With RollbackOnFailure, the applied operations are then undone and the
+// result's Rollback reports what was rolled back and what was not.
+//
+// Cancelling ctx interrupts the execution: no further operations are started
+// and the provider calls of running operations are aborted. Interrupted
+// operations stay in flight in the journal and the execution is not rolled
+// back, so it can be resumed.
+func (e *DefaultExecutor) Execute(ctx context.Context, plan *models.Plan) (*models.ExecutionResult, error) {
 	if plan == nil {
 		return nil, errors.New("plan must not be nil")
 	}
 
+	ops := plan.Operations()
+	if err := ValidateGraph(ops); err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
+
+	result := &models.ExecutionResult{StartedAt: time.Now(), Operations: make([]models.OperationResult, len(ops))}
+	for i, op := range ops {
+		result.Operations[i] = models.OperationResult{Operation: op, Status: models.OperationNotRun}
+	}
+	if _, ok := e.Applier.(*DryRunApplier); ok {
+		result.Notes = append(result.Notes, "dry-run execution")
+	}
+
+	begin := JournalEntry{Event: JournalBegin, Plan: plan}
+	if e.Resume != nil {
+		begin = JournalEntry{Event: JournalResume}
+		result.Notes = append(result.Notes, "resumed interrupted run")
+	}
+	if err := e.Journal.Record(begin); err != nil {
+		return nil, err
+	}
+
+	// waiting counts the unfinished dependencies of every operation;
+	// dependents lists the operations waiting for a target.
+	index := make(map[string]int, len(ops))
+	for i, op := range ops {
+		index[op.Target] = i
+	}
+	waiting := make([]int, len(ops))
+	dependents := make([][]int, len(ops))
+	var ready []int
+	for i, op := range ops {
+		deps := make(map[string]bool)
+		for _, dep := range op.DependsOn {
+			deps[dep] = true
+		}
+		for dep := range deps {
+			dependents[index[dep]] = append(dependents[index[dep]], i)
+		}
+		waiting[i] = len(deps)
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	var resultMu sync.Mutex
+	record := func(r models.Retry) {
+		resultMu.Lock()
+		defer resultMu.Unlock()
+		result.Retries = append(result.Retries, r)
+	}
+
+	parallelism := max(e.Parallelism, 1)
+	type outcome struct {
+		index     int
+		skipped   bool
+		err       error
+		started   time.Time
+		completed time.Time
+	}
+	done := make(chan outcome)
+	running, completed := 0, 0
+	var failures []error
+	var compensations []compensation
+
+	for len(ready) > 0 || running > 0 {
+		for len(failures) == 0 && ctx.Err() == nil && running < parallelism && len(ready) > 0 {
+			i := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				started := time.Now()
+				skipped, err := e.run(ctx, ops[i], i, len(ops), record)
+				done <- outcome{index: i, skipped: skipped, err: err, started: started, completed: time.Now()}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		out := <-done
+		running--
+		op := &result.Operations[out.index]
+		op.StartedAt, op.CompletedAt = out.started, out.completed
+		switch {
+		case out.err != nil && ctx.Err() != nil && errors.Is(out.err, ctx.Err()):
+			op.Status = models.OperationInterrupted
+		case out.err != nil:
+			op.Status = models.OperationFailed
+		case out.skipped:
+			op.Status = models.OperationSkipped
+		default:
+			op.Status = models.OperationApplied
+		}
+		if out.err != nil {
+			op.Error = out.err.Error()
+			failures = append(failures, out.err)
+			continue
+		}
+		completed++
+		if !out.skipped {
+			result.AppliedOperations = append(result.AppliedOperations, ops[out.index])
+		}
+		if undo, ok := Compensation(ops[out.index]); !out.skipped && (undo != nil || !ok) {
+			compensations = append(compensations, compensation{index: out.index, applied: ops[out.index], undo: undo})
+		}
+		for _, d := range dependents[out.index] {
+			if waiting[d]--; waiting[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+		// Start ready operations in plan order.
+		sort.Ints(ready)
+	}
+
+	interrupted := ctx.Err() != nil && completed < len(ops)
+	if interrupted {
+		e.logger.Warn("execution interrupted", "completed", completed, "operations", len(ops), "error", ctx.Err())
+		failures = append(failures, fmt.Errorf("execution interrupted after %d of %d operations: %w", completed, len(ops), ctx.Err()))
+	}
+
+	switch {
+	case len(failures) == 0 || !e.RollbackOnFailure:
+	case interrupted:
+		e.logger.Warn("not rolling back an interrupted execution; resume it instead")
+	default:
+		result.Rollback = e.rollback(ctx, compensations, len(ops), record)
+	}
+
+	end := JournalEntry{Event: JournalEnd, RolledBack: result.Rollback != nil}
+	if err := errors.Join(failures...); err != nil {
+		end.Error = err.Error()
+	}
+	if err := e.Journal.Record(end); err != nil {
+		failures = append(failures, err)
+	}
+
+	resultMu.Lock()
+	defer resultMu.Unlock()
+	result.ChangesApplied = len(result.AppliedOperations) > 0
+	result.CompletedAt = time.Now()
+	return result, errors.Join(failures...)
+}
+
+// run applies a single operation and reports its progress to the observers
+// and the journal. It reports whether the operation was skipped because the
+// resumed run had already applied it. Operations interrupted by ctx are not
+// journaled as failed, so resuming the run picks them up again.
+func (e *DefaultExecutor) run(ctx context.Context, op models.Operation, index, total int, record func(models.Retry)) (bool, error) {
+	if e.Resume != nil && e.Resume.Finished[op.Target] {
+		e.emit(Event{Kind: EventSkipped, Operation: op, Index: index, Total: total})
+		return true, nil
+	}
+
 	started := time.Now()
-	var applied []models.Operation
+	e.emit(Event{Kind: EventStarted, Operation: op, Index: index, Total: total})
+
+	retried := func(r models.Retry) {
+		record(r)
+		e.emit(Event{Kind: EventRetrying, Operation: op, Index: index, Total: total, Elapsed: time.Since(started), Retry: &r})
+	}
+	err := e.Journal.Record(JournalEntry{Event: JournalStart, Target: op.Target})
+	if err == nil {
+		err = e.runHooks(ctx, models.HookBefore, op)
+	}
+	if err == nil {
+		err = e.apply(ctx, op, index, total, started, retried)
+	}
+	switch {
+	case err == nil:
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		operationLogger(e.logger, op).Warn("operation interrupted", "error", err)
+	default:
+		operationLogger(e.logger, op).Error("operation failed", "error", err)
+		if jerr := e.Journal.Record(JournalEntry{Event: JournalFail, Target: op.Target, Error: err.Error()}); jerr != nil {
+			err = errors.Join(err, jerr)
+		}
+	}
+	if err != nil {
+		e.emit(Event{Kind: EventFailed, Operation: op, Index: index, Total: total, Elapsed: time.Since(started), Err: err})
+		return false, fmt.Errorf("%s %s: %w", op.Type, op.Target, err)
+	}
+
+	if err := e.Journal.Record(JournalEntry{Event: JournalFinish, Target: op.Target}); err != nil {
+		return false, fmt.Errorf("%s %s: %w", op.Type, op.Target, err)
+	}
+	e.runHooks(ctx, models.HookAfter, op)
+	e.emit(Event{Kind: EventFinished, Operation: op, Index: index, Total: total, Elapsed: time.Since(started)})
+	return false, nil
+}
+
+// apply calls the Applier and waits for the actions it started. Operations
+// that were in flight in a resumed run with recorded actions are not applied
+// again; their actions are awaited instead.
+func (e *DefaultExecutor) apply(ctx context.Context, op models.Operation, index, total int, started time.Time, record func(models.Retry)) error {
+	var actions []models.Action
+	if ids := e.inFlightActions(op); len(ids) > 0 {
+		operationLogger(e.logger, op).Info("awaiting actions of the interrupted run", "actions", ids)
+		for _, id := range ids {
+			actions = append(actions, models.Action{ID: id, Command: "resume", Status: models.ActionRunning})
+		}
+	} else {
+		err := e.retry(ctx, op, record, func() error {
+			var err error
+			actions, err = e.Applier.Apply(ctx, op)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, action := range actions {
+		if err := e.Journal.Record(JournalEntry{Event: JournalAction, Target: op.Target, Action: action.ID}); err != nil {
+			return err
+		}
+	}
+
+	for _, action := range actions {
+		if err := e.wait(ctx, action, op, index, total, started, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inFlightActions returns the actions the resumed run started for op.
+func (e *DefaultExecutor) inFlightActions(op models.Operation) []int {
+	if e.Resume == nil {
+		return nil
+	}
+	return e.Resume.InFlight[op.Target]
+}
+
+// wait polls a provider action until it leaves the running state, emitting a
+// progress event for every observed status.
+func (e *DefaultExecutor) wait(ctx context.Context, action models.Action, op models.Operation, index, total int, started time.Time, record func(models.Retry)) error {
+	current := &action
+	for {
+		e.emit(Event{Kind: EventProgress, Operation: op, Index: index, Total: total, Action: current, Elapsed: time.Since(started)})
+		if current.Status != models.ActionRunning {
+			break
+		}
+		if e.Poller == nil {
+			return fmt.Errorf("action %d is still running but no action poller is configured", action.ID)
+		}
+		operationLogger(e.logger, op).Debug("waiting for action", "action", current.ID, "command", current.Command, "progress", current.Progress)
 
-	for _, ops := range [][]models.Operation{plan.NetworkOps, plan.ServerOps, plan.FirewallOps, plan.DNSOps} {
-		for _, op := range ops {
-			e.logger.Infof("%s %s (%s)", op.Type, op.Target, op.Details)
-			applied = append(applied, op)
+		if err := sleep(ctx, e.PollInterval); err != nil {
+			return fmt.Errorf("wait for action %d: %w", action.ID, err)
+		}
+		var next *models.Action
+		err := e.retry(ctx, op, record, func() error {
+			var err error
+			next, err = e.Poller.GetAction(ctx, action.ID)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("poll action %d: %w", action.ID, err)
 		}
+		current = next
+	}
+
+	if current.Status == models.ActionError {
+		return fmt.Errorf("action %d (%s) failed: %s", current.ID, current.Command, current.Error)
 	}
+	return nil
+}
+
+func (e *DefaultExecutor) emit(event Event) {
+	event.Time = time.Now()
+
+	e.mu.Lock()
+	observers := slices.Clone(e.observers)
+	e.mu.Unlock()
 
-	return &models.ExecutionResult{
-		ChangesApplied:    len(applied) > 0,
-		AppliedOperations: applied,
-		StartedAt:         started,
-		CompletedAt:       time.Now(),
-		Notes:             []string{"dry-run execution"},
-	}, nil
+	e.emitMu.Lock()
+	defer e.emitMu.Unlock()
+	for _, observer := range observers {
+		(*observer)(event)
+	}
+}
+
+// operationLogger returns a logger annotated with the operation's type,
+// target and provider.
+func operationLogger(logger util.Logger, op models.Operation) util.Logger {
+	return logger.With(util.FieldOp, op.Type, util.FieldTarget, op.Target, util.FieldProvider, providerFor(op))
+}
+
+// providerFor names the provider responsible for an operation's resource.
+func providerFor(op models.Operation) string {
+	switch op.Kind() {
+	case "dns":
+		return "ipv64"
+	default:
+		return "hetzner"
+	}
 }
@@ -0,0 +1,29 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+
+	"endnet-cli/pkg/models"
+)
+
+func TestObserveReturnsRemove(t *testing.T) {
+	e := NewExecutorWithOptions(nil, ExecutorOptions{})
+	plan := &models.Plan{NetworkOps: []models.Operation{{Type: "noop", Target: "network:a"}}}
+
+	var first, second int
+	removeFirst := e.Observe(func(Event) { first++ })
+	e.Observe(func(Event) { second++ })
+	if _, err := e.Execute(context.Background(), plan); err != nil {
+		t.Fatal(err)
+	}
+	removeFirst()
+	removeFirst()
+	if _, err := e.Execute(context.Background(), plan); err != nil {
+		t.Fatal(err)
+	}
+
+	if first == 0 || second != 2*first {
+		t.Fatalf("events: removed observer %d, remaining observer %d; want the removed one to see only the first execution", first, second)
+	}
+}
@@ -0,0 +1,124 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+
+	"endnet-cli/pkg/models"
+)
+
+// ValidateGraph checks that the operations form a directed acyclic graph:
+// every target is planned once, every dependency names a planned target and
+// no operation depends on itself, directly or transitively.
+func ValidateGraph(ops []models.Operation) error {
+	byTarget := make(map[string]models.Operation, len(ops))
+	for _, op := range ops {
+		if _, ok := byTarget[op.Target]; ok {
+			return fmt.Errorf("target %s is planned more than once", op.Target)
+		}
+		byTarget[op.Target] = op
+	}
+	for _, op := range ops {
+		for _, dep := range op.DependsOn {
+			if _, ok := byTarget[dep]; !ok {
+				return fmt.Errorf("%s depends on %s, which is not part of the plan", op.Target, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(ops))
+	var path []string
+	var visit func(target string) error
+	visit = func(target string) error {
+		switch state[target] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for path[start] != target {
+				start++
+			}
+			cycle := append(path[start:], target)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+
+		state[target] = visiting
+		path = append(path, target)
+		for _, dep := range byTarget[target].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[target] = visited
+		return nil
+	}
+	for _, op := range ops {
+		if err := visit(op.Target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dependents returns the targets of all operations that depend on target,
+// directly or transitively, in plan order.
+func Dependents(ops []models.Operation, target string) []string {
+	reached := map[string]bool{target: true}
+	// Operations may reference later operations, so iterate until no new
+	// dependents are discovered.
+	for changed := true; changed; {
+		changed = false
+		for _, op := range ops {
+			if reached[op.Target] {
+				continue
+			}
+			for _, dep := range op.DependsOn {
+				if reached[dep] {
+					reached[op.Target] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return collect(ops, reached, target)
+}
+
+// Dependencies returns the targets of all operations that target depends on,
+// directly or transitively, in plan order.
+func Dependencies(ops []models.Operation, target string) []string {
+	byTarget := make(map[string]models.Operation, len(ops))
+	for _, op := range ops {
+		byTarget[op.Target] = op
+	}
+
+	reached := map[string]bool{target: true}
+	queue := []string{target}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dep := range byTarget[current].DependsOn {
+			if !reached[dep] {
+				reached[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return collect(ops, reached, target)
+}
+
+func collect(ops []models.Operation, reached map[string]bool, exclude string) []string {
+	var targets []string
+	for _, op := range ops {
+		if op.Target != exclude && reached[op.Target] {
+			targets = append(targets, op.Target)
+		}
+	}
+	return targets
+}
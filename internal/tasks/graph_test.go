@@ -0,0 +1,85 @@
+package tasks
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"endnet-cli/pkg/models"
+)
+
+func TestValidateGraph(t *testing.T) {
+	op := func(target string, deps ...string) models.Operation {
+		return models.Operation{Type: "create", Target: target, DependsOn: deps}
+	}
+	tests := []struct {
+		name    string
+		ops     []models.Operation
+		wantErr string
+	}{
+		{
+			name: "acyclic",
+			ops:  []models.Operation{op("network:n"), op("server:a", "network:n"), op("dns:A a", "server:a", "network:n")},
+		},
+		{
+			name: "dependency on a later operation",
+			ops:  []models.Operation{op("server:a", "network:n"), op("network:n")},
+		},
+		{
+			name:    "self dependency",
+			ops:     []models.Operation{op("server:a", "server:a")},
+			wantErr: "dependency cycle: server:a -> server:a",
+		},
+		{
+			name:    "transitive cycle",
+			ops:     []models.Operation{op("network:n"), op("server:a", "dns:x"), op("firewall:f", "server:a"), op("dns:x", "firewall:f")},
+			wantErr: "dependency cycle: server:a -> dns:x -> firewall:f -> server:a",
+		},
+		{
+			name:    "unknown dependency",
+			ops:     []models.Operation{op("server:a", "network:missing")},
+			wantErr: "server:a depends on network:missing, which is not part of the plan",
+		},
+		{
+			name:    "duplicate target",
+			ops:     []models.Operation{op("server:a"), op("server:a")},
+			wantErr: "target server:a is planned more than once",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateGraph(tt.ops)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDependentsAndDependencies(t *testing.T) {
+	ops := []models.Operation{
+		{Target: "network:n"},
+		{Target: "sshkey:k"},
+		{Target: "server:a", DependsOn: []string{"network:n", "sshkey:k"}},
+		{Target: "server:b", DependsOn: []string{"network:n"}},
+		{Target: "firewall:f", DependsOn: []string{"server:a"}},
+		{Target: "dns:A a", DependsOn: []string{"server:a"}},
+		{Target: "dns:CNAME b", DependsOn: []string{"dns:A a"}},
+	}
+
+	if got, want := Dependents(ops, "server:a"), []string{"firewall:f", "dns:A a", "dns:CNAME b"}; !slices.Equal(got, want) {
+		t.Errorf("Dependents(server:a) = %v, want %v", got, want)
+	}
+	if got, want := Dependents(ops, "network:n"), []string{"server:a", "server:b", "firewall:f", "dns:A a", "dns:CNAME b"}; !slices.Equal(got, want) {
+		t.Errorf("Dependents(network:n) = %v, want %v", got, want)
+	}
+	if got, want := Dependencies(ops, "dns:CNAME b"), []string{"network:n", "sshkey:k", "server:a", "dns:A a"}; !slices.Equal(got, want) {
+		t.Errorf("Dependencies(dns:CNAME b) = %v, want %v", got, want)
+	}
+	if got := Dependencies(ops, "network:n"); len(got) != 0 {
+		t.Errorf("Dependencies(network:n) = %v, want none", got)
+	}
+}
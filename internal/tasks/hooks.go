@@ -0,0 +1,132 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+// HookInput is the JSON document a hook command receives on stdin. Kind and
+// Name are the parts of the operation's target.
+type HookInput struct {
+	Hook      string           `json:"hook"`
+	When      string           `json:"when"`
+	Kind      string           `json:"kind"`
+	Name      string           `json:"name"`
+	Operation models.Operation `json:"operation"`
+}
+
+// VetoError is returned for operations a before hook refused by exiting with
+// a non-zero status.
+type VetoError struct {
+	Hook   string
+	Err    error
+	Output string
+}
+
+func (e *VetoError) Error() string {
+	msg := fmt.Sprintf("vetoed by hook %s: %v", e.Hook, e.Err)
+	if out := lastLine(e.Output); out != "" {
+		msg += ": " + out
+	}
+	return msg
+}
+
+func (e *VetoError) Unwrap() error { return e.Err }
+
+// runHooks runs the hooks matching op for the given phase in order. A failing
+// before hook vetoes the operation and stops the remaining hooks; failing
+// after hooks are logged, as the operation has already been applied. No-op
+// operations do not run hooks.
+func (e *DefaultExecutor) runHooks(ctx context.Context, when string, op models.Operation) error {
+	if !op.Actionable() {
+		return nil
+	}
+	for _, hook := range e.Hooks {
+		if hook.When != when || !hook.Matches(op) {
+			continue
+		}
+		log := operationLogger(e.logger, op).With("hook", hook.Name, "when", when)
+		log.Info("running hook")
+
+		output, err := runHook(ctx, hook, op)
+		if output != "" {
+			log.Info("hook output", "output", strings.TrimSpace(output))
+		}
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if when == models.HookBefore {
+			return &VetoError{Hook: hook.Name, Err: err, Output: output}
+		}
+		log.Warn("hook failed", "error", err)
+	}
+	return nil
+}
+
+// runHook runs the hook's command through the shell with the operation as
+// JSON on stdin and returns its combined output. The command is killed when
+// ctx is cancelled.
+func runHook(ctx context.Context, hook models.Hook, op models.Operation) (string, error) {
+	input, err := json.Marshal(newHookInput(hook, op))
+	if err != nil {
+		return "", err
+	}
+
+	parent := ctx
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	// Children of the shell may keep the output open after it was killed.
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"ENDNET_HOOK="+hook.Name,
+		"ENDNET_HOOK_WHEN="+hook.When,
+		"ENDNET_OP_TYPE="+op.Type,
+		"ENDNET_OP_TARGET="+op.Target,
+	)
+
+	output, err := cmd.CombinedOutput()
+	switch {
+	case err == nil:
+	case parent.Err() != nil:
+		err = parent.Err()
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = fmt.Errorf("timed out after %s", hook.Timeout)
+	}
+	return string(output), err
+}
+
+func newHookInput(hook models.Hook, op models.Operation) HookInput {
+	_, name, _ := strings.Cut(op.Target, ":")
+	return HookInput{Hook: hook.Name, When: hook.When, Kind: op.Kind(), Name: name, Operation: op}
+}
+
+// lastLine returns the last non-empty line of output, which usually explains
+// why a command failed.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,29 @@
+package tasks
+
+import (
+	"encoding/json"
+	"testing"
+
+	"endnet-cli/pkg/models"
+)
+
+func TestHookInputJSON(t *testing.T) {
+	hook := models.Hook{Name: "notify", When: models.HookBefore}
+	op := models.Operation{
+		Type:    "update",
+		Target:  "dns:A git.endnet.ipv64.net",
+		Details: "point at the edge",
+		Changes: []models.Change{{Field: "value", Before: "192.0.2.1", After: "192.0.2.2"}},
+	}
+
+	data, err := json.Marshal(newHookInput(hook, op))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"hook":"notify","when":"before","kind":"dns","name":"A git.endnet.ipv64.net",` +
+		`"operation":{"type":"update","target":"dns:A git.endnet.ipv64.net","details":"point at the edge",` +
+		`"changes":[{"field":"value","before":"192.0.2.1","after":"192.0.2.2"}]}}`
+	if string(data) != want {
+		t.Fatalf("input:\n%s\nwant:\n%s", data, want)
+	}
+}
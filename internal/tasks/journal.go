@@ -0,0 +1,160 @@
+package tasks
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+// Journal entry events.
+const (
+	JournalBegin  = "begin"
+	JournalResume = "resume"
+	JournalStart  = "start"
+	JournalAction = "action"
+	JournalFinish = "finish"
+	JournalFail   = "fail"
+	JournalEnd    = "end"
+)
+
+// JournalEntry is one line of the execution journal. A run starts with a
+// begin entry holding the plan and ends with an end entry, which is missing
+// when the run was interrupted. Resuming a run appends a resume entry and
+// continues it.
+type JournalEntry struct {
+	Time       time.Time    `json:"time"`
+	Event      string       `json:"event"`
+	Target     string       `json:"target,omitempty"`
+	Action     int          `json:"action,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Plan       *models.Plan `json:"plan,omitempty"`
+	RolledBack bool         `json:"rolledBack,omitempty"`
+}
+
+// Journal appends entries to an execution journal file. Every entry is
+// synced to disk before execution continues, so the journal survives crashes.
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenJournal opens the journal at path for appending, creating it and its
+// directory if needed.
+func OpenJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create journal directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	return &Journal{file: file}, nil
+}
+
+// Record appends an entry, setting its time.
+func (j *Journal) Record(entry JournalEntry) error {
+	if j == nil {
+		return nil
+	}
+	entry.Time = time.Now()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// ResumeState is what the journal knows about the last run.
+type ResumeState struct {
+	// Plan is the plan of the last run.
+	Plan *models.Plan
+	// Finished holds the targets of the operations that were applied.
+	Finished map[string]bool
+	// InFlight maps operations that were started but did not finish to the
+	// provider actions they started, if any were recorded.
+	InFlight map[string][]int
+}
+
+// ErrNothingToResume is returned by ReadJournal when the last run completed.
+var ErrNothingToResume = errors.New("the last run completed; nothing to resume")
+
+// ReadJournal returns the state of the last run in the journal at path. Runs
+// that completed successfully or were rolled back cannot be resumed.
+func ReadJournal(path string) (*ResumeState, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	defer file.Close()
+
+	var state *ResumeState
+	var end *JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A crash may leave a partial last line behind.
+			continue
+		}
+
+		if entry.Event == JournalBegin {
+			state = &ResumeState{Plan: entry.Plan, Finished: make(map[string]bool), InFlight: make(map[string][]int)}
+			end = nil
+			continue
+		}
+		if state == nil {
+			return nil, fmt.Errorf("journal line %d: %s entry before the start of a run", line, entry.Event)
+		}
+
+		switch entry.Event {
+		case JournalResume:
+			end = nil
+		case JournalStart:
+			state.InFlight[entry.Target] = nil
+		case JournalAction:
+			state.InFlight[entry.Target] = append(state.InFlight[entry.Target], entry.Action)
+		case JournalFinish:
+			delete(state.InFlight, entry.Target)
+			state.Finished[entry.Target] = true
+		case JournalFail:
+			delete(state.InFlight, entry.Target)
+		case JournalEnd:
+			end = &entry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+
+	switch {
+	case state == nil || state.Plan == nil:
+		return nil, errors.New("journal does not contain a run")
+	case end != nil && end.Error == "":
+		return nil, ErrNothingToResume
+	case end != nil && end.RolledBack:
+		return nil, errors.New("the last run was rolled back; plan and apply again instead")
+	}
+	return state, nil
+}
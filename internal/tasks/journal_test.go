@@ -0,0 +1,274 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"endnet-cli/pkg/models"
+)
+
+// fakePoller reports every polled action with status. With cancel set, it
+// cancels the execution on the first poll instead, as Ctrl-C would.
+type fakePoller struct {
+	mu     sync.Mutex
+	status string
+	cancel context.CancelFunc
+	polls  []int
+}
+
+func (p *fakePoller) GetAction(ctx context.Context, id int) (*models.Action, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.polls = append(p.polls, id)
+	if p.cancel != nil {
+		p.cancel()
+		return nil, ctx.Err()
+	}
+	return &models.Action{ID: id, Command: "create_server", Status: p.status, Error: "server is locked"}, nil
+}
+
+// writeJournal records entries in a new journal and returns its path.
+func writeJournal(t *testing.T, entries ...JournalEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	for _, entry := range entries {
+		if err := journal.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestReadJournal(t *testing.T) {
+	plan := &models.Plan{ServerOps: []models.Operation{{Type: "create", Target: "server:a"}}}
+	begin := JournalEntry{Event: JournalBegin, Plan: plan}
+	tests := []struct {
+		name         string
+		entries      []JournalEntry
+		wantFinished []string
+		wantInFlight map[string][]int
+		wantErr      string
+	}{
+		{
+			name: "interrupted run",
+			entries: []JournalEntry{
+				begin,
+				{Event: JournalStart, Target: "network:n"},
+				{Event: JournalFinish, Target: "network:n"},
+				{Event: JournalStart, Target: "server:a"},
+				{Event: JournalAction, Target: "server:a", Action: 5},
+				{Event: JournalAction, Target: "server:a", Action: 6},
+				{Event: JournalStart, Target: "server:b"},
+			},
+			wantFinished: []string{"network:n"},
+			wantInFlight: map[string][]int{"server:a": {5, 6}, "server:b": nil},
+		},
+		{
+			name: "failed run",
+			entries: []JournalEntry{
+				begin,
+				{Event: JournalStart, Target: "network:n"},
+				{Event: JournalFinish, Target: "network:n"},
+				{Event: JournalStart, Target: "server:a"},
+				{Event: JournalFail, Target: "server:a", Error: "boom"},
+				{Event: JournalEnd, Error: "boom"},
+			},
+			wantFinished: []string{"network:n"},
+			wantInFlight: map[string][]int{},
+		},
+		{
+			name: "resumed run interrupted again",
+			entries: []JournalEntry{
+				begin,
+				{Event: JournalStart, Target: "server:a"},
+				{Event: JournalAction, Target: "server:a", Action: 5},
+				{Event: JournalResume},
+				{Event: JournalStart, Target: "server:a"},
+				{Event: JournalAction, Target: "server:a", Action: 5},
+				{Event: JournalFinish, Target: "server:a"},
+				{Event: JournalStart, Target: "server:b"},
+			},
+			wantFinished: []string{"server:a"},
+			wantInFlight: map[string][]int{"server:b": nil},
+		},
+		{
+			name: "only the last run counts",
+			entries: []JournalEntry{
+				begin,
+				{Event: JournalStart, Target: "server:old"},
+				{Event: JournalEnd, Error: "boom"},
+				begin,
+				{Event: JournalStart, Target: "server:a"},
+			},
+			wantFinished: []string{},
+			wantInFlight: map[string][]int{"server:a": nil},
+		},
+		{
+			name:    "completed run",
+			entries: []JournalEntry{begin, {Event: JournalStart, Target: "server:a"}, {Event: JournalFinish, Target: "server:a"}, {Event: JournalEnd}},
+			wantErr: ErrNothingToResume.Error(),
+		},
+		{
+			name: "resumed run completed",
+			entries: []JournalEntry{
+				begin,
+				{Event: JournalEnd, Error: "boom"},
+				{Event: JournalResume},
+				{Event: JournalEnd},
+			},
+			wantErr: ErrNothingToResume.Error(),
+		},
+		{
+			name:    "rolled back run",
+			entries: []JournalEntry{begin, {Event: JournalEnd, Error: "boom", RolledBack: true}},
+			wantErr: "rolled back",
+		},
+		{
+			name:    "entry before a run",
+			entries: []JournalEntry{{Event: JournalStart, Target: "server:a"}, begin},
+			wantErr: "journal line 1: start entry before the start of a run",
+		},
+		{
+			name:    "empty journal",
+			wantErr: "journal does not contain a run",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := ReadJournal(writeJournal(t, tt.entries...))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if finished := slices.Sorted(maps.Keys(state.Finished)); !slices.Equal(finished, tt.wantFinished) {
+				t.Errorf("finished = %v, want %v", finished, tt.wantFinished)
+			}
+			if !maps.EqualFunc(state.InFlight, tt.wantInFlight, slices.Equal) {
+				t.Errorf("in flight = %v, want %v", state.InFlight, tt.wantInFlight)
+			}
+			if state.Plan == nil || state.Plan.Operations()[0].Target != "server:a" {
+				t.Errorf("plan = %+v, want the plan of the last run", state.Plan)
+			}
+		})
+	}
+}
+
+func TestReadJournalSkipsPartialLine(t *testing.T) {
+	path := writeJournal(t, JournalEntry{Event: JournalBegin, Plan: &models.Plan{}}, JournalEntry{Event: JournalStart, Target: "server:a"})
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"event":"fin`)
+	file.Close()
+
+	state, err := ReadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.InFlight["server:a"]; !ok {
+		t.Fatalf("in flight = %v, want server:a", state.InFlight)
+	}
+}
+
+func TestExecuteResumesInterruptedRun(t *testing.T) {
+	plan := &models.Plan{
+		NetworkOps: []models.Operation{{Type: "create", Target: "network:n"}},
+		ServerOps:  []models.Operation{{Type: "create", Target: "server:a", DependsOn: []string{"network:n"}}},
+		DNSOps:     []models.Operation{{Type: "ensure", Target: "dns:A a", DependsOn: []string{"server:a"}}},
+	}
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	execute := func(ctx context.Context, applier Applier, poller ActionPoller, resume *ResumeState) (*models.ExecutionResult, error) {
+		t.Helper()
+		journal, err := OpenJournal(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer journal.Close()
+		e := NewExecutorWithOptions(nil, ExecutorOptions{Applier: applier, Poller: poller, Journal: journal, Resume: resume}).(*DefaultExecutor)
+		e.PollInterval = 0
+		return e.Execute(ctx, plan)
+	}
+	statuses := func(result *models.ExecutionResult) []string {
+		var s []string
+		for _, op := range result.Operations {
+			s = append(s, op.Status)
+		}
+		return s
+	}
+
+	// The first run is interrupted while it awaits the server's action.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first := &recordingApplier{actions: map[string][]models.Action{
+		"server:a": {{ID: 42, Command: "create_server", Status: models.ActionRunning}},
+	}}
+	result, err := execute(ctx, first, &fakePoller{cancel: cancel}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want the interruption", err)
+	}
+	if got, want := statuses(result), []string{models.OperationApplied, models.OperationInterrupted, models.OperationNotRun}; !slices.Equal(got, want) {
+		t.Fatalf("statuses = %v, want %v", got, want)
+	}
+
+	resume, err := ReadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resume.Finished["network:n"] || !slices.Equal(resume.InFlight["server:a"], []int{42}) {
+		t.Fatalf("resume state = %+v, want network:n finished and action 42 in flight", resume)
+	}
+
+	// Resuming awaits the action instead of creating the server again.
+	second := &recordingApplier{}
+	poller := &fakePoller{status: models.ActionSuccess}
+	result, err = execute(context.Background(), second, poller, resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(second.applied, []string{"ensure dns:A a"}) {
+		t.Fatalf("applied = %v, want only the operation that was not started", second.applied)
+	}
+	if !slices.Equal(poller.polls, []int{42}) {
+		t.Fatalf("polled actions = %v, want [42]", poller.polls)
+	}
+	if got, want := statuses(result), []string{models.OperationSkipped, models.OperationApplied, models.OperationApplied}; !slices.Equal(got, want) {
+		t.Fatalf("statuses = %v, want %v", got, want)
+	}
+	if _, err := ReadJournal(path); !errors.Is(err, ErrNothingToResume) {
+		t.Fatalf("journal after resuming: error = %v, want %v", err, ErrNothingToResume)
+	}
+}
+
+func TestExecuteResumeFailsWithFailedAction(t *testing.T) {
+	plan := &models.Plan{ServerOps: []models.Operation{{Type: "create", Target: "server:a"}}}
+	resume := &ResumeState{Plan: plan, Finished: map[string]bool{}, InFlight: map[string][]int{"server:a": {42}}}
+	applier := &recordingApplier{}
+	e := NewExecutorWithOptions(nil, ExecutorOptions{Applier: applier, Poller: &fakePoller{status: models.ActionError}, Resume: resume}).(*DefaultExecutor)
+	e.PollInterval = 0
+
+	_, err := e.Execute(context.Background(), plan)
+	if err == nil || !strings.Contains(err.Error(), "action 42 (create_server) failed: server is locked") {
+		t.Fatalf("error = %v, want the failed action", err)
+	}
+	if len(applier.applied) != 0 {
+		t.Fatalf("applied = %v, want nothing", applier.applied)
+	}
+}
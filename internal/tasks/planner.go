@@ -1,14 +1,18 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 
 	"endnet-cli/pkg/models"
 )
 
 // Planner builds plans for reconciling desired and current state.
 type Planner interface {
-	Plan(spec models.EndnetSpec, state *models.RemoteState) (*models.Plan, error)
+	Plan(ctx context.Context, spec models.EndnetSpec, state *models.RemoteState) (*models.Plan, error)
 }
 
 // DefaultPlanner is a basic planner implementation that focuses on
@@ -22,100 +26,317 @@ func NewPlanner() Planner {
 
 // Plan compares the desired specification with the observed state and
 // generates a list of operations required to reconcile them.
-func (p *DefaultPlanner) Plan(spec models.EndnetSpec, state *models.RemoteState) (*models.Plan, error) {
+func (p *DefaultPlanner) Plan(ctx context.Context, spec models.EndnetSpec, state *models.RemoteState) (*models.Plan, error) {
 	if state == nil {
 		return nil, fmt.Errorf("state must not be nil")
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	plan := &models.Plan{}
+	network := networkTarget(spec.Network.Name)
 
 	if !hasNetwork(state.Hetzner.Networks, spec.Network.Name) {
 		plan.NetworkOps = append(plan.NetworkOps, models.Operation{
 			Type:    "create",
-			Target:  fmt.Sprintf("network:%s", spec.Network.Name),
+			Target:  network,
 			Details: fmt.Sprintf("create network %s with %s", spec.Network.Name, spec.Network.CIDR),
+			Changes: []models.Change{
+				{Field: "cidr", After: spec.Network.CIDR},
+				{Field: "subnet", After: spec.Network.SubnetCIDR},
+			},
 		})
 	} else {
 		plan.NetworkOps = append(plan.NetworkOps, models.Operation{
 			Type:    "noop",
-			Target:  fmt.Sprintf("network:%s", spec.Network.Name),
+			Target:  network,
 			Details: "network already present",
 		})
 	}
 
-	ensureServer(plan, state, spec.Roles.Edge)
-	ensureServer(plan, state, spec.Roles.WG)
-	ensureServer(plan, state, spec.Roles.Forge)
+	ensureSSHKey(plan, state, spec.SSHKey)
 
-	if _, ok := state.IPv64.Domains[spec.DNS.RootDomain]; !ok {
-		plan.DNSOps = append(plan.DNSOps, models.Operation{
-			Type:    "verify",
-			Target:  fmt.Sprintf("dns:%s", spec.DNS.RootDomain),
-			Details: "ensure root domain exists in IPv64 account",
-		})
-	} else {
-		plan.DNSOps = append(plan.DNSOps, models.Operation{
-			Type:    "noop",
-			Target:  fmt.Sprintf("dns:%s", spec.DNS.RootDomain),
-			Details: "root domain present",
-		})
+	serverDeps := []string{network}
+	if spec.SSHKey.Name != "" {
+		serverDeps = append(serverDeps, sshKeyTarget(spec.SSHKey.Name))
 	}
+	ensureServer(plan, state, spec.Roles.Edge, spec.SSHKey.Name, serverDeps)
+	ensureServer(plan, state, spec.Roles.WG, spec.SSHKey.Name, serverDeps)
+	ensureServer(plan, state, spec.Roles.Forge, spec.SSHKey.Name, serverDeps)
 
-	plan.DNSOps = append(plan.DNSOps, models.Operation{
-		Type:    "update",
-		Target:  fmt.Sprintf("dns:A %s", spec.DNS.RootDomain),
-		Details: "synchronize A record using DynDNS",
-	})
-
-	plan.DNSOps = append(plan.DNSOps, models.Operation{
-		Type:    "ensure",
-		Target:  fmt.Sprintf("dns:CNAME %s", spec.DNS.ForgejoHost),
-		Details: fmt.Sprintf("ensure CNAME points to %s", spec.DNS.RootDomain),
-	})
+	ensureFirewall(plan, state, spec.Firewall, spec.Roles.Edge.Name)
+	ensureDNS(plan, state, spec.DNS, spec.Roles.Edge.Name)
 
-	plan.FirewallOps = append(plan.FirewallOps, models.Operation{
-		Type:    "reconcile",
-		Target:  "firewall:endnet-edge",
-		Details: "ensure firewall rules for edge host",
-	})
+	if err := ValidateGraph(plan.Operations()); err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
 
 	return plan, nil
 }
 
-func ensureServer(plan *models.Plan, state *models.RemoteState, node models.NodeSpec) {
+func ensureSSHKey(plan *models.Plan, state *models.RemoteState, key models.SSHKeySpec) {
+	if key.Name == "" {
+		return
+	}
+
+	target := sshKeyTarget(key.Name)
+	remote, ok := findSSHKey(state.Hetzner.SSHKeys, key.Name)
+	switch {
+	case !ok && key.PublicKey == "":
+		plan.SSHKeyOps = append(plan.SSHKeyOps, models.Operation{
+			Type:    "create",
+			Target:  target,
+			Details: fmt.Sprintf("generate ed25519 key pair at %s and upload it", key.PublicKeyPath),
+			Changes: []models.Change{{Field: "fingerprint", After: "(generated)"}},
+		})
+	case !ok:
+		plan.SSHKeyOps = append(plan.SSHKeyOps, models.Operation{
+			Type:    "create",
+			Target:  target,
+			Details: fmt.Sprintf("upload public key %s (%s)", key.PublicKeyPath, key.Fingerprint),
+			Changes: []models.Change{{Field: "fingerprint", After: key.Fingerprint}},
+		})
+	case key.Fingerprint != "" && remote.Fingerprint != key.Fingerprint:
+		plan.SSHKeyOps = append(plan.SSHKeyOps, models.Operation{
+			Type:    "drift",
+			Target:  target,
+			Details: fmt.Sprintf("replace remote key %s with local key %s; existing servers keep the old key", remote.Fingerprint, key.Fingerprint),
+			Changes: []models.Change{{Field: "fingerprint", Before: remote.Fingerprint, After: key.Fingerprint}},
+		})
+	default:
+		plan.SSHKeyOps = append(plan.SSHKeyOps, models.Operation{
+			Type:    "noop",
+			Target:  target,
+			Details: "ssh key already present",
+		})
+	}
+}
+
+func ensureServer(plan *models.Plan, state *models.RemoteState, node models.NodeSpec, sshKeyName string, deps []string) {
 	if node.Name == "" {
 		return
 	}
 
 	if !hasServer(state.Hetzner.Servers, node.Name) {
 		plan.ServerOps = append(plan.ServerOps, models.Operation{
-			Type:    "create",
-			Target:  fmt.Sprintf("server:%s", node.Name),
-			Details: fmt.Sprintf("provision %s (%s) with IP %s", node.Type, node.Image, node.PrivateIP),
+			Type:      "create",
+			Target:    serverTarget(node.Name),
+			Details:   fmt.Sprintf("provision %s (%s) with IP %s", node.Type, node.Image, node.PrivateIP),
+			DependsOn: deps,
+			Changes: []models.Change{
+				{Field: "type", After: node.Type},
+				{Field: "image", After: node.Image},
+				{Field: "privateIp", After: node.PrivateIP},
+				{Field: "publicIp", After: fmt.Sprint(node.HasPublicIP)},
+				{Field: "sshKey", After: sshKeyName},
+			},
 		})
 	} else {
 		plan.ServerOps = append(plan.ServerOps, models.Operation{
 			Type:    "noop",
-			Target:  fmt.Sprintf("server:%s", node.Name),
+			Target:  serverTarget(node.Name),
 			Details: "server already exists",
 		})
 	}
 }
 
+// ensureFirewall plans the firewall of the edge server. It is created when
+// missing and reconciled when its rules differ or it is not applied to the
+// edge server.
+func ensureFirewall(plan *models.Plan, state *models.RemoteState, fw models.FirewallSpec, edge string) {
+	if fw.Name == "" {
+		return
+	}
+
+	target := firewallTarget(fw.Name)
+	deps := []string{serverTarget(edge)}
+	rules := models.FormatFirewallRules(fw.Rules)
+	remote, ok := findFirewall(state.Hetzner.Firewalls, fw.Name)
+	if !ok {
+		plan.FirewallOps = append(plan.FirewallOps, models.Operation{
+			Type:      "create",
+			Target:    target,
+			Details:   fmt.Sprintf("create firewall %s with %d rules and apply it to %s", fw.Name, len(fw.Rules), edge),
+			DependsOn: deps,
+			Changes: []models.Change{
+				{Field: "rules", After: rules},
+				{Field: "appliesTo", After: edge},
+			},
+		})
+		return
+	}
+
+	var changes []models.Change
+	if before := models.FormatFirewallRules(remote.Rules); before != rules {
+		changes = append(changes, models.Change{Field: "rules", Before: before, After: rules})
+	}
+	applied := appliedServers(state.Hetzner.Servers, remote.AppliedTo)
+	if !slices.Contains(applied, edge) {
+		before := strings.Join(applied, ",")
+		after := strings.Join(append(applied, edge), ",")
+		changes = append(changes, models.Change{Field: "appliesTo", Before: before, After: after})
+	}
+	if len(changes) == 0 {
+		plan.FirewallOps = append(plan.FirewallOps, models.Operation{
+			Type:    "noop",
+			Target:  target,
+			Details: "firewall rules up to date",
+		})
+		return
+	}
+	plan.FirewallOps = append(plan.FirewallOps, models.Operation{
+		Type:      "reconcile",
+		Target:    target,
+		Details:   fmt.Sprintf("reconcile firewall %s of %s", fw.Name, edge),
+		DependsOn: deps,
+		Changes:   changes,
+	})
+}
+
+// ensureDNS plans the root domain, its A record pointing at the public IP of
+// the edge server and the Forgejo CNAME pointing at the root domain.
+func ensureDNS(plan *models.Plan, state *models.RemoteState, dns models.DNSSpec, edge string) {
+	rootDomain := fmt.Sprintf("dns:%s", dns.RootDomain)
+	if _, ok := state.IPv64.Domains[dns.RootDomain]; !ok {
+		plan.DNSOps = append(plan.DNSOps, models.Operation{
+			Type:    "verify",
+			Target:  rootDomain,
+			Details: "ensure root domain exists in IPv64 account",
+		})
+	} else {
+		plan.DNSOps = append(plan.DNSOps, models.Operation{
+			Type:    "noop",
+			Target:  rootDomain,
+			Details: "root domain present",
+		})
+	}
+
+	// The address of a server that is yet to be created is only known once
+	// it was applied.
+	aRecord := fmt.Sprintf("dns:A %s", dns.RootDomain)
+	want := fmt.Sprintf("public IP of %s", edge)
+	if server, ok := findServer(state.Hetzner.Servers, edge); ok && server.PublicIP != "" {
+		want = server.PublicIP
+	}
+	if current := recordValue(state, dns.RootDomain, "A", dns.RootDomain); current == want {
+		plan.DNSOps = append(plan.DNSOps, models.Operation{
+			Type:    "noop",
+			Target:  aRecord,
+			Details: fmt.Sprintf("A record points to %s", current),
+		})
+	} else {
+		plan.DNSOps = append(plan.DNSOps, models.Operation{
+			Type:      "update",
+			Target:    aRecord,
+			Details:   "synchronize A record using DynDNS",
+			DependsOn: []string{rootDomain, serverTarget(edge)},
+			Changes:   []models.Change{{Field: "value", Before: current, After: want}},
+		})
+	}
+
+	cname := fmt.Sprintf("dns:CNAME %s", dns.ForgejoHost)
+	if current := recordValue(state, dns.RootDomain, "CNAME", dns.ForgejoHost); current == dns.RootDomain {
+		plan.DNSOps = append(plan.DNSOps, models.Operation{
+			Type:    "noop",
+			Target:  cname,
+			Details: fmt.Sprintf("CNAME points to %s", current),
+		})
+	} else {
+		plan.DNSOps = append(plan.DNSOps, models.Operation{
+			Type:      "ensure",
+			Target:    cname,
+			Details:   fmt.Sprintf("ensure CNAME points to %s", dns.RootDomain),
+			DependsOn: []string{aRecord},
+			Changes:   []models.Change{{Field: "value", Before: current, After: dns.RootDomain}},
+		})
+	}
+}
+
 func hasNetwork(networks []models.Network, name string) bool {
+	_, ok := findNetwork(networks, name)
+	return ok
+}
+
+func findNetwork(networks []models.Network, name string) (models.Network, bool) {
 	for _, n := range networks {
 		if n.Name == name {
-			return true
+			return n, true
 		}
 	}
-	return false
+	return models.Network{}, false
 }
 
 func hasServer(servers []models.Server, name string) bool {
+	_, ok := findServer(servers, name)
+	return ok
+}
+
+func findServer(servers []models.Server, name string) (models.Server, bool) {
 	for _, s := range servers {
 		if s.Name == name {
-			return true
+			return s, true
+		}
+	}
+	return models.Server{}, false
+}
+
+func findFirewall(firewalls []models.Firewall, name string) (models.Firewall, bool) {
+	for _, f := range firewalls {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return models.Firewall{}, false
+}
+
+// appliedServers returns the sorted names of the servers with the given IDs.
+// Servers that are not listed are named by ID.
+func appliedServers(servers []models.Server, ids []int) []string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		name := fmt.Sprintf("#%d", id)
+		for _, s := range servers {
+			if s.ID == id {
+				name = s.Name
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func findSSHKey(keys []models.SSHKey, name string) (models.SSHKey, bool) {
+	for _, k := range keys {
+		if k.Name == name {
+			return k, true
 		}
 	}
-	return false
+	return models.SSHKey{}, false
+}
+
+func recordValue(state *models.RemoteState, domain, recordType, name string) string {
+	for _, r := range state.IPv64.Domains[domain].Records {
+		if r.Type == recordType && r.Name == name {
+			return r.Value
+		}
+	}
+	return ""
+}
+
+func networkTarget(name string) string {
+	return fmt.Sprintf("network:%s", name)
+}
+
+func sshKeyTarget(name string) string {
+	return fmt.Sprintf("sshkey:%s", name)
+}
+
+func serverTarget(name string) string {
+	return fmt.Sprintf("server:%s", name)
+}
+
+func firewallTarget(name string) string {
+	return fmt.Sprintf("firewall:%s", name)
 }
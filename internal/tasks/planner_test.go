@@ -0,0 +1,168 @@
+package tasks
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"endnet-cli/pkg/models"
+)
+
+// convergedState returns the state in which spec is fully applied.
+func convergedState(spec models.EndnetSpec) *models.RemoteState {
+	servers := []models.Server{
+		{ID: 1, Name: spec.Roles.Edge.Name, PrivateIP: spec.Roles.Edge.PrivateIP, PublicIP: "192.0.2.1"},
+		{ID: 2, Name: spec.Roles.WG.Name, PrivateIP: spec.Roles.WG.PrivateIP},
+		{ID: 3, Name: spec.Roles.Forge.Name, PrivateIP: spec.Roles.Forge.PrivateIP},
+	}
+	// The provider lists rules in its own order.
+	rules := slices.Clone(spec.Firewall.Rules)
+	slices.Reverse(rules)
+	return &models.RemoteState{
+		Hetzner: models.HetznerState{
+			Networks:  []models.Network{{ID: 1, Name: spec.Network.Name, CIDR: spec.Network.CIDR}},
+			Servers:   servers,
+			Firewalls: []models.Firewall{{ID: 1, Name: spec.Firewall.Name, Rules: rules, AppliedTo: []int{1}}},
+			SSHKeys:   []models.SSHKey{{ID: 1, Name: spec.SSHKey.Name, Fingerprint: spec.SSHKey.Fingerprint}},
+		},
+		IPv64: models.IPv64State{Domains: map[string]models.Domain{
+			spec.DNS.RootDomain: {Name: spec.DNS.RootDomain, Records: []models.DNSRecord{
+				{ID: 1, Type: "A", Name: spec.DNS.RootDomain, Value: "192.0.2.1"},
+				{ID: 2, Type: "CNAME", Name: spec.DNS.ForgejoHost, Value: spec.DNS.RootDomain},
+			}},
+		}},
+	}
+}
+
+func findOp(t *testing.T, plan *models.Plan, target string) models.Operation {
+	t.Helper()
+	for _, op := range plan.Operations() {
+		if op.Target == target {
+			return op
+		}
+	}
+	t.Fatalf("plan has no operation for %s", target)
+	return models.Operation{}
+}
+
+func TestPlanConvergedHasNoChanges(t *testing.T) {
+	spec := testSpec()
+	plan, err := NewPlanner().Plan(context.Background(), spec, convergedState(spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range plan.Operations() {
+		if op.Actionable() {
+			t.Errorf("%s %s: %s", op.Type, op.Target, op.Details)
+		}
+	}
+	if s := plan.Summary(); s.Changes != 0 {
+		t.Fatalf("summary = %+v, want no changes", s)
+	}
+}
+
+func TestPlanDrift(t *testing.T) {
+	spec := testSpec()
+	edge := "server:" + spec.Roles.Edge.Name
+	firewall := "firewall:" + spec.Firewall.Name
+	aRecord := "dns:A " + spec.DNS.RootDomain
+	cname := "dns:CNAME " + spec.DNS.ForgejoHost
+
+	tests := []struct {
+		name   string
+		mutate func(*models.RemoteState)
+		target string
+		want   models.Operation
+	}{
+		{
+			name:   "A record points elsewhere",
+			mutate: func(s *models.RemoteState) { s.IPv64.Domains[spec.DNS.RootDomain].Records[0].Value = "192.0.2.9" },
+			target: aRecord,
+			want: models.Operation{Type: "update", DependsOn: []string{"dns:" + spec.DNS.RootDomain, edge},
+				Changes: []models.Change{{Field: "value", Before: "192.0.2.9", After: "192.0.2.1"}}},
+		},
+		{
+			name:   "edge server missing",
+			mutate: func(s *models.RemoteState) { s.Hetzner.Servers = s.Hetzner.Servers[1:] },
+			target: aRecord,
+			want: models.Operation{Type: "update", DependsOn: []string{"dns:" + spec.DNS.RootDomain, edge},
+				Changes: []models.Change{{Field: "value", Before: "192.0.2.1", After: "public IP of " + spec.Roles.Edge.Name}}},
+		},
+		{
+			name: "CNAME missing",
+			mutate: func(s *models.RemoteState) {
+				d := s.IPv64.Domains[spec.DNS.RootDomain]
+				d.Records = d.Records[:1]
+				s.IPv64.Domains[spec.DNS.RootDomain] = d
+			},
+			target: cname,
+			want: models.Operation{Type: "ensure", DependsOn: []string{aRecord},
+				Changes: []models.Change{{Field: "value", After: spec.DNS.RootDomain}}},
+		},
+		{
+			name:   "root domain missing",
+			mutate: func(s *models.RemoteState) { delete(s.IPv64.Domains, spec.DNS.RootDomain) },
+			target: "dns:" + spec.DNS.RootDomain,
+			want:   models.Operation{Type: "verify"},
+		},
+		{
+			name:   "firewall missing",
+			mutate: func(s *models.RemoteState) { s.Hetzner.Firewalls = nil },
+			target: firewall,
+			want: models.Operation{Type: "create", DependsOn: []string{edge}, Changes: []models.Change{
+				{Field: "rules", After: models.FormatFirewallRules(spec.Firewall.Rules)},
+				{Field: "appliesTo", After: spec.Roles.Edge.Name},
+			}},
+		},
+		{
+			name: "firewall rule removed",
+			mutate: func(s *models.RemoteState) {
+				s.Hetzner.Firewalls[0].Rules = s.Hetzner.Firewalls[0].Rules[1:]
+			},
+			target: firewall,
+			want: models.Operation{Type: "reconcile", DependsOn: []string{edge}, Changes: []models.Change{{
+				Field:  "rules",
+				Before: models.FormatFirewallRules(spec.Firewall.Rules[:len(spec.Firewall.Rules)-1]),
+				After:  models.FormatFirewallRules(spec.Firewall.Rules),
+			}}},
+		},
+		{
+			name:   "firewall detached",
+			mutate: func(s *models.RemoteState) { s.Hetzner.Firewalls[0].AppliedTo = []int{3} },
+			target: firewall,
+			want: models.Operation{Type: "reconcile", DependsOn: []string{edge}, Changes: []models.Change{
+				{Field: "appliesTo", Before: spec.Roles.Forge.Name, After: spec.Roles.Forge.Name + "," + spec.Roles.Edge.Name},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := convergedState(spec)
+			tt.mutate(state)
+			plan, err := NewPlanner().Plan(context.Background(), spec, state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := findOp(t, plan, tt.target)
+			if got.Type != tt.want.Type || !slices.Equal(got.DependsOn, tt.want.DependsOn) || !slices.Equal(got.Changes, tt.want.Changes) {
+				t.Fatalf("operation = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatFirewallRulesIgnoresOrder(t *testing.T) {
+	a := []models.FirewallRule{
+		{Direction: "in", Protocol: "tcp", Port: "22", Source: "::/0,0.0.0.0/0"},
+		{Direction: "in", Protocol: "icmp", Source: "0.0.0.0/0"},
+	}
+	b := []models.FirewallRule{
+		{Direction: "in", Protocol: "icmp", Source: "0.0.0.0/0"},
+		{Direction: "in", Protocol: "tcp", Port: "22", Source: "0.0.0.0/0, ::/0"},
+	}
+	want := "in icmp from 0.0.0.0/0; in tcp 22 from 0.0.0.0/0,::/0"
+	if got := models.FormatFirewallRules(a); got != want || models.FormatFirewallRules(b) != want {
+		t.Fatalf("FormatFirewallRules = %q and %q, want %q", got, models.FormatFirewallRules(b), want)
+	}
+}
@@ -0,0 +1,535 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"endnet-cli/internal/hetzner"
+	"endnet-cli/internal/ipv64"
+	"endnet-cli/internal/sshkey"
+	"endnet-cli/pkg/models"
+	"endnet-cli/pkg/util"
+)
+
+// Errors of operations whose provider has no client.
+var (
+	errNoHetzner = errors.New("no Hetzner API token is configured")
+	errNoIPv64   = errors.New("no IPv64 API key is configured")
+)
+
+// ProviderApplier applies operations through the Hetzner and IPv64 APIs. What
+// to create or change is read from the operations' Changes, so the plan of a
+// resumed run is applied as it was planned; Spec supplies the location and
+// network of new servers. Operations of a provider without client fail.
+//
+// Applying is idempotent, so failed calls can be retried: resources that
+// already exist are not created again, and deleting a missing resource
+// succeeds.
+type ProviderApplier struct {
+	Hetzner hetzner.Client
+	IPv64   ipv64.Client
+	Spec    models.EndnetSpec
+	// PollInterval is the time between polls of the Hetzner actions a
+	// server creation awaits before it attaches the server to the network.
+	PollInterval time.Duration
+
+	logger util.Logger
+}
+
+// NewProviderApplier returns an applier using the given clients, either of
+// which may be nil.
+func NewProviderApplier(logger util.Logger, hz hetzner.Client, dns ipv64.Client, spec models.EndnetSpec) *ProviderApplier {
+	if logger == nil {
+		logger = util.NewLogger()
+	}
+	return &ProviderApplier{Hetzner: hz, IPv64: dns, Spec: spec, PollInterval: time.Second, logger: logger}
+}
+
+// Apply performs the provider calls of op.
+func (a *ProviderApplier) Apply(ctx context.Context, op models.Operation) ([]models.Action, error) {
+	if !op.Actionable() {
+		return nil, nil
+	}
+	if op.Kind() == "dns" {
+		if a.IPv64 == nil {
+			return nil, errNoIPv64
+		}
+	} else if a.Hetzner == nil {
+		return nil, errNoHetzner
+	}
+
+	_, name, _ := strings.Cut(op.Target, ":")
+	switch op.Kind() {
+	case "network":
+		return nil, a.applyNetwork(ctx, op, name)
+	case "sshkey":
+		return nil, a.applySSHKey(ctx, op, name)
+	case "server":
+		return a.applyServer(ctx, op, name)
+	case "firewall":
+		return a.applyFirewall(ctx, op, name)
+	case "dns":
+		return nil, a.applyDNS(ctx, op, name)
+	default:
+		return nil, fmt.Errorf("unknown resource kind %q", op.Kind())
+	}
+}
+
+func (a *ProviderApplier) applyNetwork(ctx context.Context, op models.Operation, name string) error {
+	networks, err := a.Hetzner.ListNetworks(ctx)
+	if err != nil {
+		return err
+	}
+	existing, ok := findNetwork(networks, name)
+
+	switch op.Type {
+	case "create":
+		if ok {
+			operationLogger(a.logger, op).Info("network already exists", "id", existing.ID)
+			return nil
+		}
+		_, err := a.Hetzner.CreateNetwork(ctx, hetzner.CreateNetworkOpts{
+			Name:       name,
+			CIDR:       changeAfter(op, "cidr"),
+			SubnetCIDR: changeAfter(op, "subnet"),
+			Zone:       hetzner.NetworkZone(a.Spec.Location),
+		})
+		return err
+	case "delete":
+		if !ok {
+			return nil
+		}
+		return a.Hetzner.DeleteNetwork(ctx, existing.ID)
+	default:
+		return unsupported(op)
+	}
+}
+
+func (a *ProviderApplier) applySSHKey(ctx context.Context, op models.Operation, name string) error {
+	keys, err := a.Hetzner.ListSSHKeys(ctx)
+	if err != nil {
+		return err
+	}
+	existing, ok := findSSHKey(keys, name)
+
+	switch op.Type {
+	case "create":
+		if ok {
+			operationLogger(a.logger, op).Info("ssh key already exists", "id", existing.ID)
+			return nil
+		}
+		publicKey, err := a.publicKey(op)
+		if err != nil {
+			return err
+		}
+		_, err = a.Hetzner.CreateSSHKey(ctx, name, publicKey)
+		return err
+	case "drift":
+		// Hetzner cannot change the key material of a key, so the remote
+		// key is replaced. Existing servers keep the key they were
+		// created with.
+		publicKey, err := a.publicKey(op)
+		if err != nil {
+			return err
+		}
+		fingerprint, err := sshkey.Fingerprint(publicKey)
+		if err != nil {
+			return err
+		}
+		if ok && existing.Fingerprint == fingerprint {
+			return nil
+		}
+		if ok {
+			if err := a.Hetzner.DeleteSSHKey(ctx, existing.ID); err != nil {
+				return err
+			}
+		}
+		_, err = a.Hetzner.CreateSSHKey(ctx, name, publicKey)
+		return err
+	case "delete":
+		if !ok {
+			return nil
+		}
+		return a.Hetzner.DeleteSSHKey(ctx, existing.ID)
+	default:
+		return unsupported(op)
+	}
+}
+
+// publicKey returns the public key to upload: Spec.SSHKey.PublicKey, else
+// the key at Spec.SSHKey.PublicKeyPath, which is generated when it does not
+// exist yet.
+func (a *ProviderApplier) publicKey(op models.Operation) (string, error) {
+	key := a.Spec.SSHKey
+	if key.PublicKey == "" {
+		if err := sshkey.Populate(&key); err != nil {
+			return "", err
+		}
+	}
+	if key.PublicKey != "" {
+		return key.PublicKey, nil
+	}
+	operationLogger(a.logger, op).Info("generating ssh key pair", "path", key.PublicKeyPath)
+	return sshkey.Generate(key.PublicKeyPath, a.Spec.Project)
+}
+
+// applyServer creates a server stopped, attaches it to the network with its
+// private IP and powers it on; the executor awaits the power-on action. A
+// server left behind by an earlier attempt is attached and powered on as
+// needed.
+func (a *ProviderApplier) applyServer(ctx context.Context, op models.Operation, name string) ([]models.Action, error) {
+	servers, err := a.Hetzner.ListServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	server, ok := findServer(servers, name)
+
+	switch op.Type {
+	case "create":
+	case "delete":
+		if !ok {
+			return nil, nil
+		}
+		action, err := a.Hetzner.DeleteServer(ctx, server.ID)
+		if err != nil {
+			return nil, err
+		}
+		return []models.Action{*action}, nil
+	default:
+		return nil, unsupported(op)
+	}
+
+	networks, err := a.Hetzner.ListNetworks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	network, found := findNetwork(networks, a.Spec.Network.Name)
+	if !found {
+		return nil, fmt.Errorf("network %s does not exist", a.Spec.Network.Name)
+	}
+
+	if !ok {
+		var sshKeys []int
+		if keyName := changeAfter(op, "sshKey"); keyName != "" {
+			keys, err := a.Hetzner.ListSSHKeys(ctx)
+			if err != nil {
+				return nil, err
+			}
+			key, found := findSSHKey(keys, keyName)
+			if !found {
+				return nil, fmt.Errorf("ssh key %s does not exist", keyName)
+			}
+			sshKeys = append(sshKeys, key.ID)
+		}
+
+		created, actions, err := a.Hetzner.CreateServer(ctx, hetzner.CreateServerOpts{
+			Name:     name,
+			Type:     changeAfter(op, "type"),
+			Image:    changeAfter(op, "image"),
+			Location: a.Spec.Location,
+			SSHKeys:  sshKeys,
+			// Servers without a public IPv4 address keep IPv6, which
+			// Hetzner requires until they are attached to the network.
+			EnableIPv4: changeAfter(op, "publicIp") == "true",
+			EnableIPv6: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := a.await(ctx, actions); err != nil {
+			return nil, err
+		}
+		server = *created
+		server.Status = models.ServerOff
+	} else {
+		operationLogger(a.logger, op).Info("server already exists", "id", server.ID, "status", server.Status)
+	}
+
+	if server.PrivateIP == "" {
+		action, err := a.Hetzner.AttachServerToNetwork(ctx, server.ID, network.ID, changeAfter(op, "privateIp"))
+		if err != nil {
+			return nil, err
+		}
+		if err := a.await(ctx, []models.Action{*action}); err != nil {
+			return nil, err
+		}
+	}
+	if server.Status != models.ServerOff {
+		return nil, nil
+	}
+	action, err := a.Hetzner.PowerOnServer(ctx, server.ID)
+	if err != nil {
+		return nil, err
+	}
+	return []models.Action{*action}, nil
+}
+
+// applyFirewall sets the rules and the servers of a firewall to the After
+// values of the "rules" and "appliesTo" changes; changes that are not listed
+// are left as they are.
+func (a *ProviderApplier) applyFirewall(ctx context.Context, op models.Operation, name string) ([]models.Action, error) {
+	firewalls, err := a.Hetzner.ListFirewalls(ctx)
+	if err != nil {
+		return nil, err
+	}
+	existing, ok := findFirewall(firewalls, name)
+
+	if op.Type == "delete" {
+		if !ok {
+			return nil, nil
+		}
+		if len(existing.AppliedTo) > 0 {
+			actions, err := a.Hetzner.RemoveFirewallFromServers(ctx, existing.ID, existing.AppliedTo)
+			if err != nil {
+				return nil, err
+			}
+			if err := a.await(ctx, actions); err != nil {
+				return nil, err
+			}
+		}
+		return nil, a.Hetzner.DeleteFirewall(ctx, existing.ID)
+	}
+	if !slices.Contains([]string{"create", "reconcile", "update"}, op.Type) {
+		return nil, unsupported(op)
+	}
+
+	rulesChange, setRules := change(op, "rules")
+	var rules []models.FirewallRule
+	if setRules {
+		if rules, err = models.ParseFirewallRules(rulesChange.After); err != nil {
+			return nil, err
+		}
+	}
+	appliesChange, setServers := change(op, "appliesTo")
+	var serverIDs []int
+	if setServers {
+		if serverIDs, err = a.serverIDs(ctx, appliesChange.After); err != nil {
+			return nil, err
+		}
+	}
+
+	if !ok {
+		if op.Type != "create" {
+			return nil, fmt.Errorf("firewall %s does not exist", name)
+		}
+		_, actions, err := a.Hetzner.CreateFirewall(ctx, hetzner.CreateFirewallOpts{Name: name, Rules: rules, ApplyTo: serverIDs})
+		return actions, err
+	}
+
+	var actions []models.Action
+	if setRules && models.FormatFirewallRules(existing.Rules) != models.FormatFirewallRules(rules) {
+		started, err := a.Hetzner.SetFirewallRules(ctx, existing.ID, rules)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, started...)
+	}
+	if setServers {
+		var add, remove []int
+		for _, id := range serverIDs {
+			if !slices.Contains(existing.AppliedTo, id) {
+				add = append(add, id)
+			}
+		}
+		for _, id := range existing.AppliedTo {
+			if !slices.Contains(serverIDs, id) {
+				remove = append(remove, id)
+			}
+		}
+		if len(add) > 0 {
+			started, err := a.Hetzner.ApplyFirewallToServers(ctx, existing.ID, add)
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, started...)
+		}
+		if len(remove) > 0 {
+			started, err := a.Hetzner.RemoveFirewallFromServers(ctx, existing.ID, remove)
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, started...)
+		}
+	}
+	return actions, nil
+}
+
+// serverIDs returns the IDs of the servers in a comma-separated list of
+// names.
+func (a *ProviderApplier) serverIDs(ctx context.Context, names string) ([]int, error) {
+	servers, err := a.Hetzner.ListServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		server, ok := findServer(servers, name)
+		if !ok {
+			return nil, fmt.Errorf("server %s does not exist", name)
+		}
+		ids = append(ids, server.ID)
+	}
+	return ids, nil
+}
+
+// applyDNS verifies domains, which must be registered with IPv64 beforehand,
+// and points records of the form "TYPE name" at the After value of their
+// "value" change.
+func (a *ProviderApplier) applyDNS(ctx context.Context, op models.Operation, name string) error {
+	domains, err := a.IPv64.ListDomains(ctx)
+	if err != nil {
+		return err
+	}
+
+	recordType, recordName, isRecord := strings.Cut(name, " ")
+	if !isRecord {
+		if op.Type != "verify" {
+			return unsupported(op)
+		}
+		if !slices.ContainsFunc(domains, func(d models.Domain) bool { return d.Name == name }) {
+			return fmt.Errorf("domain %s is not registered in the IPv64 account", name)
+		}
+		return nil
+	}
+
+	domain, ok := domainOf(domains, recordName)
+	if !ok {
+		return fmt.Errorf("no domain of the IPv64 account contains %s", recordName)
+	}
+	switch op.Type {
+	case "update", "ensure":
+		value := changeAfter(op, "value")
+		if value == "" {
+			// Restoring a record that did not exist removes it.
+			return a.deleteRecords(ctx, domain, recordType, recordName, "")
+		}
+		if recordType == "A" {
+			if value, err = a.address(ctx, value); err != nil {
+				return err
+			}
+		}
+		return a.setRecord(ctx, domain, recordType, recordName, value)
+	case "delete":
+		return a.deleteRecords(ctx, domain, recordType, recordName, "")
+	default:
+		return unsupported(op)
+	}
+}
+
+// address resolves a planned A record value: an IP address, or "public IP of
+// <server>" for a server whose address was unknown when planning.
+func (a *ProviderApplier) address(ctx context.Context, value string) (string, error) {
+	name, ok := strings.CutPrefix(value, "public IP of ")
+	if !ok {
+		return value, nil
+	}
+	if a.Hetzner == nil {
+		return "", errNoHetzner
+	}
+	servers, err := a.Hetzner.ListServers(ctx)
+	if err != nil {
+		return "", err
+	}
+	server, found := findServer(servers, name)
+	switch {
+	case !found:
+		return "", fmt.Errorf("server %s does not exist", name)
+	case server.PublicIP == "":
+		return "", fmt.Errorf("server %s has no public IPv4 address", name)
+	}
+	return server.PublicIP, nil
+}
+
+// setRecord points the records of type and name at value. The A record of a
+// domain is updated through DynDNS when a DynDNS token is configured.
+func (a *ProviderApplier) setRecord(ctx context.Context, domain models.Domain, recordType, name, value string) error {
+	if recordType == "A" && name == domain.Name {
+		err := a.IPv64.UpdateDynDNS(ctx, domain.Name, value)
+		if !errors.Is(err, ipv64.ErrNoDynDNSToken) {
+			return err
+		}
+	}
+	if err := a.deleteRecords(ctx, domain, recordType, name, value); err != nil {
+		return err
+	}
+	for _, r := range domain.Records {
+		if r.Type == recordType && r.Name == name && r.Value == value {
+			return nil
+		}
+	}
+	return a.IPv64.AddRecord(ctx, domain.Name, models.DNSRecord{Type: recordType, Name: name, Value: value})
+}
+
+// deleteRecords deletes the records of type and name, except those pointing
+// at keep.
+func (a *ProviderApplier) deleteRecords(ctx context.Context, domain models.Domain, recordType, name, keep string) error {
+	for _, r := range domain.Records {
+		if r.Type != recordType || r.Name != name || (keep != "" && r.Value == keep) {
+			continue
+		}
+		if err := a.IPv64.DeleteRecord(ctx, r.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// await polls actions until they finish and fails when one of them failed.
+func (a *ProviderApplier) await(ctx context.Context, actions []models.Action) error {
+	for _, action := range actions {
+		current := &action
+		for current.Status == models.ActionRunning {
+			if err := sleep(ctx, a.PollInterval); err != nil {
+				return fmt.Errorf("wait for action %d: %w", action.ID, err)
+			}
+			next, err := a.Hetzner.GetAction(ctx, action.ID)
+			if err != nil {
+				return fmt.Errorf("poll action %d: %w", action.ID, err)
+			}
+			current = next
+		}
+		if current.Status == models.ActionError {
+			return fmt.Errorf("action %d (%s) failed: %s", current.ID, current.Command, current.Error)
+		}
+	}
+	return nil
+}
+
+// domainOf returns the domain containing the record name, preferring the
+// longest match.
+func domainOf(domains []models.Domain, name string) (models.Domain, bool) {
+	var match models.Domain
+	for _, d := range domains {
+		if (name == d.Name || strings.HasSuffix(name, "."+d.Name)) && len(d.Name) > len(match.Name) {
+			match = d
+		}
+	}
+	return match, match.Name != ""
+}
+
+// change returns the change of field in op.
+func change(op models.Operation, field string) (models.Change, bool) {
+	for _, c := range op.Changes {
+		if c.Field == field {
+			return c, true
+		}
+	}
+	return models.Change{}, false
+}
+
+// changeAfter returns the After value of the change of field in op.
+func changeAfter(op models.Operation, field string) string {
+	c, _ := change(op, field)
+	return c.After
+}
+
+func unsupported(op models.Operation) error {
+	return fmt.Errorf("cannot %s a %s", op.Type, op.Kind())
+}
@@ -0,0 +1,479 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/internal/hetzner"
+	"endnet-cli/internal/ipv64"
+	"endnet-cli/internal/sshkey"
+	"endnet-cli/pkg/models"
+)
+
+// fakeHetzner keeps Hetzner resources in memory and records every call.
+// Actions it starts finish after one poll.
+type fakeHetzner struct {
+	mu        sync.Mutex
+	calls     []string
+	nextID    int
+	networks  []models.Network
+	servers   []models.Server
+	sshKeys   []models.SSHKey
+	firewalls []models.Firewall
+	actions   map[int]models.Action
+}
+
+var _ hetzner.Client = (*fakeHetzner)(nil)
+
+func (f *fakeHetzner) record(format string, args ...any) {
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeHetzner) id() int {
+	f.nextID++
+	return f.nextID + 100
+}
+
+func (f *fakeHetzner) action(command string) models.Action {
+	if f.actions == nil {
+		f.actions = make(map[int]models.Action)
+	}
+	a := models.Action{ID: f.id(), Command: command, Status: models.ActionRunning}
+	f.actions[a.ID] = models.Action{ID: a.ID, Command: command, Status: models.ActionSuccess, Progress: 100}
+	return a
+}
+
+func (f *fakeHetzner) Authenticate(string) error { return nil }
+
+func (f *fakeHetzner) ListNetworks(context.Context) ([]models.Network, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.networks), nil
+}
+
+func (f *fakeHetzner) CreateNetwork(_ context.Context, opts hetzner.CreateNetworkOpts) (*models.Network, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("create network %s %s %s %s", opts.Name, opts.CIDR, opts.SubnetCIDR, opts.Zone)
+	n := models.Network{ID: f.id(), Name: opts.Name, CIDR: opts.CIDR}
+	f.networks = append(f.networks, n)
+	return &n, nil
+}
+
+func (f *fakeHetzner) DeleteNetwork(_ context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("delete network %d", id)
+	f.networks = slices.DeleteFunc(f.networks, func(n models.Network) bool { return n.ID == id })
+	return nil
+}
+
+func (f *fakeHetzner) ListServers(context.Context) ([]models.Server, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.servers), nil
+}
+
+func (f *fakeHetzner) CreateServer(_ context.Context, opts hetzner.CreateServerOpts) (*models.Server, []models.Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("create server %s %s %s %s keys %v ipv4 %v start %v", opts.Name, opts.Type, opts.Image, opts.Location, opts.SSHKeys, opts.EnableIPv4, opts.StartAfterCreate)
+	s := models.Server{ID: f.id(), Name: opts.Name, Type: opts.Type, Image: opts.Image, Status: models.ServerOff}
+	if opts.EnableIPv4 {
+		s.PublicIP = "192.0.2.1"
+	}
+	f.servers = append(f.servers, s)
+	return &s, []models.Action{f.action("create_server")}, nil
+}
+
+func (f *fakeHetzner) server(id int) *models.Server {
+	for i := range f.servers {
+		if f.servers[i].ID == id {
+			return &f.servers[i]
+		}
+	}
+	return nil
+}
+
+func (f *fakeHetzner) AttachServerToNetwork(_ context.Context, id, networkID int, ip string) (*models.Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("attach server %d to network %d with %s", id, networkID, ip)
+	f.server(id).PrivateIP = ip
+	a := f.action("attach_to_network")
+	return &a, nil
+}
+
+func (f *fakeHetzner) PowerOnServer(_ context.Context, id int) (*models.Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("power on server %d", id)
+	f.server(id).Status = models.ServerRunning
+	a := f.action("start_server")
+	return &a, nil
+}
+
+func (f *fakeHetzner) DeleteServer(_ context.Context, id int) (*models.Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("delete server %d", id)
+	f.servers = slices.DeleteFunc(f.servers, func(s models.Server) bool { return s.ID == id })
+	a := f.action("delete_server")
+	return &a, nil
+}
+
+func (f *fakeHetzner) ListSSHKeys(context.Context) ([]models.SSHKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.sshKeys), nil
+}
+
+func (f *fakeHetzner) CreateSSHKey(_ context.Context, name, publicKey string) (*models.SSHKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("create ssh key %s", name)
+	k := models.SSHKey{ID: f.id(), Name: name, PublicKey: publicKey}
+	f.sshKeys = append(f.sshKeys, k)
+	return &k, nil
+}
+
+func (f *fakeHetzner) DeleteSSHKey(_ context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("delete ssh key %d", id)
+	f.sshKeys = slices.DeleteFunc(f.sshKeys, func(k models.SSHKey) bool { return k.ID == id })
+	return nil
+}
+
+func (f *fakeHetzner) ListFirewalls(context.Context) ([]models.Firewall, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.firewalls), nil
+}
+
+func (f *fakeHetzner) CreateFirewall(_ context.Context, opts hetzner.CreateFirewallOpts) (*models.Firewall, []models.Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("create firewall %s with %d rules for %v", opts.Name, len(opts.Rules), opts.ApplyTo)
+	fw := models.Firewall{ID: f.id(), Name: opts.Name, Rules: opts.Rules, AppliedTo: opts.ApplyTo}
+	f.firewalls = append(f.firewalls, fw)
+	return &fw, []models.Action{f.action("apply_firewall")}, nil
+}
+
+func (f *fakeHetzner) SetFirewallRules(_ context.Context, id int, rules []models.FirewallRule) ([]models.Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("set firewall %d rules %s", id, models.FormatFirewallRules(rules))
+	return []models.Action{f.action("set_firewall_rules")}, nil
+}
+
+func (f *fakeHetzner) ApplyFirewallToServers(_ context.Context, id int, serverIDs []int) ([]models.Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("apply firewall %d to %v", id, serverIDs)
+	return []models.Action{f.action("apply_firewall")}, nil
+}
+
+func (f *fakeHetzner) RemoveFirewallFromServers(_ context.Context, id int, serverIDs []int) ([]models.Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("remove firewall %d from %v", id, serverIDs)
+	return []models.Action{f.action("remove_firewall")}, nil
+}
+
+func (f *fakeHetzner) DeleteFirewall(_ context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("delete firewall %d", id)
+	return nil
+}
+
+func (f *fakeHetzner) GetAction(_ context.Context, id int) (*models.Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.actions[id]
+	if !ok {
+		return nil, &models.APIError{Provider: "hetzner", StatusCode: 404, Code: "not_found"}
+	}
+	return &a, nil
+}
+
+// fakeIPv64 keeps one domain in memory and records every call.
+type fakeIPv64 struct {
+	calls       []string
+	domain      models.Domain
+	dynDNSToken bool
+}
+
+var _ ipv64.Client = (*fakeIPv64)(nil)
+
+func (f *fakeIPv64) Authenticate(string) error { return nil }
+
+func (f *fakeIPv64) ListDomains(context.Context) ([]models.Domain, error) {
+	d := f.domain
+	d.Records = slices.Clone(d.Records)
+	return []models.Domain{d}, nil
+}
+
+func (f *fakeIPv64) AddRecord(_ context.Context, domain string, r models.DNSRecord) error {
+	f.calls = append(f.calls, fmt.Sprintf("add %s %s %s to %s", r.Type, r.Name, r.Value, domain))
+	r.ID = len(f.domain.Records) + 100
+	f.domain.Records = append(f.domain.Records, r)
+	return nil
+}
+
+func (f *fakeIPv64) DeleteRecord(_ context.Context, id int) error {
+	f.calls = append(f.calls, fmt.Sprintf("delete record %d", id))
+	f.domain.Records = slices.DeleteFunc(f.domain.Records, func(r models.DNSRecord) bool { return r.ID == id })
+	return nil
+}
+
+func (f *fakeIPv64) UpdateDynDNS(_ context.Context, domain, ip string) error {
+	if !f.dynDNSToken {
+		return ipv64.ErrNoDynDNSToken
+	}
+	f.calls = append(f.calls, fmt.Sprintf("dyndns %s %s", domain, ip))
+	return nil
+}
+
+func testSpec() models.EndnetSpec {
+	spec := config.DefaultConfig().ToSpec()
+	spec.SSHKey.PublicKey = "ssh-ed25519 AAAA"
+	spec.SSHKey.Fingerprint = "SHA256:abc"
+	return spec
+}
+
+func newTestApplier(hz *fakeHetzner, dns *fakeIPv64) *ProviderApplier {
+	a := NewProviderApplier(nil, hz, dns, testSpec())
+	a.PollInterval = 0
+	return a
+}
+
+func TestProviderApplierCreatesServer(t *testing.T) {
+	hz := &fakeHetzner{
+		networks: []models.Network{{ID: 1, Name: "endnet-internal"}},
+		sshKeys:  []models.SSHKey{{ID: 7, Name: "endnet"}},
+	}
+	op := models.Operation{Type: "create", Target: "server:endnet-wg-1", Changes: []models.Change{
+		{Field: "type", After: "cx23"},
+		{Field: "image", After: "debian-12"},
+		{Field: "privateIp", After: "10.10.0.10"},
+		{Field: "publicIp", After: "false"},
+		{Field: "sshKey", After: "endnet"},
+	}}
+
+	actions, err := newTestApplier(hz, nil).Apply(context.Background(), op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"create server endnet-wg-1 cx23 debian-12 nbg1 keys [7] ipv4 false start false",
+		"attach server 101 to network 1 with 10.10.0.10",
+		"power on server 101",
+	}
+	if !slices.Equal(hz.calls, want) {
+		t.Fatalf("calls:\n%s\nwant:\n%s", strings.Join(hz.calls, "\n"), strings.Join(want, "\n"))
+	}
+	if len(actions) != 1 || actions[0].Command != "start_server" {
+		t.Fatalf("actions = %+v, want the power-on action for the executor to await", actions)
+	}
+
+	// Applying again, e.g. after a retry, changes nothing.
+	hz.calls = nil
+	actions, err = newTestApplier(hz, nil).Apply(context.Background(), op)
+	if err != nil || len(actions) != 0 || len(hz.calls) != 0 {
+		t.Fatalf("second apply: actions %+v, calls %v, error %v", actions, hz.calls, err)
+	}
+}
+
+func TestProviderApplierFinishesInterruptedServerCreation(t *testing.T) {
+	hz := &fakeHetzner{
+		networks: []models.Network{{ID: 1, Name: "endnet-internal"}},
+		servers:  []models.Server{{ID: 5, Name: "endnet-git-1", Status: models.ServerOff}},
+	}
+	op := models.Operation{Type: "create", Target: "server:endnet-git-1", Changes: []models.Change{{Field: "privateIp", After: "10.10.0.20"}}}
+
+	if _, err := newTestApplier(hz, nil).Apply(context.Background(), op); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"attach server 5 to network 1 with 10.10.0.20", "power on server 5"}
+	if !slices.Equal(hz.calls, want) {
+		t.Fatalf("calls = %v, want %v", hz.calls, want)
+	}
+}
+
+func TestProviderApplierGeneratesSSHKey(t *testing.T) {
+	hz := &fakeHetzner{}
+	a := newTestApplier(hz, nil)
+	a.Spec.SSHKey.PublicKey = ""
+	a.Spec.SSHKey.PublicKeyPath = filepath.Join(t.TempDir(), "endnet_ed25519.pub")
+	op := models.Operation{Type: "create", Target: "sshkey:endnet"}
+
+	if _, err := a.Apply(context.Background(), op); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(a.Spec.SSHKey.PublicKeyPath)
+	if err != nil {
+		t.Fatalf("public key was not written: %v", err)
+	}
+	if len(hz.sshKeys) != 1 || hz.sshKeys[0].PublicKey != strings.TrimSpace(string(data)) {
+		t.Fatalf("uploaded keys = %+v, want the generated key %q", hz.sshKeys, data)
+	}
+}
+
+func TestProviderApplierReplacesDriftedSSHKey(t *testing.T) {
+	hz := &fakeHetzner{sshKeys: []models.SSHKey{{ID: 7, Name: "endnet", Fingerprint: "00:11"}}}
+	a := newTestApplier(hz, nil)
+	dir := t.TempDir()
+	publicKey, err := sshkey.Generate(filepath.Join(dir, "id.pub"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Spec.SSHKey.PublicKey = publicKey
+	op := models.Operation{Type: "drift", Target: "sshkey:endnet"}
+
+	if _, err := a.Apply(context.Background(), op); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"delete ssh key 7", "create ssh key endnet"}
+	if !slices.Equal(hz.calls, want) {
+		t.Fatalf("calls = %v, want %v", hz.calls, want)
+	}
+	if len(hz.sshKeys) != 1 || hz.sshKeys[0].PublicKey != publicKey {
+		t.Fatalf("keys = %+v, want the local key", hz.sshKeys)
+	}
+}
+
+func TestProviderApplierFirewall(t *testing.T) {
+	spec := testSpec()
+	rules := models.FormatFirewallRules(spec.Firewall.Rules)
+	tests := []struct {
+		name      string
+		firewalls []models.Firewall
+		op        models.Operation
+		want      []string
+	}{
+		{
+			name: "create",
+			op: models.Operation{Type: "create", Target: "firewall:endnet-edge", Changes: []models.Change{
+				{Field: "rules", After: rules}, {Field: "appliesTo", After: "endnet-edge-1"},
+			}},
+			want: []string{"create firewall endnet-edge with 4 rules for [1]"},
+		},
+		{
+			name:      "reconcile rules and servers",
+			firewalls: []models.Firewall{{ID: 9, Name: "endnet-edge", AppliedTo: []int{2}}},
+			op: models.Operation{Type: "reconcile", Target: "firewall:endnet-edge", Changes: []models.Change{
+				{Field: "rules", After: rules}, {Field: "appliesTo", Before: "endnet-wg-1", After: "endnet-edge-1,endnet-wg-1"},
+			}},
+			want: []string{"set firewall 9 rules " + rules, "apply firewall 9 to [1]"},
+		},
+		{
+			name:      "roll back servers",
+			firewalls: []models.Firewall{{ID: 9, Name: "endnet-edge", Rules: spec.Firewall.Rules, AppliedTo: []int{1, 2}}},
+			op: models.Operation{Type: "update", Target: "firewall:endnet-edge", Changes: []models.Change{
+				{Field: "appliesTo", Before: "endnet-edge-1,endnet-wg-1", After: "endnet-wg-1"},
+			}},
+			want: []string{"remove firewall 9 from [1]"},
+		},
+		{
+			name:      "delete",
+			firewalls: []models.Firewall{{ID: 9, Name: "endnet-edge", AppliedTo: []int{1}}},
+			op:        models.Operation{Type: "delete", Target: "firewall:endnet-edge"},
+			want:      []string{"remove firewall 9 from [1]", "delete firewall 9"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hz := &fakeHetzner{
+				servers:   []models.Server{{ID: 1, Name: "endnet-edge-1"}, {ID: 2, Name: "endnet-wg-1"}},
+				firewalls: tt.firewalls,
+			}
+			if _, err := newTestApplier(hz, nil).Apply(context.Background(), tt.op); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(hz.calls, tt.want) {
+				t.Fatalf("calls = %q, want %q", hz.calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderApplierDNS(t *testing.T) {
+	records := []models.DNSRecord{
+		{ID: 1, Type: "A", Name: "endnet.ipv64.net", Value: "192.0.2.9"},
+		{ID: 2, Type: "CNAME", Name: "git.endnet.ipv64.net", Value: "elsewhere.example"},
+	}
+	aRecord := models.Operation{Type: "update", Target: "dns:A endnet.ipv64.net", Changes: []models.Change{
+		{Field: "value", Before: "192.0.2.9", After: "public IP of endnet-edge-1"},
+	}}
+	tests := []struct {
+		name   string
+		op     models.Operation
+		dynDNS bool
+		want   []string
+	}{
+		{"A record through DynDNS", aRecord, true, []string{"dyndns endnet.ipv64.net 192.0.2.1"}},
+		{"A record without DynDNS token", aRecord, false, []string{"delete record 1", "add A endnet.ipv64.net 192.0.2.1 to endnet.ipv64.net"}},
+		{
+			name: "CNAME",
+			op: models.Operation{Type: "ensure", Target: "dns:CNAME git.endnet.ipv64.net", Changes: []models.Change{
+				{Field: "value", Before: "elsewhere.example", After: "endnet.ipv64.net"},
+			}},
+			want: []string{"delete record 2", "add CNAME git.endnet.ipv64.net endnet.ipv64.net to endnet.ipv64.net"},
+		},
+		{"delete CNAME", models.Operation{Type: "delete", Target: "dns:CNAME git.endnet.ipv64.net"}, false, []string{"delete record 2"}},
+		{
+			name: "restore a missing record",
+			op: models.Operation{Type: "update", Target: "dns:CNAME git.endnet.ipv64.net", Changes: []models.Change{
+				{Field: "value", Before: "endnet.ipv64.net", After: ""},
+			}},
+			want: []string{"delete record 2"},
+		},
+		{"verify domain", models.Operation{Type: "verify", Target: "dns:endnet.ipv64.net"}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hz := &fakeHetzner{servers: []models.Server{{ID: 1, Name: "endnet-edge-1", PublicIP: "192.0.2.1"}}}
+			dns := &fakeIPv64{domain: models.Domain{Name: "endnet.ipv64.net", Records: slices.Clone(records)}, dynDNSToken: tt.dynDNS}
+			if _, err := newTestApplier(hz, dns).Apply(context.Background(), tt.op); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(dns.calls, tt.want) {
+				t.Fatalf("calls = %q, want %q", dns.calls, tt.want)
+			}
+		})
+	}
+
+	dns := &fakeIPv64{domain: models.Domain{Name: "other.ipv64.net"}}
+	_, err := newTestApplier(&fakeHetzner{}, dns).Apply(context.Background(), models.Operation{Type: "verify", Target: "dns:endnet.ipv64.net"})
+	if err == nil {
+		t.Fatal("verify succeeded for a domain missing from the account")
+	}
+}
+
+func TestProviderApplierWithoutClient(t *testing.T) {
+	a := NewProviderApplier(nil, nil, nil, testSpec())
+	for _, tt := range []struct {
+		op   models.Operation
+		want error
+	}{
+		{models.Operation{Type: "create", Target: "network:endnet-internal"}, errNoHetzner},
+		{models.Operation{Type: "update", Target: "dns:A endnet.ipv64.net"}, errNoIPv64},
+	} {
+		if _, err := a.Apply(context.Background(), tt.op); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.op.Target, err, tt.want)
+		}
+	}
+	if _, err := a.Apply(context.Background(), models.Operation{Type: "noop", Target: "network:endnet-internal"}); err != nil {
+		t.Errorf("noop: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+// DefaultRetryPolicy applies to resource kinds without a configured policy.
+var DefaultRetryPolicy = models.RetryPolicy{
+	MaxAttempts:  5,
+	InitialDelay: time.Second,
+	MaxDelay:     30 * time.Second,
+}
+
+// IsRetryable reports whether err is transient so the failed call may be
+// repeated. Errors that know it themselves, such as *models.APIError, decide
+// for themselves; network timeouts are retryable; everything else is
+// permanent.
+func IsRetryable(err error) bool {
+	var classified interface{ Retryable() bool }
+	if errors.As(err, &classified) {
+		return classified.Retryable()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+	return false
+}
+
+// retryPolicy returns the policy for an operation's resource kind.
+func (e *DefaultExecutor) retryPolicy(op models.Operation) models.RetryPolicy {
+	if policy, ok := e.Retry[op.Kind()]; ok {
+		return policy
+	}
+	return DefaultRetryPolicy
+}
+
+// retry calls fn until it succeeds, fails permanently, the policy's attempts
+// are used up or ctx is cancelled. Every retried failure is passed to record.
+func (e *DefaultExecutor) retry(ctx context.Context, op models.Operation, record func(models.Retry), fn func() error) error {
+	policy := e.retryPolicy(op)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || !IsRetryable(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		delay := backoff(policy, attempt)
+		operationLogger(e.logger, op).Warn("retrying after transient error", "attempt", attempt, "delay", delay, "error", err)
+		record(models.Retry{Target: op.Target, Attempt: attempt, Error: err.Error(), Delay: delay, Time: time.Now()})
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for d to pass and returns early with the context's error when
+// ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff returns the delay after the given failed attempt: InitialDelay
+// doubled per previous retry and capped at MaxDelay, of which a random half
+// is taken off so concurrent retries spread out.
+func backoff(policy models.RetryPolicy, attempt int) time.Duration {
+	delay := policy.InitialDelay
+	for i := 1; i < attempt && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+func TestBackoffBounds(t *testing.T) {
+	policy := models.RetryPolicy{MaxAttempts: 10, InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{4, 400 * time.Millisecond, 800 * time.Millisecond},
+		// Capped at MaxDelay from here on.
+		{5, 500 * time.Millisecond, time.Second},
+		{50, 500 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint("attempt ", tt.attempt), func(t *testing.T) {
+			seen := make(map[time.Duration]bool)
+			for range 200 {
+				d := backoff(policy, tt.attempt)
+				if d < tt.min || d > tt.max {
+					t.Fatalf("backoff = %s, want within [%s, %s]", d, tt.min, tt.max)
+				}
+				seen[d] = true
+			}
+			if len(seen) < 2 {
+				t.Fatalf("backoff is not jittered: %v", seen)
+			}
+		})
+	}
+
+	if d := backoff(models.RetryPolicy{}, 3); d != 0 {
+		t.Fatalf("backoff without delays = %s, want 0", d)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"locked", &models.APIError{StatusCode: 423, Code: "locked"}, true},
+		{"wrapped server error", fmt.Errorf("create: %w", &models.APIError{StatusCode: 503}), true},
+		{"invalid input", &models.APIError{StatusCode: 400, Code: "invalid_input"}, false},
+		{"network timeout", &net.OpError{Op: "dial", Err: timeoutError{}}, true},
+		{"plain error", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryStopsAtMaxAttempts(t *testing.T) {
+	e := NewExecutorWithOptions(nil, ExecutorOptions{Retry: map[string]models.RetryPolicy{
+		"dns": {MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}}).(*DefaultExecutor)
+	op := models.Operation{Type: "update", Target: "dns:A endnet.ipv64.net"}
+
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{"retryable", &models.APIError{StatusCode: 429}, 3},
+		{"permanent", &models.APIError{StatusCode: 400}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			var retries []models.Retry
+			err := e.retry(context.Background(), op, func(r models.Retry) { retries = append(retries, r) }, func() error {
+				calls++
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) || calls != tt.wantCalls || len(retries) != tt.wantCalls-1 {
+				t.Fatalf("err %v after %d calls and %d retries, want %d calls", err, calls, len(retries), tt.wantCalls)
+			}
+		})
+	}
+}
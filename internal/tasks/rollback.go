@@ -0,0 +1,107 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"endnet-cli/pkg/models"
+)
+
+// Compensation returns the operation undoing op after it was applied:
+// created resources are deleted and updated ones are set back to the Before
+// values of their changes, which may be empty. An ensure operation with an
+// empty Before value created its resource, which is deleted. It returns nil
+// for operations that changed nothing, and ok is false for changes that
+// cannot be undone, such as updates without changes or replaced SSH keys.
+func Compensation(op models.Operation) (undo *models.Operation, ok bool) {
+	deleteOp := &models.Operation{
+		Type:    "delete",
+		Target:  op.Target,
+		Details: fmt.Sprintf("delete %s created by the failed apply", op.Target),
+	}
+
+	switch op.Type {
+	case "noop", "verify":
+		return nil, true
+	case "drift":
+		return nil, false
+	case "create":
+		return deleteOp, true
+	}
+
+	if len(op.Changes) == 0 {
+		return nil, false
+	}
+	revert := &models.Operation{
+		Type:    "update",
+		Target:  op.Target,
+		Details: fmt.Sprintf("restore previous values of %s", op.Target),
+	}
+	for _, c := range op.Changes {
+		if c.Before == "" && op.Type == "ensure" {
+			// The resource did not exist before.
+			return deleteOp, true
+		}
+		revert.Changes = append(revert.Changes, models.Change{Field: c.Field, Before: c.After, After: c.Before})
+	}
+	return revert, true
+}
+
+// compensation pairs an applied operation with the operation undoing it,
+// which is nil when the operation cannot be undone.
+type compensation struct {
+	index   int
+	applied models.Operation
+	undo    *models.Operation
+}
+
+// rollback applies the recorded compensations in reverse order and reports
+// what was undone. Failures do not stop the rollback of other operations,
+// but an operation is kept while an operation depending on it is left in
+// place.
+func (e *DefaultExecutor) rollback(ctx context.Context, compensations []compensation, total int, record func(models.Retry)) *models.RollbackReport {
+	report := &models.RollbackReport{}
+	// kept maps the targets left in place to the targets they depend on.
+	kept := make(map[string][]string)
+	keptDependent := func(target string) string {
+		for dependent, deps := range kept {
+			if slices.Contains(deps, target) {
+				return dependent
+			}
+		}
+		return ""
+	}
+
+	for i := len(compensations) - 1; i >= 0; i-- {
+		c := compensations[i]
+		if c.undo == nil {
+			operationLogger(e.logger, c.applied).Warn("operation cannot be rolled back")
+			report.Irreversible = append(report.Irreversible, c.applied)
+			kept[c.applied.Target] = c.applied.DependsOn
+			continue
+		}
+		if dependent := keptDependent(c.applied.Target); dependent != "" {
+			err := fmt.Errorf("still required by %s, which was not rolled back", dependent)
+			report.Failed = append(report.Failed, models.RollbackFailure{Operation: *c.undo, Error: err.Error()})
+			e.emit(Event{Kind: EventRollbackFailed, Operation: *c.undo, Index: c.index, Total: total, Err: err})
+			kept[c.applied.Target] = c.applied.DependsOn
+			continue
+		}
+
+		started := time.Now()
+		e.emit(Event{Kind: EventRollingBack, Operation: *c.undo, Index: c.index, Total: total})
+		err := e.apply(ctx, *c.undo, c.index, total, started, record)
+		if err != nil {
+			operationLogger(e.logger, *c.undo).Error("rollback failed", "error", err)
+			report.Failed = append(report.Failed, models.RollbackFailure{Operation: *c.undo, Error: err.Error()})
+			e.emit(Event{Kind: EventRollbackFailed, Operation: *c.undo, Index: c.index, Total: total, Elapsed: time.Since(started), Err: err})
+			kept[c.applied.Target] = c.applied.DependsOn
+			continue
+		}
+		report.RolledBack = append(report.RolledBack, *c.undo)
+		e.emit(Event{Kind: EventRolledBack, Operation: *c.undo, Index: c.index, Total: total, Elapsed: time.Since(started)})
+	}
+	return report
+}
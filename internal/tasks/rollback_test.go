@@ -0,0 +1,212 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"endnet-cli/pkg/models"
+)
+
+// recordingApplier records the operations it applies as "type target" and
+// fails those listed in fail.
+type recordingApplier struct {
+	mu      sync.Mutex
+	fail    map[string]bool
+	actions map[string][]models.Action
+	applied []string
+}
+
+func (a *recordingApplier) Apply(_ context.Context, op models.Operation) ([]models.Action, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	call := op.Type + " " + op.Target
+	a.applied = append(a.applied, call)
+	if a.fail[call] {
+		return nil, errors.New("provider rejected the request")
+	}
+	return a.actions[op.Target], nil
+}
+
+func TestCompensation(t *testing.T) {
+	tests := []struct {
+		name   string
+		op     models.Operation
+		want   *models.Operation
+		wantOK bool
+	}{
+		{
+			name:   "create is deleted",
+			op:     models.Operation{Type: "create", Target: "server:a"},
+			want:   &models.Operation{Type: "delete", Target: "server:a"},
+			wantOK: true,
+		},
+		{
+			name: "update restores previous values",
+			op: models.Operation{Type: "update", Target: "dns:A a", Changes: []models.Change{
+				{Field: "value", Before: "192.0.2.1", After: "192.0.2.2"},
+			}},
+			want: &models.Operation{Type: "update", Target: "dns:A a", Changes: []models.Change{
+				{Field: "value", Before: "192.0.2.2", After: "192.0.2.1"},
+			}},
+			wantOK: true,
+		},
+		{
+			name:   "ensure of a missing resource is deleted",
+			op:     models.Operation{Type: "ensure", Target: "dns:CNAME b", Changes: []models.Change{{Field: "value", After: "a"}}},
+			want:   &models.Operation{Type: "delete", Target: "dns:CNAME b"},
+			wantOK: true,
+		},
+		{
+			name: "update restores empty previous values",
+			op: models.Operation{Type: "reconcile", Target: "firewall:f", Changes: []models.Change{
+				{Field: "rules", Before: "in tcp 22", After: "in tcp 22; in tcp 443"},
+				{Field: "appliesTo", After: "edge"},
+			}},
+			want: &models.Operation{Type: "update", Target: "firewall:f", Changes: []models.Change{
+				{Field: "rules", Before: "in tcp 22; in tcp 443", After: "in tcp 22"},
+				{Field: "appliesTo", Before: "edge", After: ""},
+			}},
+			wantOK: true,
+		},
+		{
+			name: "update without changes",
+			op:   models.Operation{Type: "update", Target: "dns:A a"},
+		},
+		{
+			name: "replaced ssh key",
+			op:   models.Operation{Type: "drift", Target: "sshkey:k"},
+		},
+		{
+			name:   "noop",
+			op:     models.Operation{Type: "noop", Target: "server:a"},
+			wantOK: true,
+		},
+		{
+			name:   "verify",
+			op:     models.Operation{Type: "verify", Target: "dns:rootDomain"},
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			undo, ok := Compensation(tt.op)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			switch {
+			case tt.want == nil && undo != nil:
+				t.Fatalf("undo = %+v, want none", undo)
+			case tt.want == nil:
+			case undo == nil:
+				t.Fatalf("undo = nil, want %+v", tt.want)
+			case undo.Type != tt.want.Type || undo.Target != tt.want.Target || !slices.Equal(undo.Changes, tt.want.Changes):
+				t.Fatalf("undo = %+v, want %+v", undo, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	network := models.Operation{Type: "create", Target: "network:n"}
+	key := models.Operation{Type: "create", Target: "sshkey:k"}
+	server := models.Operation{Type: "create", Target: "server:a", DependsOn: []string{"network:n", "sshkey:k"}}
+	record := models.Operation{Type: "update", Target: "dns:A a", DependsOn: []string{"server:a"}, Changes: []models.Change{
+		{Field: "value", Before: "192.0.2.1", After: "192.0.2.2"},
+	}}
+	failing := models.Operation{Type: "ensure", Target: "dns:CNAME b", DependsOn: []string{"dns:A a"}, Changes: []models.Change{
+		{Field: "value", After: "a"},
+	}}
+
+	tests := []struct {
+		name             string
+		plan             *models.Plan
+		fail             []string
+		wantCalls        []string
+		wantIrreversible []string
+		wantFailed       []string
+	}{
+		{
+			name: "reverse order",
+			plan: &models.Plan{
+				NetworkOps: []models.Operation{network},
+				SSHKeyOps:  []models.Operation{key},
+				ServerOps:  []models.Operation{server},
+				DNSOps:     []models.Operation{record, failing},
+			},
+			fail: []string{"ensure dns:CNAME b"},
+			wantCalls: []string{
+				"create network:n", "create sshkey:k", "create server:a", "update dns:A a", "ensure dns:CNAME b",
+				"update dns:A a", "delete server:a", "delete sshkey:k", "delete network:n",
+			},
+		},
+		{
+			name: "irreversible operation keeps its dependencies",
+			plan: &models.Plan{
+				NetworkOps: []models.Operation{network},
+				SSHKeyOps:  []models.Operation{{Type: "drift", Target: "sshkey:k"}},
+				ServerOps:  []models.Operation{server},
+				DNSOps:     []models.Operation{{Type: "update", Target: "dns:A a", DependsOn: []string{"server:a"}}, failing},
+			},
+			fail: []string{"ensure dns:CNAME b"},
+			wantCalls: []string{
+				"create network:n", "drift sshkey:k", "create server:a", "update dns:A a", "ensure dns:CNAME b",
+			},
+			wantIrreversible: []string{"dns:A a", "sshkey:k"},
+			wantFailed:       []string{"delete server:a", "delete network:n"},
+		},
+		{
+			name: "failed compensation keeps its dependencies",
+			plan: &models.Plan{
+				NetworkOps: []models.Operation{network},
+				SSHKeyOps:  []models.Operation{key},
+				ServerOps:  []models.Operation{server},
+				DNSOps:     []models.Operation{record, failing},
+			},
+			fail: []string{"ensure dns:CNAME b", "delete server:a"},
+			wantCalls: []string{
+				"create network:n", "create sshkey:k", "create server:a", "update dns:A a", "ensure dns:CNAME b",
+				"update dns:A a", "delete server:a",
+			},
+			wantFailed: []string{"delete server:a", "delete sshkey:k", "delete network:n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applier := &recordingApplier{fail: make(map[string]bool)}
+			for _, call := range tt.fail {
+				applier.fail[call] = true
+			}
+			// A single worker applies the operations in plan order.
+			e := NewExecutorWithOptions(nil, ExecutorOptions{Applier: applier, Parallelism: 1, RollbackOnFailure: true})
+
+			result, err := e.Execute(context.Background(), tt.plan)
+			if err == nil || !strings.Contains(err.Error(), "dns:CNAME b") {
+				t.Fatalf("error = %v, want the failure of dns:CNAME b", err)
+			}
+			if !slices.Equal(applier.applied, tt.wantCalls) {
+				t.Fatalf("calls:\n%s\nwant:\n%s", strings.Join(applier.applied, "\n"), strings.Join(tt.wantCalls, "\n"))
+			}
+			if result.Rollback == nil {
+				t.Fatal("execution was not rolled back")
+			}
+
+			var irreversible, failed []string
+			for _, op := range result.Rollback.Irreversible {
+				irreversible = append(irreversible, op.Target)
+			}
+			for _, f := range result.Rollback.Failed {
+				failed = append(failed, f.Operation.Type+" "+f.Operation.Target)
+			}
+			if !slices.Equal(irreversible, tt.wantIrreversible) {
+				t.Errorf("irreversible = %v, want %v", irreversible, tt.wantIrreversible)
+			}
+			if !slices.Equal(failed, tt.wantFailed) {
+				t.Errorf("failed = %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
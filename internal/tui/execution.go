@@ -0,0 +1,197 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+)
+
+type opStatus int
+
+const (
+	statusPending opStatus = iota
+	statusRunning
+	statusDone
+	statusFailed
+	statusRollingBack
+	statusRolledBack
+	statusRollbackFailed
+)
+
+var (
+	doneStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	runningStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+)
+
+// eventMsg forwards an executor event to the Bubble Tea program.
+type eventMsg tasks.Event
+
+// logMsg forwards a single log line to the Bubble Tea program.
+type logMsg string
+
+// tickMsg triggers a redraw so elapsed times of running operations advance.
+type tickMsg time.Time
+
+// execution tracks the progress of an apply for the execution view.
+type execution struct {
+	ops     []models.Operation
+	status  []opStatus
+	started []time.Time
+	elapsed []time.Duration
+	actions []*models.Action
+	errs    []error
+	logs    []string
+	logBack int
+	running bool
+}
+
+func newExecution(plan *models.Plan) execution {
+	ops := plan.Operations()
+	return execution{
+		ops:     ops,
+		status:  make([]opStatus, len(ops)),
+		started: make([]time.Time, len(ops)),
+		elapsed: make([]time.Duration, len(ops)),
+		actions: make([]*models.Action, len(ops)),
+		errs:    make([]error, len(ops)),
+		running: true,
+	}
+}
+
+// record applies an executor event to the tracked operation.
+func (x *execution) record(e tasks.Event) {
+	if e.Index < 0 || e.Index >= len(x.ops) {
+		return
+	}
+
+	i := e.Index
+	switch e.Kind {
+	case tasks.EventStarted:
+		x.status[i] = statusRunning
+		x.started[i] = e.Time
+	case tasks.EventSkipped:
+		x.status[i] = statusDone
+	case tasks.EventProgress:
+		x.actions[i] = e.Action
+	case tasks.EventFinished:
+		x.status[i] = statusDone
+		x.elapsed[i] = e.Elapsed
+	case tasks.EventFailed:
+		x.status[i] = statusFailed
+		x.elapsed[i] = e.Elapsed
+		x.errs[i] = e.Err
+	case tasks.EventRollingBack:
+		x.status[i] = statusRollingBack
+		x.started[i] = e.Time
+	case tasks.EventRolledBack:
+		x.status[i] = statusRolledBack
+		x.elapsed[i] = e.Elapsed
+	case tasks.EventRollbackFailed:
+		x.status[i] = statusRollbackFailed
+		x.elapsed[i] = e.Elapsed
+		x.errs[i] = e.Err
+	}
+}
+
+func (x *execution) appendLog(line string) {
+	x.logs = append(x.logs, line)
+	// Keep the view anchored when the user scrolled back in the log.
+	if x.logBack > 0 {
+		x.logBack++
+	}
+}
+
+// scrollLog moves the log window; positive deltas scroll towards older lines.
+func (x *execution) scrollLog(delta int) {
+	x.logBack += delta
+	if x.logBack > len(x.logs)-1 {
+		x.logBack = len(x.logs) - 1
+	}
+	if x.logBack < 0 {
+		x.logBack = 0
+	}
+}
+
+// render draws the operation list followed by a log pane filling the
+// remaining height.
+func (x execution) render(height int, now time.Time) []string {
+	if len(x.ops) == 0 && !x.running {
+		return []string{"No plan has been applied yet. Select operations in the Plan view and press a."}
+	}
+
+	lines := make([]string, 0, height)
+	for i, op := range x.ops {
+		lines = append(lines, x.renderOperation(i, op, now))
+	}
+
+	logHeight := height - len(lines) - 2
+	if logHeight < 1 {
+		return lines
+	}
+
+	title := "log"
+	if x.logBack > 0 {
+		title = fmt.Sprintf("log (%d lines back, ↓ to follow)", x.logBack)
+	}
+	lines = append(lines, "", helpStyle.Render(title))
+
+	end := len(x.logs) - x.logBack
+	start := end - logHeight
+	if start < 0 {
+		start = 0
+	}
+	lines = append(lines, x.logs[start:end]...)
+	return lines
+}
+
+func (x execution) renderOperation(i int, op models.Operation, now time.Time) string {
+	var icon, timing string
+	switch x.status[i] {
+	case statusPending:
+		icon = helpStyle.Render("·")
+		timing = "pending"
+	case statusRunning:
+		icon = runningStyle.Render("▶")
+		timing = "running " + now.Sub(x.started[i]).Round(100*time.Millisecond).String()
+	case statusDone:
+		icon = doneStyle.Render("✓")
+		timing = "done in " + x.elapsed[i].Round(time.Millisecond).String()
+	case statusFailed:
+		icon = errorStyle.Render("✗")
+		timing = "failed after " + x.elapsed[i].Round(time.Millisecond).String()
+	case statusRollingBack:
+		icon = runningStyle.Render("↺")
+		timing = "rolling back " + now.Sub(x.started[i]).Round(100*time.Millisecond).String()
+	case statusRolledBack:
+		icon = helpStyle.Render("↺")
+		timing = "rolled back in " + x.elapsed[i].Round(time.Millisecond).String()
+	case statusRollbackFailed:
+		icon = errorStyle.Render("✗")
+		timing = "rollback failed after " + x.elapsed[i].Round(time.Millisecond).String()
+	}
+
+	line := fmt.Sprintf("%s %-10s %-40s %s", icon, op.Type, op.Target, timing)
+	if action := x.actions[i]; action != nil && (x.status[i] == statusRunning || x.status[i] == statusRollingBack) {
+		line += "  " + progressBar(action.Progress, 20) + fmt.Sprintf(" %3d%% %s", action.Progress, action.Command)
+	}
+	if err := x.errs[i]; err != nil {
+		line += "  " + errorStyle.Render(err.Error())
+	}
+	return line
+}
+
+func progressBar(percent, width int) string {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	filled := percent * width / 100
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
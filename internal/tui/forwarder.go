@@ -0,0 +1,71 @@
+package tui
+
+import (
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// forwarder hands messages from other goroutines to the program without
+// blocking them. tea.Program.Send blocks until the program's event loop takes
+// the message, which would stall the executor and every logging goroutine
+// behind the UI, or forever before the program has started. Messages are
+// queued instead and sent in order by a goroutine of the forwarder's own.
+type forwarder struct {
+	mu     sync.Mutex
+	queue  []tea.Msg
+	closed bool
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+func newForwarder(send func(tea.Msg)) *forwarder {
+	f := &forwarder{wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go f.run(send)
+	return f
+}
+
+// post queues msg. Messages posted after stop are dropped.
+func (f *forwarder) post(msg tea.Msg) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	f.queue = append(f.queue, msg)
+	select {
+	case f.wake <- struct{}{}:
+	default:
+		// The sender is already woken up.
+	}
+}
+
+func (f *forwarder) run(send func(tea.Msg)) {
+	defer close(f.done)
+	for range f.wake {
+		for {
+			f.mu.Lock()
+			if len(f.queue) == 0 {
+				f.mu.Unlock()
+				break
+			}
+			msg := f.queue[0]
+			f.queue = f.queue[1:]
+			f.mu.Unlock()
+			send(msg)
+		}
+	}
+}
+
+// stop drops the queued messages and waits for the message being sent, which
+// returns once the program has exited.
+func (f *forwarder) stop() {
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		f.queue = nil
+		close(f.wake)
+	}
+	f.mu.Unlock()
+	<-f.done
+}
@@ -0,0 +1,59 @@
+package tui
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestForwarderDoesNotBlockBeforeTheReceiverRuns(t *testing.T) {
+	var mu sync.Mutex
+	var got []tea.Msg
+	start := make(chan struct{})
+	f := newForwarder(func(msg tea.Msg) {
+		<-start
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, msg)
+	})
+
+	posted := make(chan struct{})
+	go func() {
+		for i := range 100 {
+			f.post(i)
+		}
+		close(posted)
+	}()
+	select {
+	case <-posted:
+	case <-time.After(time.Second):
+		t.Fatal("post blocked while the receiver was not running")
+	}
+
+	close(start)
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n == 100 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	f.stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 100 {
+		t.Fatalf("delivered %d messages, want 100", len(got))
+	}
+	for i, msg := range got {
+		if msg != i {
+			t.Fatalf("message %d is %v; messages were reordered", i, msg)
+		}
+	}
+	f.post("after stop")
+}
@@ -0,0 +1,75 @@
+package tui
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// LogBuffer is the log writer to use for a logger while the TUI may be
+// running. Outside the TUI, writes pass straight through to the fallback
+// writer. While the TUI owns the terminal, complete lines are shown in the
+// execution view's log pane instead and written to the fallback once the
+// interface exits.
+type LogBuffer struct {
+	mu       sync.Mutex
+	fallback io.Writer
+	held     bytes.Buffer
+	partial  []byte
+	send     func(line string)
+}
+
+// NewLogBuffer returns a LogBuffer writing to fallback while detached.
+func NewLogBuffer(fallback io.Writer) *LogBuffer {
+	return &LogBuffer{fallback: fallback}
+}
+
+// Write implements io.Writer.
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.send == nil {
+		defer b.mu.Unlock()
+		return b.fallback.Write(p)
+	}
+
+	b.held.Write(p)
+	b.partial = append(b.partial, p...)
+	var lines []string
+	for {
+		i := bytes.IndexByte(b.partial, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, string(b.partial[:i]))
+		b.partial = b.partial[i+1:]
+	}
+	send := b.send
+	b.mu.Unlock()
+
+	// Lines are passed on without holding the lock, so a slow receiver
+	// does not stall other goroutines writing logs.
+	for _, line := range lines {
+		send(line)
+	}
+	return len(p), nil
+}
+
+// attach forwards subsequently written lines to send. send is called by the
+// writing goroutine and should not block.
+func (b *LogBuffer) attach(send func(line string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.send = send
+}
+
+// detach stops forwarding and writes everything held back while attached to
+// the fallback writer.
+func (b *LogBuffer) detach() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.send = nil
+	b.partial = nil
+	_, err := b.held.WriteTo(b.fallback)
+	return err
+}
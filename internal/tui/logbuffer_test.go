@@ -0,0 +1,66 @@
+package tui
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLogBufferPassesThroughWhileDetached(t *testing.T) {
+	var out bytes.Buffer
+	b := NewLogBuffer(&out)
+	b.Write([]byte("one\n"))
+	if got := out.String(); got != "one\n" {
+		t.Fatalf("fallback got %q, want %q", got, "one\n")
+	}
+}
+
+func TestLogBufferForwardsLinesAndReplaysOnDetach(t *testing.T) {
+	var out bytes.Buffer
+	b := NewLogBuffer(&out)
+
+	var lines []string
+	b.attach(func(line string) { lines = append(lines, line) })
+	b.Write([]byte("first\nsec"))
+	b.Write([]byte("ond\nthird"))
+	if want := []string{"first", "second"}; !slices.Equal(lines, want) {
+		t.Fatalf("forwarded %q, want %q", lines, want)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("fallback written while attached: %q", out.String())
+	}
+
+	if err := b.detach(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "first\nsecond\nthird"; got != want {
+		t.Fatalf("replayed %q, want %q", got, want)
+	}
+}
+
+func TestLogBufferSendsWithoutHoldingTheLock(t *testing.T) {
+	b := NewLogBuffer(&bytes.Buffer{})
+	release := make(chan struct{})
+	b.attach(func(line string) {
+		if line == "slow" {
+			<-release
+		}
+	})
+
+	go b.Write([]byte("slow\n"))
+	done := make(chan struct{})
+	go func() {
+		// Wait until the first write is blocked in send.
+		time.Sleep(10 * time.Millisecond)
+		b.Write([]byte("fast\n"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("write blocked behind a slow receiver")
+	}
+	close(release)
+}
@@ -0,0 +1,233 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+)
+
+var (
+	cursorStyle = lipgloss.NewStyle().Bold(true)
+	noopStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+)
+
+// review tracks which plan operations the user selected for apply and which
+// ones are expanded to show their details.
+type review struct {
+	groups   []reviewGroup
+	ops      []models.Operation
+	selected map[string]bool
+	expanded map[string]bool
+	cursor   int
+}
+
+type reviewGroup struct {
+	title string
+	count int
+}
+
+func newReview(plan *models.Plan) review {
+	r := review{selected: make(map[string]bool), expanded: make(map[string]bool)}
+	if plan == nil {
+		return r
+	}
+
+	for _, group := range []struct {
+		title string
+		ops   []models.Operation
+	}{
+		{"network", plan.NetworkOps},
+		{"ssh keys", plan.SSHKeyOps},
+		{"servers", plan.ServerOps},
+		{"firewalls", plan.FirewallOps},
+		{"dns", plan.DNSOps},
+	} {
+		r.groups = append(r.groups, reviewGroup{title: group.title, count: len(group.ops)})
+		r.ops = append(r.ops, group.ops...)
+	}
+	for _, op := range r.ops {
+		if op.Actionable() {
+			r.selected[op.Target] = true
+		}
+	}
+	return r
+}
+
+func (r *review) move(delta int) {
+	r.cursor += delta
+	if r.cursor >= len(r.ops) {
+		r.cursor = len(r.ops) - 1
+	}
+	if r.cursor < 0 {
+		r.cursor = 0
+	}
+}
+
+func (r *review) toggleExpanded() {
+	if len(r.ops) == 0 {
+		return
+	}
+	target := r.ops[r.cursor].Target
+	r.expanded[target] = !r.expanded[target]
+}
+
+// toggleSelected flips the selection of the operation under the cursor.
+// Deselecting an operation deselects everything that depends on it, and
+// selecting one selects everything it depends on, so the selection always
+// forms a consistent sub-plan. A status message describing the change is
+// returned.
+func (r *review) toggleSelected() string {
+	if len(r.ops) == 0 {
+		return ""
+	}
+	op := r.ops[r.cursor]
+	if !op.Actionable() {
+		return fmt.Sprintf("%s has nothing to apply", op.Target)
+	}
+
+	if r.selected[op.Target] {
+		affected := r.setSelected(tasks.Dependents(r.ops, op.Target), false)
+		r.selected[op.Target] = false
+		return fmt.Sprintf("deselected %s%s", op.Target, dependentsNote(affected, "dependent"))
+	}
+
+	affected := r.setSelected(tasks.Dependencies(r.ops, op.Target), true)
+	r.selected[op.Target] = true
+	return fmt.Sprintf("selected %s%s", op.Target, dependentsNote(affected, "dependency"))
+}
+
+// setSelected updates the selection of the given actionable targets and
+// returns the number of targets whose selection changed.
+func (r *review) setSelected(targets []string, selected bool) int {
+	actionableTargets := make(map[string]bool)
+	for _, op := range r.ops {
+		actionableTargets[op.Target] = op.Actionable()
+	}
+
+	changed := 0
+	for _, target := range targets {
+		if actionableTargets[target] && r.selected[target] != selected {
+			r.selected[target] = selected
+			changed++
+		}
+	}
+	return changed
+}
+
+func dependentsNote(count int, noun string) string {
+	switch count {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf(" and 1 %s", noun)
+	default:
+		if strings.HasSuffix(noun, "y") {
+			noun = strings.TrimSuffix(noun, "y") + "ie"
+		}
+		return fmt.Sprintf(" and %d %ss", count, noun)
+	}
+}
+
+func (r review) selectedCount() int {
+	count := 0
+	for _, op := range r.ops {
+		if op.Actionable() && r.selected[op.Target] {
+			count++
+		}
+	}
+	return count
+}
+
+// filter returns the sub-plan consisting of the selected operations and all
+// no-op operations.
+func (r review) filter(plan *models.Plan) *models.Plan {
+	return plan.Filter(func(op models.Operation) bool {
+		return !op.Actionable() || r.selected[op.Target]
+	})
+}
+
+// lines renders the review and reports the line the cursor is on.
+func (r review) lines() ([]string, int) {
+	if len(r.groups) == 0 {
+		return []string{"No plan has been generated."}, 0
+	}
+
+	lines := []string{r.summary()}
+	cursorLine := 0
+	index := 0
+	for _, group := range r.groups {
+		lines = append(lines, "", group.title)
+		if group.count == 0 {
+			lines = append(lines, indent("(none)"))
+		}
+		for _, op := range r.ops[index : index+group.count] {
+			if index == r.cursor {
+				cursorLine = len(lines)
+			}
+			lines = append(lines, r.renderOperation(op, index == r.cursor)...)
+			index++
+		}
+	}
+	return lines, cursorLine
+}
+
+func (r review) summary() string {
+	counts := make(map[string]int)
+	for _, op := range r.ops {
+		counts[op.Type]++
+	}
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	summary := fmt.Sprintf("%d operations", len(r.ops))
+	for _, t := range types {
+		summary += fmt.Sprintf(", %d %s", counts[t], t)
+	}
+	return summary + fmt.Sprintf(" — %d selected for apply", r.selectedCount())
+}
+
+func (r review) renderOperation(op models.Operation, current bool) []string {
+	marker := "  "
+	if current {
+		marker = "> "
+	}
+
+	checkbox := "[ ]"
+	switch {
+	case !op.Actionable():
+		checkbox = " - "
+	case r.selected[op.Target]:
+		checkbox = "[x]"
+	}
+
+	line := fmt.Sprintf("%s%s %-10s %s", marker, checkbox, op.Type, op.Target)
+	switch {
+	case current:
+		line = cursorStyle.Render(line)
+	case !op.Actionable():
+		line = noopStyle.Render(line)
+	}
+
+	lines := []string{line}
+	if !r.expanded[op.Target] {
+		return lines
+	}
+
+	detail := func(text string) string { return "        " + text }
+	lines = append(lines, detail(op.Details))
+	if len(op.DependsOn) > 0 {
+		lines = append(lines, detail("depends on: "+strings.Join(op.DependsOn, ", ")))
+	}
+	for _, change := range op.Changes {
+		lines = append(lines, detail(fmt.Sprintf("%-12s %s → %s", change.Field, orNone(change.Before), orNone(change.After))))
+	}
+	return lines
+}
@@ -0,0 +1,466 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"endnet-cli/internal/state"
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+)
+
+type tab int
+
+const (
+	tabConfig tab = iota
+	tabSpec
+	tabState
+	tabPlan
+	tabExecution
+	tabCount
+)
+
+var tabTitles = [tabCount]string{"Config", "Desired Spec", "Remote State", "Plan", "Execution"}
+
+var (
+	activeTabStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("0")).Background(lipgloss.Color("12")).Padding(0, 1)
+	inactiveTabStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("7")).Padding(0, 1)
+	helpStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	errorStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	promptStyle      = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("11"))
+)
+
+// refreshedMsg carries the result of re-running the retriever and planner.
+type refreshedMsg struct {
+	state *models.RemoteState
+	plan  *models.Plan
+	err   error
+}
+
+// appliedMsg carries the result of executing the selected operations.
+type appliedMsg struct {
+	result *models.ExecutionResult
+	err    error
+}
+
+// interruptMsg is sent when the Application's context is cancelled.
+type interruptMsg struct{}
+
+// screen is the Bubble Tea model backing the Application.
+type screen struct {
+	// ctx is the context of the Application's Run. cancel aborts the
+	// refresh or apply in progress while busy.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	model     Model
+	retriever state.Retriever
+	planner   tasks.Planner
+	executor  tasks.Executor
+
+	active     tab
+	offsets    [tabCount]int
+	width      int
+	height     int
+	review     review
+	execution  execution
+	confirming bool
+	busy       bool
+	// quitting is set when the user quit while busy; the screen quits
+	// once the aborted refresh or apply has returned.
+	quitting bool
+	applied  string
+	status   string
+	err      error
+}
+
+func newScreen(ctx context.Context, model Model, retriever state.Retriever, planner tasks.Planner, executor tasks.Executor) screen {
+	return screen{
+		ctx:       ctx,
+		model:     model,
+		retriever: retriever,
+		planner:   planner,
+		executor:  executor,
+		review:    newReview(model.Plan),
+	}
+}
+
+// Init implements tea.Model.
+func (s screen) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model.
+func (s screen) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		s.width, s.height = msg.Width, msg.Height
+		s.clampOffset()
+	case refreshedMsg:
+		s.idle()
+		if s.quitting {
+			return s, tea.Quit
+		}
+		if msg.err != nil {
+			s.err = msg.err
+			s.status = ""
+			break
+		}
+		s.err = nil
+		s.model.State = msg.state
+		s.model.Plan = msg.plan
+		s.review = newReview(msg.plan)
+		s.status = fmt.Sprintf("refreshed at %s", msg.state.RetrievedAt.Format("15:04:05"))
+		if s.applied != "" {
+			s.status = s.applied + "; " + s.status
+			s.applied = ""
+		}
+		s.clampOffset()
+	case eventMsg:
+		s.execution.record(tasks.Event(msg))
+	case logMsg:
+		s.execution.appendLog(string(msg))
+	case tickMsg:
+		if s.execution.running {
+			return s, tick()
+		}
+	case appliedMsg:
+		s.idle()
+		s.execution.running = false
+		if s.quitting {
+			return s, tea.Quit
+		}
+		if msg.err != nil {
+			s.err = fmt.Errorf("apply: %w", msg.err)
+			s.status = ""
+			break
+		}
+		s.err = nil
+		s.applied = fmt.Sprintf("applied %d operations in %s", len(msg.result.AppliedOperations), msg.result.CompletedAt.Sub(msg.result.StartedAt).Round(time.Millisecond))
+		s.status = s.applied + ", refreshing..."
+		cmd := s.refresh()
+		return s, cmd
+	case interruptMsg:
+		return s.quit()
+	case tea.KeyMsg:
+		if s.quitting {
+			return s, nil
+		}
+		if s.confirming {
+			return s.handleConfirm(msg)
+		}
+		return s.handleKey(msg)
+	}
+	return s, nil
+}
+
+func (s screen) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if s.active == tabPlan && s.handleReviewKey(msg) {
+		s.followCursor()
+		return s, nil
+	}
+	if s.active == tabExecution && s.handleExecutionKey(msg) {
+		return s, nil
+	}
+
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return s.quit()
+	case "tab", "right", "l":
+		s.active = (s.active + 1) % tabCount
+	case "shift+tab", "left", "h":
+		s.active = (s.active + tabCount - 1) % tabCount
+	case "1", "2", "3", "4", "5":
+		s.active = tab(msg.String()[0] - '1')
+	case "down", "j":
+		s.offsets[s.active]++
+	case "up", "k":
+		s.offsets[s.active]--
+	case "pgdown":
+		s.offsets[s.active] += s.bodyHeight()
+	case "pgup":
+		s.offsets[s.active] -= s.bodyHeight()
+	case "home", "g":
+		s.offsets[s.active] = 0
+	case "end", "G":
+		s.offsets[s.active] = len(s.lines())
+	case "r":
+		if s.busy {
+			return s, nil
+		}
+		s.status = "refreshing..."
+		cmd := s.refresh()
+		return s, cmd
+	}
+	s.clampOffset()
+	return s, nil
+}
+
+// handleReviewKey processes plan review keys and reports whether the key was
+// consumed.
+func (s *screen) handleReviewKey(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "down", "j":
+		s.review.move(1)
+	case "up", "k":
+		s.review.move(-1)
+	case "pgdown":
+		s.review.move(s.bodyHeight() / 2)
+	case "pgup":
+		s.review.move(-s.bodyHeight() / 2)
+	case "home", "g":
+		s.review.move(-len(s.review.ops))
+	case "end", "G":
+		s.review.move(len(s.review.ops))
+	case "enter":
+		s.review.toggleExpanded()
+	case " ":
+		s.status = s.review.toggleSelected()
+	case "a":
+		switch {
+		case s.busy:
+			s.status = "an operation is already in progress"
+		case s.review.selectedCount() == 0:
+			s.status = "no operations selected"
+		default:
+			s.confirming = true
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// handleExecutionKey scrolls the log pane of the execution view and reports
+// whether the key was consumed.
+func (s *screen) handleExecutionKey(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "up", "k":
+		s.execution.scrollLog(1)
+	case "down", "j":
+		s.execution.scrollLog(-1)
+	case "pgup":
+		s.execution.scrollLog(s.bodyHeight() / 2)
+	case "pgdown":
+		s.execution.scrollLog(-s.bodyHeight() / 2)
+	case "home", "g":
+		s.execution.scrollLog(len(s.execution.logs))
+	case "end", "G":
+		s.execution.scrollLog(-len(s.execution.logs))
+	default:
+		return false
+	}
+	return true
+}
+
+func (s screen) handleConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y":
+		plan := s.review.filter(s.model.Plan)
+		s.confirming = false
+		s.status = fmt.Sprintf("applying %d operations...", s.review.selectedCount())
+		logs := s.execution.logs
+		s.execution = newExecution(plan)
+		s.execution.logs = logs
+		s.active = tabExecution
+		cmd := s.apply(plan)
+		return s, tea.Batch(cmd, tick())
+	case "n", "N", "esc", "q":
+		s.confirming = false
+		s.status = "apply cancelled"
+	case "ctrl+c":
+		s.confirming = false
+		return s.quit()
+	}
+	return s, nil
+}
+
+// quit closes the interface. While a refresh or apply is in progress it is
+// cancelled first and the interface closes once it has returned, so no
+// operation is abandoned halfway and the journal is complete.
+func (s screen) quit() (tea.Model, tea.Cmd) {
+	if !s.busy {
+		return s, tea.Quit
+	}
+	if !s.quitting {
+		s.quitting = true
+		s.cancel()
+		s.err = nil
+		s.status = "cancelling, waiting for running operations to stop..."
+	}
+	return s, nil
+}
+
+// start marks the screen busy with a command running under a context of its
+// own and returns that context.
+func (s *screen) start() context.Context {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.busy = true
+	s.cancel = cancel
+	return ctx
+}
+
+// idle marks the running command as finished.
+func (s *screen) idle() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.busy = false
+	s.cancel = nil
+}
+
+// refresh re-runs the retriever and planner for the current spec.
+func (s *screen) refresh() tea.Cmd {
+	ctx, spec := s.start(), s.model.Spec
+	retriever, planner := s.retriever, s.planner
+	return func() tea.Msg {
+		current, err := retriever.Current(ctx, spec)
+		if err != nil {
+			return refreshedMsg{err: fmt.Errorf("obtain current state: %w", err)}
+		}
+		plan, err := planner.Plan(ctx, spec, current)
+		if err != nil {
+			return refreshedMsg{err: fmt.Errorf("generate plan: %w", err)}
+		}
+		return refreshedMsg{state: current, plan: plan}
+	}
+}
+
+// apply hands the reviewed plan to the executor.
+func (s *screen) apply(plan *models.Plan) tea.Cmd {
+	ctx, executor := s.start(), s.executor
+	return func() tea.Msg {
+		result, err := executor.Execute(ctx, plan)
+		return appliedMsg{result: result, err: err}
+	}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(200*time.Millisecond, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
+}
+
+// View implements tea.Model.
+func (s screen) View() string {
+	var b strings.Builder
+
+	tabs := make([]string, tabCount)
+	for i, title := range tabTitles {
+		label := fmt.Sprintf("%d %s", i+1, title)
+		if tab(i) == s.active {
+			tabs[i] = activeTabStyle.Render(label)
+		} else {
+			tabs[i] = inactiveTabStyle.Render(label)
+		}
+	}
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, tabs...))
+	b.WriteString("\n\n")
+
+	lines := s.lines()
+	height := s.bodyHeight()
+	start := s.offsets[s.active]
+	end := start + height
+	if end > len(lines) {
+		end = len(lines)
+	}
+	for _, line := range lines[start:end] {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	for i := end - start; i < height; i++ {
+		b.WriteString("\n")
+	}
+
+	b.WriteString(s.footer())
+	return b.String()
+}
+
+func (s screen) footer() string {
+	help := "tab/←→ switch view • ↑↓ scroll • r refresh • q quit"
+	switch s.active {
+	case tabPlan:
+		help = "tab/←→ switch view • ↑↓ move • enter details • space toggle • a apply • r refresh • q quit"
+	case tabExecution:
+		help = "tab/←→ switch view • ↑↓ scroll log • G follow log • r refresh • q quit"
+	}
+	help = helpStyle.Render(help)
+
+	switch {
+	case s.confirming:
+		return promptStyle.Render(fmt.Sprintf("Apply %d selected operations? (y/n)", s.review.selectedCount())) + "\n" + help
+	case s.err != nil:
+		return errorStyle.Render("error: "+s.err.Error()) + "\n" + help
+	case s.status != "":
+		return s.status + "\n" + help
+	default:
+		return "\n" + help
+	}
+}
+
+func (s screen) lines() []string {
+	switch s.active {
+	case tabConfig:
+		return renderConfig(s.model.Config)
+	case tabSpec:
+		return renderSpec(s.model.Spec)
+	case tabState:
+		return renderState(s.model.State)
+	case tabExecution:
+		return s.execution.render(s.bodyHeight(), time.Now())
+	default:
+		lines, _ := s.review.lines()
+		return lines
+	}
+}
+
+// bodyHeight is the number of content lines that fit between the tab bar and
+// the footer.
+func (s screen) bodyHeight() int {
+	if s.height == 0 {
+		return 20
+	}
+	if h := s.height - 5; h > 1 {
+		return h
+	}
+	return 1
+}
+
+// followCursor scrolls the plan view so the review cursor stays visible.
+func (s *screen) followCursor() {
+	lines, cursor := s.review.lines()
+	offset := &s.offsets[tabPlan]
+	height := s.bodyHeight()
+	if cursor < *offset {
+		*offset = cursor
+	}
+	// Keep the expanded details of the current operation in view as well.
+	last := cursor
+	for last+1 < len(lines) && strings.HasPrefix(lines[last+1], "        ") {
+		last++
+	}
+	if last >= *offset+height {
+		*offset = last - height + 1
+	}
+	if cursor < *offset {
+		*offset = cursor
+	}
+	s.clampOffset()
+}
+
+func (s *screen) clampOffset() {
+	maxOffset := len(s.lines()) - s.bodyHeight()
+	if maxOffset < 0 {
+		maxOffset = 0
+	}
+	if s.offsets[s.active] > maxOffset {
+		s.offsets[s.active] = maxOffset
+	}
+	if s.offsets[s.active] < 0 {
+		s.offsets[s.active] = 0
+	}
+}
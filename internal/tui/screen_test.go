@@ -0,0 +1,92 @@
+package tui
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/internal/tasks"
+	"endnet-cli/pkg/models"
+)
+
+// blockingExecutor runs until its context is cancelled.
+type blockingExecutor struct{}
+
+func (blockingExecutor) Execute(ctx context.Context, plan *models.Plan) (*models.ExecutionResult, error) {
+	<-ctx.Done()
+	return &models.ExecutionResult{}, ctx.Err()
+}
+
+func (blockingExecutor) Observe(tasks.Observer) func() { return func() {} }
+
+func isQuit(cmd tea.Cmd) bool {
+	if cmd == nil {
+		return false
+	}
+	_, ok := cmd().(tea.QuitMsg)
+	return ok
+}
+
+func TestQuitWhileApplyingCancelsAndWaits(t *testing.T) {
+	plan := &models.Plan{NetworkOps: []models.Operation{{Type: "create", Target: "network:a"}}}
+	s := newScreen(context.Background(), Model{Config: config.DefaultConfig(), Plan: plan}, nil, nil, blockingExecutor{})
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"q", "q"},
+		{"ctrl+c", "ctrl+c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := s
+			s.active = tabPlan
+			m, _ := s.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+			m, cmd := m.(screen).Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+			s = m.(screen)
+			if !s.busy {
+				t.Fatal("apply did not start")
+			}
+			// The first command of the batch is the apply.
+			apply := cmd().(tea.BatchMsg)[0]
+			applied := make(chan tea.Msg, 1)
+			go func() { applied <- apply() }()
+
+			key := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(tt.key)}
+			if tt.key == "ctrl+c" {
+				key = tea.KeyMsg{Type: tea.KeyCtrlC}
+			}
+			m, cmd = s.Update(key)
+			s = m.(screen)
+			if isQuit(cmd) {
+				t.Fatal("quit while the apply was running")
+			}
+			if !s.quitting {
+				t.Fatal("screen is not quitting")
+			}
+
+			var msg tea.Msg
+			select {
+			case msg = <-applied:
+			case <-time.After(time.Second):
+				t.Fatal("apply was not cancelled")
+			}
+			_, cmd = s.Update(msg)
+			if !isQuit(cmd) {
+				t.Fatal("screen did not quit once the apply returned")
+			}
+		})
+	}
+}
+
+func TestQuitWhileIdle(t *testing.T) {
+	s := newScreen(context.Background(), Model{Config: config.DefaultConfig()}, nil, nil, blockingExecutor{})
+	_, cmd := s.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	if !isQuit(cmd) {
+		t.Fatal("q did not quit an idle screen")
+	}
+}
@@ -1,15 +1,23 @@
 package tui
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
 
 	"endnet-cli/internal/config"
+	"endnet-cli/internal/state"
+	"endnet-cli/internal/tasks"
 	"endnet-cli/pkg/models"
 )
 
 // Runner exposes the ability to drive an interactive terminal interface.
+// Cancelling the context closes the interface and aborts the state refreshes
+// and executions it started.
 type Runner interface {
-	Run(cfg *config.Config, spec models.EndnetSpec, state *models.RemoteState, plan *models.Plan) error
+	Run(ctx context.Context, cfg *config.Config, spec models.EndnetSpec, state *models.RemoteState, plan *models.Plan) error
 }
 
 // Model encapsulates the data required by the TUI layer.
@@ -20,30 +28,68 @@ type Model struct {
 	Plan   *models.Plan
 }
 
-// Application is a stub implementation of the TUI runner.
-type Application struct{}
-
-// NewRunner constructs a TUI runner instance.
-func NewRunner() Runner {
-	return &Application{}
+// Application runs the full-screen Bubble Tea interface. The retriever and
+// planner are used to refresh the remote state and plan on demand, and the
+// executor applies the operations selected during plan review. Log output
+// written to logs is shown in the execution view.
+type Application struct {
+	retriever state.Retriever
+	planner   tasks.Planner
+	executor  tasks.Executor
+	logs      *LogBuffer
 }
 
-// Run currently prints a short summary until the real TUI is implemented.
-func (a *Application) Run(cfg *config.Config, spec models.EndnetSpec, state *models.RemoteState, plan *models.Plan) error {
-	model := Model{Config: cfg, Spec: spec, State: state, Plan: plan}
-	fmt.Printf("Launching TUI for project %s at %s\n", model.Config.Project, model.Config.Location)
-	fmt.Printf("Desired network: %s (%s)\n", model.Spec.Network.Name, model.Spec.Network.CIDR)
-	fmt.Printf("Planned operations: %d\n", len(flattenOperations(plan)))
-	return nil
+// NewRunner constructs a TUI runner instance. logs should be the writer the
+// executor's logger writes to; when nil, log output is not shown in the TUI.
+func NewRunner(retriever state.Retriever, planner tasks.Planner, executor tasks.Executor, logs *LogBuffer) Runner {
+	if retriever == nil {
+		retriever = state.NewRetriever()
+	}
+	if planner == nil {
+		planner = tasks.NewPlanner()
+	}
+	if executor == nil {
+		executor = tasks.NewExecutor(nil)
+	}
+	if logs == nil {
+		logs = NewLogBuffer(os.Stderr)
+	}
+	return &Application{retriever: retriever, planner: planner, executor: executor, logs: logs}
 }
 
-func flattenOperations(plan *models.Plan) []models.Operation {
-	if plan == nil {
-		return nil
+// Run starts the interactive interface and blocks until the user quits.
+func (a *Application) Run(ctx context.Context, cfg *config.Config, spec models.EndnetSpec, state *models.RemoteState, plan *models.Plan) error {
+	if cfg == nil {
+		return errors.New("config must not be nil")
 	}
-	var ops []models.Operation
-	for _, group := range [][]models.Operation{plan.NetworkOps, plan.ServerOps, plan.FirewallOps, plan.DNSOps} {
-		ops = append(ops, group...)
-	}
-	return ops
+
+	model := Model{Config: cfg, Spec: spec, State: state, Plan: plan}
+	program := tea.NewProgram(newScreen(ctx, model, a.retriever, a.planner, a.executor), tea.WithAltScreen())
+	messages := newForwarder(program.Send)
+	defer messages.stop()
+
+	// The screen cancels what it is running and closes once that returned,
+	// rather than being killed with an execution still in progress.
+	stopInterrupt := context.AfterFunc(ctx, func() {
+		messages.post(interruptMsg{})
+	})
+	defer stopInterrupt()
+
+	removeObserver := a.executor.Observe(func(e tasks.Event) {
+		messages.post(eventMsg(e))
+	})
+	defer removeObserver()
+
+	// Log output would corrupt the full-screen display. It is shown in the
+	// execution view's log pane instead and replayed once the interface has
+	// been closed.
+	a.logs.attach(func(line string) {
+		messages.post(logMsg(line))
+	})
+	defer func() {
+		_ = a.logs.detach()
+	}()
+
+	_, err := program.Run()
+	return err
 }
@@ -0,0 +1,198 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+
+	"endnet-cli/internal/config"
+	"endnet-cli/pkg/models"
+)
+
+func renderConfig(cfg *config.Config) []string {
+	if cfg == nil {
+		return []string{"No configuration loaded."}
+	}
+
+	lines := []string{field("source", cfg.Source)}
+	if cfg.Environment != "" {
+		lines = append(lines,
+			field("environment", cfg.Environment),
+			field("overlay", cfg.Overlay),
+		)
+	}
+	lines = append(lines,
+		field("loaded at", cfg.LoadedAt.Format("2006-01-02 15:04:05")),
+		"",
+		field("project", cfg.Project),
+		field("location", cfg.Location),
+		"",
+		"network",
+		indent(field("name", cfg.Network.Name)),
+		indent(field("cidr", cfg.Network.CIDR)),
+		indent(field("subnetCidr", cfg.Network.SubnetCIDR)),
+		indent(field("gatewayIp", cfg.Network.GatewayIP)),
+		"",
+		"roles",
+	)
+	for _, role := range []struct {
+		name string
+		node config.NodeConfig
+	}{{"edge", cfg.Roles.Edge}, {"wg", cfg.Roles.WG}, {"forge", cfg.Roles.Forge}} {
+		lines = append(lines,
+			indent(role.name),
+			indent(indent(field("name", role.node.Name))),
+			indent(indent(field("type", role.node.Type))),
+			indent(indent(field("image", role.node.Image))),
+			indent(indent(field("privateIp", role.node.PrivateIP))),
+			indent(indent(field("publicIp", fmt.Sprint(role.node.HasPublicIP)))),
+		)
+	}
+	lines = append(lines,
+		"",
+		"dns",
+		indent(field("rootDomain", cfg.DNS.RootDomain)),
+		indent(field("forgejoHost", cfg.DNS.ForgejoHost)),
+		"",
+		"hetzner",
+		indent(field("apiToken", secretStatus(cfg.Hetzner.APIToken))),
+		indent(field("sshKeyName", cfg.Hetzner.SSHKeyName)),
+		indent(field("sshPublicKeyPath", cfg.Hetzner.SSHPublicKeyPath)),
+		"",
+		"ipv64",
+		indent(field("apiKey", secretStatus(cfg.IPv64.APIKey))),
+		indent(field("dynDnsToken", secretStatus(cfg.IPv64.DynDNSToken))),
+	)
+	return lines
+}
+
+func renderSpec(spec models.EndnetSpec) []string {
+	lines := []string{
+		field("project", spec.Project),
+		field("location", spec.Location),
+		"",
+		fmt.Sprintf("network %s", spec.Network.Name),
+		indent(field("cidr", spec.Network.CIDR)),
+		indent(field("subnet", spec.Network.SubnetCIDR)),
+		indent(field("gateway", spec.Network.GatewayIP)),
+		"",
+		"servers",
+	}
+	nodes := []models.NodeSpec{spec.Roles.Edge, spec.Roles.WG, spec.Roles.Forge}
+	extras := make([]string, 0, len(spec.Roles.Extras))
+	for name := range spec.Roles.Extras {
+		extras = append(extras, name)
+	}
+	sort.Strings(extras)
+	for _, name := range extras {
+		nodes = append(nodes, spec.Roles.Extras[name])
+	}
+	for _, node := range nodes {
+		if node.Name == "" {
+			continue
+		}
+		public := ""
+		if node.HasPublicIP {
+			public = ", public IP"
+		}
+		lines = append(lines, indent(fmt.Sprintf("%-20s %s %s %s%s", node.Name, node.Type, node.Image, node.PrivateIP, public)))
+	}
+	lines = append(lines,
+		"",
+		"dns",
+		indent(field("rootDomain", spec.DNS.RootDomain)),
+		indent(field("forgejoHost", spec.DNS.ForgejoHost)),
+		"",
+		fmt.Sprintf("ssh key %s", spec.SSHKey.Name),
+		indent(field("publicKeyPath", spec.SSHKey.PublicKeyPath)),
+		indent(field("fingerprint", orNone(spec.SSHKey.Fingerprint))),
+	)
+	return lines
+}
+
+func renderState(state *models.RemoteState) []string {
+	if state == nil {
+		return []string{"Remote state has not been retrieved."}
+	}
+
+	lines := []string{field("retrieved at", state.RetrievedAt.Format("2006-01-02 15:04:05")), "", "hetzner networks"}
+	for _, n := range state.Hetzner.Networks {
+		lines = append(lines, indent(fmt.Sprintf("#%d %s %s", n.ID, n.Name, n.CIDR)))
+	}
+	lines = appendNone(lines, len(state.Hetzner.Networks))
+
+	lines = append(lines, "", "hetzner routes")
+	for _, r := range state.Hetzner.Routes {
+		lines = append(lines, indent(fmt.Sprintf("network #%d %s via %s", r.NetworkID, r.DestinationCIDR, r.GatewayIP)))
+	}
+	lines = appendNone(lines, len(state.Hetzner.Routes))
+
+	lines = append(lines, "", "hetzner servers")
+	for _, s := range state.Hetzner.Servers {
+		lines = append(lines, indent(fmt.Sprintf("#%d %-20s %s %s private %s public %s", s.ID, s.Name, s.Type, s.Image, orNone(s.PrivateIP), orNone(s.PublicIP))))
+	}
+	lines = appendNone(lines, len(state.Hetzner.Servers))
+
+	lines = append(lines, "", "hetzner firewalls")
+	for _, f := range state.Hetzner.Firewalls {
+		lines = append(lines, indent(fmt.Sprintf("#%d %s (%d rules)", f.ID, f.Name, len(f.Rules))))
+		for _, rule := range f.Rules {
+			lines = append(lines, indent(indent(fmt.Sprintf("%s %s %s %s -> %s", rule.Direction, rule.Protocol, rule.Port, rule.Source, rule.Target))))
+		}
+	}
+	lines = appendNone(lines, len(state.Hetzner.Firewalls))
+
+	lines = append(lines, "", "hetzner ssh keys")
+	for _, k := range state.Hetzner.SSHKeys {
+		lines = append(lines, indent(fmt.Sprintf("#%d %s %s", k.ID, k.Name, k.Fingerprint)))
+	}
+	lines = appendNone(lines, len(state.Hetzner.SSHKeys))
+
+	lines = append(lines, "", "ipv64 domains")
+	domains := make([]string, 0, len(state.IPv64.Domains))
+	for name := range state.IPv64.Domains {
+		domains = append(domains, name)
+	}
+	sort.Strings(domains)
+	for _, name := range domains {
+		lines = append(lines, indent(name))
+		for _, r := range state.IPv64.Domains[name].Records {
+			lines = append(lines, indent(indent(fmt.Sprintf("%-5s %s -> %s (ttl %d)", r.Type, r.Name, r.Value, r.TTL))))
+		}
+	}
+	lines = appendNone(lines, len(domains))
+
+	return lines
+}
+
+func field(name, value string) string {
+	return fmt.Sprintf("%-18s %s", name, value)
+}
+
+func indent(line string) string {
+	return "  " + line
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func appendNone(lines []string, count int) []string {
+	if count == 0 {
+		return append(lines, indent("(none)"))
+	}
+	return lines
+}
+
+func secretStatus(secret config.Secret) string {
+	switch {
+	case !secret.IsSet():
+		return "(unset)"
+	case secret.IsReference():
+		return secret.Reference()
+	default:
+		return "(set)"
+	}
+}
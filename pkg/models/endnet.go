@@ -2,6 +2,10 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -12,6 +16,8 @@ type EndnetSpec struct {
 	Network  NetworkSpec
 	Roles    RolesSpec
 	DNS      DNSSpec
+	SSHKey   SSHKeySpec
+	Firewall FirewallSpec
 }
 
 // NetworkSpec contains the required network configuration.
@@ -45,6 +51,23 @@ type DNSSpec struct {
 	ForgejoHost string
 }
 
+// FirewallSpec describes the firewall applied to the edge server. No
+// firewall is managed when Name is empty.
+type FirewallSpec struct {
+	Name  string
+	Rules []FirewallRule
+}
+
+// SSHKeySpec describes the SSH key that must exist in the Hetzner project and
+// be attached to every server. PublicKey and Fingerprint are empty when the
+// key has not been generated locally yet.
+type SSHKeySpec struct {
+	Name          string
+	PublicKeyPath string
+	PublicKey     string
+	Fingerprint   string
+}
+
 // RemoteState captures the current view of the providers.
 type RemoteState struct {
 	Hetzner     HetznerState
@@ -58,6 +81,7 @@ type HetznerState struct {
 	Routes    []Route
 	Servers   []Server
 	Firewalls []Firewall
+	SSHKeys   []SSHKey
 }
 
 // Network represents a Hetzner network.
@@ -74,24 +98,43 @@ type Route struct {
 	GatewayIP       string
 }
 
-// Server describes a provisioned Hetzner server.
+// Server describes a provisioned Hetzner server. Status is the power
+// status reported by Hetzner, e.g. "running" or "off".
 type Server struct {
 	ID        int
 	Name      string
 	Type      string
 	Image     string
+	Status    string
 	PrivateIP string
 	PublicIP  string
 }
 
-// Firewall captures firewall configuration details.
+// Hetzner server statuses.
+const (
+	ServerRunning = "running"
+	ServerOff     = "off"
+)
+
+// SSHKey represents an SSH key stored in the Hetzner project.
+type SSHKey struct {
+	ID          int
+	Name        string
+	Fingerprint string
+	PublicKey   string
+}
+
+// Firewall captures firewall configuration details. AppliedTo holds the IDs
+// of the servers the firewall is applied to.
 type Firewall struct {
-	ID    int
-	Name  string
-	Rules []FirewallRule
+	ID        int
+	Name      string
+	Rules     []FirewallRule
+	AppliedTo []int
 }
 
-// FirewallRule describes a single firewall rule.
+// FirewallRule describes a single firewall rule. Source and Target are
+// comma-separated CIDRs; Port is empty for protocols without ports.
 type FirewallRule struct {
 	Direction string
 	Protocol  string
@@ -100,6 +143,77 @@ type FirewallRule struct {
 	Target    string
 }
 
+// String renders the rule as e.g. "in tcp 22 from 0.0.0.0/0,::/0", with the
+// CIDRs sorted so that equal rules render equally.
+func (r FirewallRule) String() string {
+	parts := []string{r.Direction, r.Protocol}
+	if r.Port != "" {
+		parts = append(parts, r.Port)
+	}
+	if r.Source != "" {
+		parts = append(parts, "from", sortedCIDRs(r.Source))
+	}
+	if r.Target != "" {
+		parts = append(parts, "to", sortedCIDRs(r.Target))
+	}
+	return strings.Join(parts, " ")
+}
+
+// FormatFirewallRules renders rules sorted and separated by "; ", so that two
+// rule sets render equally exactly when they contain the same rules.
+func FormatFirewallRules(rules []FirewallRule) string {
+	lines := make([]string, len(rules))
+	for i, r := range rules {
+		lines[i] = r.String()
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "; ")
+}
+
+// ParseFirewallRules parses rules rendered by FormatFirewallRules.
+func ParseFirewallRules(s string) ([]FirewallRule, error) {
+	var rules []FirewallRule
+	for _, text := range strings.Split(s, ";") {
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("firewall rule %q has no protocol", strings.TrimSpace(text))
+		}
+		rule := FirewallRule{Direction: fields[0], Protocol: fields[1]}
+		rest := fields[2:]
+		if len(rest) > 0 && rest[0] != "from" && rest[0] != "to" {
+			rule.Port, rest = rest[0], rest[1:]
+		}
+		for len(rest) > 0 {
+			if len(rest) < 2 {
+				return nil, fmt.Errorf("firewall rule %q: %s without CIDRs", strings.TrimSpace(text), rest[0])
+			}
+			switch rest[0] {
+			case "from":
+				rule.Source = rest[1]
+			case "to":
+				rule.Target = rest[1]
+			default:
+				return nil, fmt.Errorf("firewall rule %q: unexpected %q", strings.TrimSpace(text), rest[0])
+			}
+			rest = rest[2:]
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func sortedCIDRs(s string) string {
+	cidrs := strings.Split(s, ",")
+	for i := range cidrs {
+		cidrs[i] = strings.TrimSpace(cidrs[i])
+	}
+	sort.Strings(cidrs)
+	return strings.Join(cidrs, ",")
+}
+
 // IPv64State holds DNS domain information.
 type IPv64State struct {
 	Domains map[string]Domain
@@ -111,8 +225,10 @@ type Domain struct {
 	Records []DNSRecord
 }
 
-// DNSRecord represents a DNS record entry.
+// DNSRecord represents a DNS record entry. Name is the fully qualified
+// record name and ID the provider's record ID.
 type DNSRecord struct {
+	ID    int
 	Type  string
 	Name  string
 	Value string
@@ -121,27 +237,277 @@ type DNSRecord struct {
 
 // Plan summarizes the operations necessary to reach the desired state.
 type Plan struct {
-	NetworkOps  []Operation
-	ServerOps   []Operation
-	FirewallOps []Operation
-	DNSOps      []Operation
+	NetworkOps  []Operation `json:"networkOps"`
+	SSHKeyOps   []Operation `json:"sshKeyOps"`
+	ServerOps   []Operation `json:"serverOps"`
+	FirewallOps []Operation `json:"firewallOps"`
+	DNSOps      []Operation `json:"dnsOps"`
+}
+
+// PlanSummary counts the operations of a plan.
+type PlanSummary struct {
+	// Total counts all operations, Changes those that are Actionable.
+	Total   int `json:"total"`
+	Changes int `json:"changes"`
+	// ByType counts the operations per type, e.g. "create" or "noop".
+	ByType map[string]int `json:"byType"`
 }
 
-// Operation is a single action in a plan.
+// PlanFormatVersion is the version of PlanDocument. It only changes when a
+// field is removed or changes its meaning; new fields may be added at any time.
+const PlanFormatVersion = 1
+
+// PlanDocument is the JSON document printed by endnetctl plan --output json.
+// Operations are listed in execution order.
+type PlanDocument struct {
+	FormatVersion int         `json:"formatVersion"`
+	Project       string      `json:"project"`
+	Environment   string      `json:"environment,omitempty"`
+	GeneratedAt   time.Time   `json:"generatedAt"`
+	Summary       PlanSummary `json:"summary"`
+	Operations    []Operation `json:"operations"`
+}
+
+// Summary counts the plan's operations by type.
+func (p *Plan) Summary() PlanSummary {
+	s := PlanSummary{ByType: make(map[string]int)}
+	for _, op := range p.Operations() {
+		s.Total++
+		s.ByType[op.Type]++
+		if op.Actionable() {
+			s.Changes++
+		}
+	}
+	return s
+}
+
+// Operations returns all plan operations in execution order.
+func (p *Plan) Operations() []Operation {
+	if p == nil {
+		return nil
+	}
+	var ops []Operation
+	for _, group := range [][]Operation{p.NetworkOps, p.SSHKeyOps, p.ServerOps, p.FirewallOps, p.DNSOps} {
+		ops = append(ops, group...)
+	}
+	return ops
+}
+
+// Filter returns a copy of the plan containing only the operations for which
+// keep returns true. The grouping of operations is preserved.
+func (p *Plan) Filter(keep func(Operation) bool) *Plan {
+	if p == nil {
+		return nil
+	}
+	filter := func(ops []Operation) []Operation {
+		var kept []Operation
+		for _, op := range ops {
+			if keep(op) {
+				kept = append(kept, op)
+			}
+		}
+		return kept
+	}
+	return &Plan{
+		NetworkOps:  filter(p.NetworkOps),
+		SSHKeyOps:   filter(p.SSHKeyOps),
+		ServerOps:   filter(p.ServerOps),
+		FirewallOps: filter(p.FirewallOps),
+		DNSOps:      filter(p.DNSOps),
+	}
+}
+
+// Operation is a single action in a plan. Target identifies the resource and
+// is referenced by the DependsOn lists of other operations.
 type Operation struct {
-	Type    string
-	Target  string
-	Details string
+	Type      string   `json:"type"`
+	Target    string   `json:"target"`
+	Details   string   `json:"details"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+	Changes   []Change `json:"changes,omitempty"`
+}
+
+// Actionable reports whether applying the operation changes anything, which
+// is the case for every type except "noop".
+func (o Operation) Actionable() bool {
+	return o.Type != "noop"
+}
+
+// Kind returns the resource kind encoded in the target, such as "server" for
+// "server:endnet-edge-1".
+func (o Operation) Kind() string {
+	kind, _, _ := strings.Cut(o.Target, ":")
+	return kind
+}
+
+// Change describes how a single attribute of the target differs between the
+// observed and the desired state. Before is empty for new resources.
+type Change struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after"`
 }
 
-// ExecutionResult captures the outcome of applying a plan.
+// Action describes an asynchronous provider action such as a Hetzner server
+// creation. Progress is reported in percent.
+type Action struct {
+	ID       int
+	Command  string
+	Status   string
+	Progress int
+	Error    string
+}
+
+// Action statuses reported by the Hetzner API.
+const (
+	ActionRunning = "running"
+	ActionSuccess = "success"
+	ActionError   = "error"
+)
+
+// ExecutionResult captures the outcome of applying a plan. Operations holds
+// the outcome of every plan operation in plan order. Retries lists every
+// failed attempt that was retried, showing which calls were flaky. Rollback is
+// set when a failed execution was rolled back.
 type ExecutionResult struct {
 	ChangesApplied    bool
 	AppliedOperations []Operation
+	Operations        []OperationResult
+	Retries           []Retry
+	Rollback          *RollbackReport
 	StartedAt         time.Time
 	CompletedAt       time.Time
 	Notes             []string
 }
 
+// Operation statuses of an execution.
+const (
+	OperationApplied     = "applied"
+	OperationFailed      = "failed"
+	OperationSkipped     = "skipped"
+	OperationInterrupted = "interrupted"
+	OperationNotRun      = "not-run"
+)
+
+// OperationResult is the outcome of one operation of an execution. Skipped
+// operations were applied by the run being resumed; operations are not run
+// when an earlier failure or an interruption stopped the execution first.
+type OperationResult struct {
+	Operation   Operation
+	Status      string
+	StartedAt   time.Time
+	CompletedAt time.Time
+	Error       string
+}
+
+// Duration returns how long the operation ran.
+func (r OperationResult) Duration() time.Duration {
+	if r.StartedAt.IsZero() || r.CompletedAt.IsZero() {
+		return 0
+	}
+	return r.CompletedAt.Sub(r.StartedAt)
+}
+
+// Retry records a failed attempt of a provider call that was repeated after
+// Delay. Attempt counts from 1.
+type Retry struct {
+	Target  string
+	Attempt int
+	Error   string
+	Delay   time.Duration
+	Time    time.Time
+}
+
+// RollbackReport describes the rollback of a partially applied plan.
+// RolledBack holds the compensating operations that were applied, Failed the
+// ones that failed, and Irreversible the applied operations that had no
+// compensating operation and were left in place.
+type RollbackReport struct {
+	RolledBack   []Operation
+	Failed       []RollbackFailure
+	Irreversible []Operation
+}
+
+// RollbackFailure is a compensating operation that could not be applied.
+type RollbackFailure struct {
+	Operation Operation
+	Error     string
+}
+
+// RetryPolicy configures how often and how fast failed provider calls are
+// retried. MaxAttempts includes the first attempt, so 1 disables retries.
+// The delay starts at InitialDelay and doubles for every retry up to
+// MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// Hook runs Command before or after every operation it matches. Empty Kind,
+// Target and Action match everything; Target is a path.Match glob matched
+// against the resource name, e.g. "endnet-edge-1" of "server:endnet-edge-1".
+type Hook struct {
+	Name    string
+	When    string
+	Kind    string
+	Target  string
+	Action  string
+	Command string
+	// Timeout limits how long Command may run; 0 means no limit.
+	Timeout time.Duration
+}
+
+// Hook phases.
+const (
+	HookBefore = "before"
+	HookAfter  = "after"
+)
+
+// Matches reports whether the hook applies to op.
+func (h Hook) Matches(op Operation) bool {
+	if h.Kind != "" && h.Kind != op.Kind() {
+		return false
+	}
+	if h.Action != "" && h.Action != op.Type {
+		return false
+	}
+	if h.Target != "" {
+		_, name, _ := strings.Cut(op.Target, ":")
+		if ok, _ := path.Match(h.Target, name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // ErrUnauthenticated indicates API usage prior to authentication.
 var ErrUnauthenticated = errors.New("client is not authenticated")
+
+// APIError is an error response of a provider API. Code is the provider's
+// error code, e.g. "locked" or "rate_limit_exceeded" for Hetzner.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+// Error implements error.
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s (%d): %s", e.Provider, e.Code, e.StatusCode, e.Message)
+}
+
+// Retryable reports whether repeating the request may succeed: the resource
+// was locked or in conflict (409, 423), the client was rate limited (429) or
+// the provider failed (5xx).
+func (e *APIError) Retryable() bool {
+	switch {
+	case e.StatusCode == 409, e.StatusCode == 423, e.StatusCode == 429:
+		return true
+	case e.StatusCode >= 500:
+		return true
+	default:
+		return e.Code == "locked" || e.Code == "rate_limit_exceeded"
+	}
+}
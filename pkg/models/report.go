@@ -0,0 +1,137 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ReportFormatVersion is the version of ExecutionReport. Like
+// PlanFormatVersion, it only changes when a field is removed or changes its
+// meaning.
+const ReportFormatVersion = 1
+
+// Execution statuses of an ExecutionReport.
+const (
+	ExecutionSucceeded   = "succeeded"
+	ExecutionFailed      = "failed"
+	ExecutionInterrupted = "interrupted"
+)
+
+// ExecutionReport is the JSON document written by endnetctl --report. It
+// describes an ExecutionResult with durations in seconds. Operations are
+// listed in plan order.
+type ExecutionReport struct {
+	FormatVersion int               `json:"formatVersion"`
+	Project       string            `json:"project"`
+	Environment   string            `json:"environment,omitempty"`
+	Status        string            `json:"status"`
+	Error         string            `json:"error,omitempty"`
+	StartedAt     time.Time         `json:"startedAt"`
+	CompletedAt   time.Time         `json:"completedAt"`
+	Duration      float64           `json:"durationSeconds"`
+	Notes         []string          `json:"notes,omitempty"`
+	Summary       ReportSummary     `json:"summary"`
+	Operations    []ReportOperation `json:"operations"`
+	Retries       []ReportRetry     `json:"retries,omitempty"`
+	Rollback      *ReportRollback   `json:"rollback,omitempty"`
+}
+
+// ReportSummary counts the operations of an execution by status.
+type ReportSummary struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"byStatus"`
+}
+
+// ReportOperation is the outcome of one operation. Retries counts the retried
+// provider calls of the operation.
+type ReportOperation struct {
+	Operation
+	Status      string    `json:"status"`
+	StartedAt   time.Time `json:"startedAt,omitzero"`
+	CompletedAt time.Time `json:"completedAt,omitzero"`
+	Duration    float64   `json:"durationSeconds"`
+	Error       string    `json:"error,omitempty"`
+	Retries     int       `json:"retries,omitempty"`
+}
+
+// ReportRetry is a failed provider call that was retried after Delay seconds.
+type ReportRetry struct {
+	Target  string    `json:"target"`
+	Attempt int       `json:"attempt"`
+	Error   string    `json:"error"`
+	Delay   float64   `json:"delaySeconds"`
+	Time    time.Time `json:"time"`
+}
+
+// ReportRollback describes the rollback of a failed execution.
+type ReportRollback struct {
+	RolledBack   []Operation         `json:"rolledBack"`
+	Failed       []ReportRollbackErr `json:"failed"`
+	Irreversible []Operation         `json:"irreversible"`
+}
+
+// ReportRollbackErr is a compensating operation that could not be applied.
+type ReportRollbackErr struct {
+	Operation Operation `json:"operation"`
+	Error     string    `json:"error"`
+}
+
+// NewExecutionReport describes result, the result of an execution that
+// returned err. Executions interrupted by a cancelled context are reported
+// as interrupted rather than failed.
+func NewExecutionReport(result *ExecutionResult, err error) ExecutionReport {
+	report := ExecutionReport{
+		FormatVersion: ReportFormatVersion,
+		Status:        ExecutionSucceeded,
+		StartedAt:     result.StartedAt,
+		CompletedAt:   result.CompletedAt,
+		Duration:      result.CompletedAt.Sub(result.StartedAt).Seconds(),
+		Notes:         result.Notes,
+		Summary:       ReportSummary{Total: len(result.Operations), ByStatus: make(map[string]int)},
+		Operations:    make([]ReportOperation, 0, len(result.Operations)),
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		report.Status, report.Error = ExecutionInterrupted, err.Error()
+	default:
+		report.Status, report.Error = ExecutionFailed, err.Error()
+	}
+
+	retries := make(map[string]int)
+	for _, r := range result.Retries {
+		retries[r.Target]++
+		report.Retries = append(report.Retries, ReportRetry{
+			Target:  r.Target,
+			Attempt: r.Attempt,
+			Error:   r.Error,
+			Delay:   r.Delay.Seconds(),
+			Time:    r.Time,
+		})
+	}
+	for _, op := range result.Operations {
+		report.Summary.ByStatus[op.Status]++
+		report.Operations = append(report.Operations, ReportOperation{
+			Operation:   op.Operation,
+			Status:      op.Status,
+			StartedAt:   op.StartedAt,
+			CompletedAt: op.CompletedAt,
+			Duration:    op.Duration().Seconds(),
+			Error:       op.Error,
+			Retries:     retries[op.Operation.Target],
+		})
+	}
+
+	if rb := result.Rollback; rb != nil {
+		report.Rollback = &ReportRollback{
+			RolledBack:   append([]Operation{}, rb.RolledBack...),
+			Failed:       make([]ReportRollbackErr, 0, len(rb.Failed)),
+			Irreversible: append([]Operation{}, rb.Irreversible...),
+		}
+		for _, f := range rb.Failed {
+			report.Rollback.Failed = append(report.Rollback.Failed, ReportRollbackErr{Operation: f.Operation, Error: f.Error})
+		}
+	}
+	return report
+}
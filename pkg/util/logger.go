@@ -1,27 +1,119 @@
 package util
 
-import "log"
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
 
-// Logger defines the logging interface used across the project.
+// Well-known field keys used across the project so log lines can be filtered
+// consistently.
+const (
+	FieldOp        = "op"
+	FieldTarget    = "target"
+	FieldProvider  = "provider"
+	FieldRequestID = "request_id"
+)
+
+// Logger defines the leveled, structured logging interface used across the
+// project. Arguments after the message are alternating keys and values.
 type Logger interface {
-	Infof(format string, args ...interface{})
-	Errorf(format string, args ...interface{})
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+	With(args ...any) Logger
 }
 
-// StdLogger is a Logger backed by the standard library log package.
-type StdLogger struct{}
+// LogOptions configures a Logger created by NewLoggerWithOptions.
+type LogOptions struct {
+	// Level is one of debug, info, warn or error. Defaults to info.
+	Level string
+	// Format is either text or json. Defaults to text.
+	Format string
+	// Output receives the log lines with registered secrets redacted.
+	// Defaults to stderr so stdout stays free for command output.
+	Output io.Writer
+}
 
-// NewLogger returns a Logger that writes to stdout/stderr.
+// SlogLogger is a Logger backed by log/slog.
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// NewLogger returns an info level text Logger that writes to stderr.
 func NewLogger() Logger {
-	return &StdLogger{}
+	logger, _ := NewLoggerWithOptions(LogOptions{})
+	return logger
+}
+
+// NewLoggerWithOptions builds a Logger from the given options.
+func NewLoggerWithOptions(opts LogOptions) (Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	output := opts.Output
+	if output == nil {
+		output = os.Stderr
+	}
+	output = NewRedactingWriter(output)
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(output, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(output, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (expected text or json)", opts.Format)
+	}
+
+	return &SlogLogger{logger: slog.New(handler)}, nil
+}
+
+// ParseLevel converts a level name into a slog.Level. An empty name selects
+// the info level.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", name)
+	}
+}
+
+// Debug logs a debug message.
+func (l *SlogLogger) Debug(msg string, args ...any) {
+	l.logger.Debug(msg, args...)
+}
+
+// Info logs an informational message.
+func (l *SlogLogger) Info(msg string, args ...any) {
+	l.logger.Info(msg, args...)
+}
+
+// Warn logs a warning.
+func (l *SlogLogger) Warn(msg string, args ...any) {
+	l.logger.Warn(msg, args...)
 }
 
-// Infof logs an informational message.
-func (l *StdLogger) Infof(format string, args ...interface{}) {
-	log.Printf("INFO: "+format, args...)
+// Error logs an error message.
+func (l *SlogLogger) Error(msg string, args ...any) {
+	l.logger.Error(msg, args...)
 }
 
-// Errorf logs an error message.
-func (l *StdLogger) Errorf(format string, args ...interface{}) {
-	log.Printf("ERROR: "+format, args...)
+// With returns a Logger that adds the given fields to every message.
+func (l *SlogLogger) With(args ...any) Logger {
+	return &SlogLogger{logger: l.logger.With(args...)}
 }
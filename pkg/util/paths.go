@@ -0,0 +1,19 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandPath resolves a leading "~/" to the current user's home directory.
+func ExpandPath(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
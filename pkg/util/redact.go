@@ -0,0 +1,80 @@
+package util
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secret values in redacted output.
+const Redacted = "[REDACTED]"
+
+var secrets = struct {
+	sync.RWMutex
+	values   map[string]struct{}
+	replacer *strings.Replacer
+}{values: make(map[string]struct{})}
+
+// RegisterSecret marks value as secret so that Redact and redacting writers
+// replace it from then on. Empty values are ignored.
+func RegisterSecret(value string) {
+	if value == "" {
+		return
+	}
+
+	secrets.Lock()
+	defer secrets.Unlock()
+
+	if _, ok := secrets.values[value]; ok {
+		return
+	}
+	secrets.values[value] = struct{}{}
+
+	// Replace longer secrets first so a secret containing another one is
+	// redacted as a whole.
+	values := make([]string, 0, len(secrets.values))
+	for v := range secrets.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, Redacted)
+	}
+	secrets.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact replaces every registered secret in s.
+func Redact(s string) string {
+	secrets.RLock()
+	replacer := secrets.replacer
+	secrets.RUnlock()
+
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// RedactingWriter redacts registered secrets from everything written through
+// it. Secrets are only detected within a single Write call, which holds for
+// the line-oriented writers used by loggers and fmt.Fprint*.
+type RedactingWriter struct {
+	w io.Writer
+}
+
+// NewRedactingWriter wraps w in a RedactingWriter.
+func NewRedactingWriter(w io.Writer) *RedactingWriter {
+	return &RedactingWriter{w: w}
+}
+
+// Write implements io.Writer. It reports len(p) on success even when the
+// redacted output has a different length.
+func (r *RedactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}